@@ -1,6 +1,8 @@
 package ackproto
 
 import (
+	"errors"
+
 	"github.com/Sirupsen/logrus"
 	"github.com/donothingloop/hamgo/node"
 	"github.com/donothingloop/hamgo/protocol"
@@ -11,6 +13,28 @@ type Handler struct {
 	node *node.Node
 }
 
+func init() {
+	node.RegisterExtension("ack", func(n *node.Node) *node.PayloadHandler {
+		h := NewHandler(n)
+
+		return &node.PayloadHandler{
+			Type:   protocol.PayloadAck,
+			Decode: decode,
+			Handle: h.ACKHandler,
+		}
+	})
+}
+
+// decode parses an ACK payload.
+func decode(buf []byte) (interface{}, error) {
+	ack := protocol.ParseACKPayload(buf)
+	if ack == nil {
+		return nil, errors.New("invalid ACK payload")
+	}
+
+	return ack, nil
+}
+
 // NewHandler creates a new handler for the ACK protocol.
 func NewHandler(n *node.Node) *Handler {
 	return &Handler{
@@ -18,13 +42,8 @@ func NewHandler(n *node.Node) *Handler {
 	}
 }
 
-// ACKHandler provides a handler for ack payloads.
-func (h *Handler) ACKHandler(msg *protocol.Message, src *node.Peer) {
-	// ignore non-ack messages
-	if msg.PayloadType != protocol.PayloadAck {
-		return
-	}
-
+// ACKHandler provides a handler for decoded ack payloads.
+func (h *Handler) ACKHandler(msg *protocol.Message, payload interface{}, src *node.Peer) {
 	// catch empty messages
 	if src == nil || msg == nil {
 		return
@@ -32,8 +51,8 @@ func (h *Handler) ACKHandler(msg *protocol.Message, src *node.Peer) {
 
 	logrus.Debug("ACKHandler: received message")
 
-	ack := protocol.ParseACKPayload(msg.Payload)
-	if ack == nil {
+	ack, ok := payload.(*protocol.ACKPayload)
+	if !ok {
 		logrus.Warn("ACKHandler: failed to handle messages")
 		return
 	}
@@ -44,4 +63,8 @@ func (h *Handler) ACKHandler(msg *protocol.Message, src *node.Peer) {
 		"Contact Type": ack.Source.Type,
 		"Sequence":     ack.SeqCounter,
 	}).Info("ACKHandler: ACK msg received")
+
+	if h.node.RecordACK(ack, msg) {
+		logrus.Debug("ACKHandler: receipt recorded")
+	}
 }
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/donothingloop/hamgo/parameters"
+
+	"github.com/spf13/cobra"
+)
+
+var configPrint bool
+
+func init() {
+	configCheckCmd.Flags().BoolVar(&configPrint, "print", false, "print the effective configuration as JSON")
+	configCmd.AddCommand(configCheckCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "configuration tools",
+}
+
+var configCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "validate the config file including the environment overrides",
+	Run:   executeConfigCheck,
+}
+
+// mustLoadConfig loads the config file, all problems found are reported
+// before exiting.
+func mustLoadConfig() *parameters.Config {
+	cfg, err := parameters.LoadConfig(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	return cfg
+}
+
+func executeConfigCheck(cmd *cobra.Command, args []string) {
+	cfg := mustLoadConfig()
+
+	if configPrint {
+		dat, _ := json.MarshalIndent(cfg, "", "    ")
+		fmt.Println(string(dat))
+		return
+	}
+
+	fmt.Printf("%s: configuration is valid\n", configFile)
+}
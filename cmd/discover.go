@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/donothingloop/hamgo/node"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	discoverType    string
+	discoverName    string
+	discoverTTL     uint
+	discoverTimeout float64
+	discoverAPI     string
+)
+
+func init() {
+	discoverCmd.Flags().StringVar(&discoverType, "type", "", "service type, e.g. http or ssh")
+	discoverCmd.Flags().StringVar(&discoverName, "name", "", "service name pattern, * and ? are supported")
+	discoverCmd.Flags().UintVar(&discoverTTL, "ttl", 0, "hops the query is flooded, defaults to the node settings")
+	discoverCmd.Flags().Float64Var(&discoverTimeout, "timeout", 0, "seconds to collect replies, defaults to the node settings")
+	discoverCmd.Flags().StringVar(&discoverAPI, "api", "", "REST API of the node, defaults to the port in the config file")
+	rootCmd.AddCommand(discoverCmd)
+}
+
+var discoverCmd = &cobra.Command{
+	Use:   "discover",
+	Short: "discover services through a running node",
+	Run:   executeDiscover,
+}
+
+func executeDiscover(cmd *cobra.Command, args []string) {
+	api := discoverAPI
+	if api == "" {
+		config = mustLoadConfig()
+		api = fmt.Sprintf("http://localhost:%d", config.REST.Port)
+	}
+
+	q := url.Values{}
+	q.Set("type", discoverType)
+	q.Set("name", discoverName)
+
+	if discoverTTL != 0 {
+		q.Set("ttl", fmt.Sprint(discoverTTL))
+	}
+
+	if discoverTimeout != 0 {
+		q.Set("timeout", fmt.Sprint(discoverTimeout))
+	}
+
+	// the node blocks for the collection window
+	client := http.Client{Timeout: time.Minute}
+
+	res, err := client.Get(strings.TrimSuffix(api, "/") + "/api/discover?" + q.Encode())
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to query node")
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to read reply")
+	}
+
+	if res.StatusCode != 200 {
+		logrus.Fatalf("Discovery failed: %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	svcs := []node.Service{}
+	if err := json.Unmarshal(body, &svcs); err != nil {
+		logrus.WithError(err).Fatal("Failed to parse reply")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tTYPE\tNAME\tADDRESS\tEXPIRES")
+
+	for _, s := range svcs {
+		addr := net.JoinHostPort(s.IP, fmt.Sprint(s.Port))
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Source, s.Type, s.Name, addr, s.Expires.Format(time.RFC3339))
+	}
+
+	w.Flush()
+}
@@ -27,7 +27,7 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "enable debug output")
-	rootCmd.PersistentFlags().StringVar(&configFile, "config", "hamgo.json", "JSON config file")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "hamgo.json", "config file, JSON, YAML or TOML")
 }
 
 func initConfig() {
@@ -1,15 +1,21 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/donothingloop/hamgo/ackproto"
-
+	"github.com/donothingloop/hamgo/dnsserver"
+	"github.com/donothingloop/hamgo/mdnsbridge"
 	"github.com/donothingloop/hamgo/node"
-	"github.com/donothingloop/hamgo/parameters"
 	"github.com/donothingloop/hamgo/protocol"
 	"github.com/donothingloop/hamgo/rest"
-	"github.com/donothingloop/hamgo/updproto"
+
+	// protocol extensions, registered with the node on import
+	_ "github.com/donothingloop/hamgo/ackproto"
+	_ "github.com/donothingloop/hamgo/updproto"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -30,54 +36,122 @@ var serverCmd = &cobra.Command{
 
 func executeServer(cmd *cobra.Command, args []string) {
 	// read config
-	config = parameters.ReadConfig(configFile)
+	config = mustLoadConfig()
 
 	sett := config.Node
 
-	n, err := node.NewNode(sett, config.Station)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n, err := node.NewNode(ctx, sett, config.Station)
 
 	if err != nil {
-		logrus.WithError(err).Warn("Failed to create node")
+		logrus.WithError(err).Fatal("Failed to create node")
 	}
 
-	// create an update protocol handler
-	updh := updproto.NewHandler(n)
-	ackh := ackproto.NewHandler(n)
-
-	n.AddCallback(&node.MessageCallback{
-		Cb: updh.UpdHandler,
-	})
-	n.AddCallback(&node.MessageCallback{
-		Cb: ackh.ACKHandler,
-	})
-
-	n.AddPeerConnCallback(&node.PeerConnCallback{
-		PeerConnected: updh.PeerConnectedHandler,
-	})
-
-	err = n.Init()
-	if err != nil {
-		logrus.WithError(err).Warn("Failed to init node")
+	if err := n.Init(ctx); err != nil {
+		logrus.WithError(err).Fatal("Failed to init node")
 	}
 
 	logrus.Info("Node started.")
-	defer n.Close()
 
 	// create a new rest server
 	rs := rest.NewServer(config.REST)
-	go rs.Init(n)
+	restDone := make(chan interface{})
+
+	go func() {
+		rs.Init(ctx, n)
+		close(restDone)
+	}()
+
+	// the dns server is optional
+	dnsDone := make(chan interface{})
+
+	if config.DNS.Enabled {
+		ds := dnsserver.NewServer(config.DNS)
+
+		go func() {
+			ds.Init(ctx, n)
+			close(dnsDone)
+		}()
+	} else {
+		close(dnsDone)
+	}
+
+	// the mdns bridge is optional
+	mdnsDone := make(chan interface{})
+
+	if config.MDNS.Enabled {
+		br := mdnsbridge.NewBridge(config.MDNS, config.Station)
+
+		go func() {
+			br.Init(ctx, n)
+			close(mdnsDone)
+		}()
+	} else {
+		close(mdnsDone)
+	}
 
 	if test {
-		logrus.Debug("Waiting for 5 seconds")
-		<-time.After(time.Second * 5)
-
-		for {
-			<-time.After(time.Second)
-			n.SpreadMessage(&protocol.Message{
-				Version: 1,
-			})
-		}
+		go spreadTestMessages(ctx, n)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+
+	s := <-sig
+	logrus.WithField("signal", s).Info("Shutting down")
+
+	// drain the peer queues
+	dctx, dcancel := context.WithTimeout(context.Background(), time.Duration(sett.ShutdownTimeout)*time.Second)
+	defer dcancel()
+
+	if err := n.Shutdown(dctx); err != nil {
+		logrus.WithError(err).Warn("Node shutdown incomplete")
+	}
+
+	cancel()
+	<-restDone
+	<-dnsDone
+	<-mdnsDone
+
+	logrus.Info("Node stopped.")
+}
+
+// spreadTestMessages spreads a test message every second.
+func spreadTestMessages(ctx context.Context, n *node.Node) {
+	logrus.Debug("Waiting for 5 seconds")
+
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Second * 5):
 	}
 
-	select {}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+
+		payload := []byte("test")
+		msg := &protocol.Message{
+			Version:       protocol.Version,
+			TTL:           255,
+			PayloadType:   protocol.PayloadCQ,
+			PayloadLenght: uint32(len(payload)),
+			Payload:       payload,
+		}
+
+		// send as the station with the next sequence counter
+		if err := n.AssignIdentity("", msg); err != nil {
+			logrus.WithError(err).Warn("Failed to assign the test message")
+			continue
+		}
+
+		if err := n.SpreadMessage(msg); err != nil {
+			logrus.WithError(err).Warn("Failed to spread the test message")
+		}
+	}
 }
@@ -0,0 +1,181 @@
+package dnsserver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// Default values for the DNS server.
+const (
+	defaultListen     = ":5353"
+	defaultZone       = "hamgo"
+	defaultStationTTL = 60
+)
+
+// Server answers DNS queries for the stations and services known to the node.
+type Server struct {
+	settings parameters.DNSSettings
+	zone     zone
+	udp      *dns.Server
+	tcp      *dns.Server
+	wg       sync.WaitGroup
+}
+
+// NewServer creates a new DNS server.
+func NewServer(sett parameters.DNSSettings) *Server {
+	if sett.Listen == "" {
+		sett.Listen = defaultListen
+	}
+
+	if sett.Zone == "" {
+		sett.Zone = defaultZone
+	}
+
+	if sett.StationTTL == 0 {
+		sett.StationTTL = defaultStationTTL
+	}
+
+	return &Server{
+		settings: sett,
+		zone: zone{
+			origin:     dns.Fqdn(strings.ToLower(sett.Zone)),
+			stationTTL: uint32(sett.StationTTL),
+			now:        time.Now,
+		},
+	}
+}
+
+// ServeDNS answers a query.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	if len(r.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		w.WriteMsg(m)
+		return
+	}
+
+	q := r.Question[0]
+	name := strings.ToLower(q.Name)
+	origin := s.zone.origin
+
+	var rel string
+	switch {
+	case name == origin:
+	case strings.HasSuffix(name, "."+origin):
+		rel = strings.TrimSuffix(name, "."+origin)
+	default:
+		logrus.WithField("name", q.Name).Debug("DNSServer: query outside of the zone")
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+
+	m.Authoritative = true
+	res := s.zone.resolve(name, rel, q.Qtype)
+
+	if !res.exists {
+		m.Rcode = dns.RcodeNameError
+	}
+
+	m.Answer = res.answer
+	m.Extra = res.extra
+
+	// negative answers carry the SOA for caching
+	if len(m.Answer) == 0 {
+		m.Ns = []dns.RR{s.zone.soa()}
+	}
+
+	if err := w.WriteMsg(m); err != nil {
+		logrus.WithError(err).Debug("DNSServer: failed to write reply")
+	}
+}
+
+// Start listens on UDP and TCP and answers from the source.
+func (s *Server) Start(src Source) error {
+	s.zone.src = src
+
+	pc, err := net.ListenPacket("udp", s.settings.Listen)
+	if err != nil {
+		return err
+	}
+
+	// use the port of the UDP socket, the listen port may be chosen by the system
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		return err
+	}
+
+	// the servers can only be shut down after they started
+	started := sync.WaitGroup{}
+	started.Add(2)
+
+	s.udp = &dns.Server{PacketConn: pc, Handler: s, NotifyStartedFunc: started.Done}
+	s.tcp = &dns.Server{Listener: l, Handler: s, NotifyStartedFunc: started.Done}
+
+	for _, srv := range []*dns.Server{s.udp, s.tcp} {
+		s.wg.Add(1)
+
+		go func(srv *dns.Server) {
+			defer s.wg.Done()
+
+			if err := srv.ActivateAndServe(); err != nil {
+				logrus.WithError(err).Debug("DNSServer: stopped serving")
+			}
+		}(srv)
+	}
+
+	started.Wait()
+
+	logrus.WithField("addr", pc.LocalAddr()).WithField("zone", s.zone.origin).Info("DNSServer: listening")
+	return nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	if s.udp == nil {
+		return nil
+	}
+
+	return s.udp.PacketConn.LocalAddr()
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	if s.udp == nil {
+		return
+	}
+
+	for _, srv := range []*dns.Server{s.udp, s.tcp} {
+		if err := srv.Shutdown(); err != nil {
+			logrus.WithError(err).Debug("DNSServer: failed to shut down")
+		}
+	}
+
+	s.wg.Wait()
+}
+
+// Init the DNS server, it serves until the context is done.
+func (s *Server) Init(ctx context.Context, src Source) {
+	logrus.Debug("DNSServer: starting")
+
+	if err := s.Start(src); err != nil {
+		logrus.WithError(err).Warn("DNSServer: failed to start")
+		return
+	}
+
+	<-ctx.Done()
+
+	logrus.Debug("DNSServer: shutting down")
+	s.Close()
+}
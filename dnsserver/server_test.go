@@ -0,0 +1,204 @@
+package dnsserver
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/node"
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/miekg/dns"
+)
+
+type testSource struct {
+	stations []node.Station
+	services []node.Service
+}
+
+func (s *testSource) Stations(q node.StationQuery) ([]node.Station, error) {
+	return s.stations, nil
+}
+
+func (s *testSource) Services(typ string) []node.Service {
+	res := []node.Service{}
+
+	for _, svc := range s.services {
+		if typ == "" || svc.Type == typ {
+			res = append(res, svc)
+		}
+	}
+
+	return res
+}
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"callsign", "OE1XYZ", "oe1xyz"},
+		{"portable", "OE1XYZ/P", "oe1xyz-p"},
+		{"name", "Webcam Kahlenberg!", "webcam-kahlenberg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Label(tt.in); got != tt.want {
+				t.Errorf("Label() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	now := time.Now()
+	src := &testSource{
+		stations: []node.Station{
+			{Callsign: "OE1XYZ", IPs: []string{"44.143.1.1", "fd00::1"}, Message: "hello"},
+		},
+		services: []node.Service{
+			{
+				Source:     "OE1XYZ",
+				Name:       "Webcam",
+				Type:       "http",
+				IP:         "44.143.1.2",
+				Port:       8080,
+				Attributes: []protocol.ServiceAttribute{{Key: "path", Value: "/cam"}},
+				Expires:    now.Add(120 * time.Second),
+			},
+		},
+	}
+
+	s := NewServer(parameters.DNSSettings{Listen: "127.0.0.1:0", Zone: "Hamgo"})
+	s.zone.now = func() time.Time { return now }
+
+	if err := s.Start(src); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name  string
+		qname string
+		qtype uint16
+		net   string
+		rcode int
+		want  []string
+		extra []string
+	}{
+		{
+			name:  "A",
+			qname: "oe1xyz.hamgo.",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeSuccess,
+			want:  []string{"oe1xyz.hamgo.\t60\tIN\tA\t44.143.1.1"},
+		},
+		{
+			name:  "AAAA over TCP",
+			qname: "OE1XYZ.hamgo.",
+			qtype: dns.TypeAAAA,
+			net:   "tcp",
+			rcode: dns.RcodeSuccess,
+			want:  []string{"oe1xyz.hamgo.\t60\tIN\tAAAA\tfd00::1"},
+		},
+		{
+			name:  "station TXT",
+			qname: "oe1xyz.hamgo.",
+			qtype: dns.TypeTXT,
+			rcode: dns.RcodeSuccess,
+			want:  []string{"oe1xyz.hamgo.\t60\tIN\tTXT\t\"message=hello\""},
+		},
+		{
+			name:  "SRV",
+			qname: "_http._tcp.hamgo.",
+			qtype: dns.TypeSRV,
+			rcode: dns.RcodeSuccess,
+			want:  []string{"_http._tcp.hamgo.\t120\tIN\tSRV\t0 0 8080 webcam.oe1xyz.hamgo."},
+			extra: []string{"webcam.oe1xyz.hamgo.\t120\tIN\tA\t44.143.1.2"},
+		},
+		{
+			name:  "SRV of station",
+			qname: "_http._tcp.oe1xyz.hamgo.",
+			qtype: dns.TypeSRV,
+			rcode: dns.RcodeSuccess,
+			want:  []string{"_http._tcp.oe1xyz.hamgo.\t120\tIN\tSRV\t0 0 8080 webcam.oe1xyz.hamgo."},
+			extra: []string{"webcam.oe1xyz.hamgo.\t120\tIN\tA\t44.143.1.2"},
+		},
+		{
+			name:  "service TXT",
+			qname: "webcam.oe1xyz.hamgo.",
+			qtype: dns.TypeTXT,
+			rcode: dns.RcodeSuccess,
+			want:  []string{"webcam.oe1xyz.hamgo.\t120\tIN\tTXT\t\"type=http\" \"path=/cam\""},
+		},
+		{
+			name:  "no data",
+			qname: "webcam.oe1xyz.hamgo.",
+			qtype: dns.TypeAAAA,
+			rcode: dns.RcodeSuccess,
+		},
+		{
+			name:  "unknown station",
+			qname: "oe9abc.hamgo.",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeNameError,
+		},
+		{
+			name:  "unknown service type",
+			qname: "_ssh._tcp.hamgo.",
+			qtype: dns.TypeSRV,
+			rcode: dns.RcodeNameError,
+		},
+		{
+			name:  "outside of the zone",
+			qname: "example.com.",
+			qtype: dns.TypeA,
+			rcode: dns.RcodeRefused,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &dns.Client{Net: tt.net, Timeout: 2 * time.Second}
+			m := new(dns.Msg)
+			m.SetQuestion(tt.qname, tt.qtype)
+
+			r, _, err := c.Exchange(m, s.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Rcode != tt.rcode {
+				t.Fatalf("rcode = %v, want %v", dns.RcodeToString[r.Rcode], dns.RcodeToString[tt.rcode])
+			}
+
+			if got := records(r.Answer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("answer = %q, want %q", got, tt.want)
+			}
+
+			if got := records(r.Extra); !reflect.DeepEqual(got, tt.extra) {
+				t.Errorf("extra = %q, want %q", got, tt.extra)
+			}
+
+			if tt.rcode != dns.RcodeRefused && len(tt.want) == 0 {
+				if len(r.Ns) != 1 || r.Ns[0].Header().Rrtype != dns.TypeSOA {
+					t.Errorf("authority = %v, want SOA", r.Ns)
+				}
+			}
+		})
+	}
+}
+
+// records converts the records to sorted strings, nil if there are none.
+func records(rrs []dns.RR) []string {
+	var res []string
+
+	for _, rr := range rrs {
+		res = append(res, rr.String())
+	}
+
+	sort.Strings(res)
+	return res
+}
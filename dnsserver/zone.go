@@ -0,0 +1,240 @@
+package dnsserver
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/donothingloop/hamgo/node"
+
+	"github.com/miekg/dns"
+)
+
+// Source provides the stations and services served by the DNS server.
+type Source interface {
+	Stations(q node.StationQuery) ([]node.Station, error)
+	Services(typ string) []node.Service
+}
+
+// maxLabelLength is the maximum length of a DNS label.
+const maxLabelLength = 63
+
+// Label converts a callsign or service name to a DNS label, e.g. "OE1XYZ/P"
+// to "oe1xyz-p".
+func Label(s string) string {
+	b := []byte(strings.ToLower(s))
+
+	for i, c := range b {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			b[i] = '-'
+		}
+	}
+
+	l := strings.Trim(string(b), "-")
+	if len(l) > maxLabelLength {
+		l = l[:maxLabelLength]
+	}
+
+	return l
+}
+
+// zone answers the queries for the names under the zone.
+type zone struct {
+	origin     string
+	stationTTL uint32
+	src        Source
+	now        func() time.Time
+}
+
+// lookup holds the records found for a name.
+type lookup struct {
+	exists bool
+	answer []dns.RR
+	extra  []dns.RR
+}
+
+// header returns the record header for a name.
+func header(name string, t uint16, ttl uint32) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: t, Class: dns.ClassINET, Ttl: ttl}
+}
+
+// addressRecords returns the A and AAAA records of the addresses.
+func addressRecords(name string, t uint16, ips []string, ttl uint32) []dns.RR {
+	rrs := []dns.RR{}
+
+	for _, v := range ips {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			continue
+		}
+
+		if ip4 := ip.To4(); ip4 != nil {
+			if t == dns.TypeA || t == dns.TypeANY {
+				rrs = append(rrs, &dns.A{Hdr: header(name, dns.TypeA, ttl), A: ip4})
+			}
+		} else if t == dns.TypeAAAA || t == dns.TypeANY {
+			rrs = append(rrs, &dns.AAAA{Hdr: header(name, dns.TypeAAAA, ttl), AAAA: ip})
+		}
+	}
+
+	return rrs
+}
+
+// serviceTTL derives the TTL of a service from its expiry.
+func (z *zone) serviceTTL(s *node.Service) uint32 {
+	ttl := s.Expires.Sub(z.now()) / time.Second
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	return uint32(ttl)
+}
+
+// serviceName returns the name of the address records of a service.
+func (z *zone) serviceName(s *node.Service) string {
+	return Label(s.Name) + "." + Label(s.Source) + "." + z.origin
+}
+
+// services returns the services of a station, all stations if call is empty.
+func (z *zone) services(call string, typ string) []node.Service {
+	res := []node.Service{}
+
+	for _, s := range z.src.Services(typ) {
+		if call == "" || Label(s.Source) == call {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// resolve finds the records of a name and type, name is lower case and
+// relative to the zone without the trailing dot.
+func (z *zone) resolve(fqdn string, rel string, t uint16) lookup {
+	res := lookup{}
+
+	labels := []string{}
+	if rel != "" {
+		labels = strings.Split(rel, ".")
+	}
+
+	switch {
+	case len(labels) == 0:
+		res.exists = true
+		if t == dns.TypeSOA || t == dns.TypeANY {
+			res.answer = append(res.answer, z.soa())
+		}
+
+	case strings.HasPrefix(labels[0], "_"):
+		z.resolveSRV(&res, fqdn, labels, t)
+
+	case len(labels) == 1:
+		z.resolveStation(&res, fqdn, labels[0], t)
+
+	case len(labels) == 2:
+		z.resolveService(&res, fqdn, labels[0], labels[1], t)
+	}
+
+	return res
+}
+
+// resolveStation answers the address records of a station and its CQ message.
+func (z *zone) resolveStation(res *lookup, fqdn string, call string, t uint16) {
+	stations, _ := z.src.Stations(node.StationQuery{})
+
+	for _, s := range stations {
+		if Label(s.Callsign) != call {
+			continue
+		}
+
+		res.exists = true
+		res.answer = append(res.answer, addressRecords(fqdn, t, s.IPs, z.stationTTL)...)
+
+		if (t == dns.TypeTXT || t == dns.TypeANY) && s.Message != "" {
+			res.answer = append(res.answer, &dns.TXT{
+				Hdr: header(fqdn, dns.TypeTXT, z.stationTTL),
+				Txt: []string{"message=" + s.Message},
+			})
+		}
+	}
+
+	// stations that only announced services exist as well
+	if !res.exists && len(z.services(call, "")) != 0 {
+		res.exists = true
+	}
+}
+
+// resolveService answers the address and attribute records of a service.
+func (z *zone) resolveService(res *lookup, fqdn string, name string, call string, t uint16) {
+	for _, s := range z.services(call, "") {
+		if Label(s.Name) != name {
+			continue
+		}
+
+		res.exists = true
+		ttl := z.serviceTTL(&s)
+
+		if s.IP != "" {
+			res.answer = append(res.answer, addressRecords(fqdn, t, []string{s.IP}, ttl)...)
+		}
+
+		if t == dns.TypeTXT || t == dns.TypeANY {
+			txt := []string{"type=" + s.Type}
+			for _, a := range s.Attributes {
+				txt = append(txt, a.Key+"="+a.Value)
+			}
+
+			res.answer = append(res.answer, &dns.TXT{Hdr: header(fqdn, dns.TypeTXT, ttl), Txt: txt})
+		}
+	}
+}
+
+// resolveSRV answers the SRV records of _type._proto[.call], the protocol
+// label is not part of the service type.
+func (z *zone) resolveSRV(res *lookup, fqdn string, labels []string, t uint16) {
+	if len(labels) < 2 || len(labels) > 3 || (labels[1] != "_tcp" && labels[1] != "_udp") {
+		return
+	}
+
+	call := ""
+	if len(labels) == 3 {
+		call = labels[2]
+	}
+
+	typ := strings.TrimPrefix(labels[0], "_")
+
+	for _, s := range z.services(call, typ) {
+		res.exists = true
+
+		if t != dns.TypeSRV && t != dns.TypeANY {
+			continue
+		}
+
+		ttl := z.serviceTTL(&s)
+		target := z.serviceName(&s)
+
+		res.answer = append(res.answer, &dns.SRV{
+			Hdr:    header(fqdn, dns.TypeSRV, ttl),
+			Port:   s.Port,
+			Target: target,
+		})
+
+		if s.IP != "" {
+			res.extra = append(res.extra, addressRecords(target, dns.TypeANY, []string{s.IP}, ttl)...)
+		}
+	}
+}
+
+// soa returns the SOA record of the zone.
+func (z *zone) soa() dns.RR {
+	return &dns.SOA{
+		Hdr:     header(z.origin, dns.TypeSOA, z.stationTTL),
+		Ns:      "ns." + z.origin,
+		Mbox:    "hostmaster." + z.origin,
+		Serial:  uint32(z.now().Unix()),
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  z.stationTTL,
+	}
+}
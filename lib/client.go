@@ -1,12 +1,16 @@
 package lib
 
 import (
-	"fmt"
 	"net"
+	"strconv"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 )
 
+// dialTimeout limits the time to establish a connection.
+const dialTimeout = 10 * time.Second
+
 // TCPClient is a tcp client for the communication between peers.
 type TCPClient struct {
 	Host string
@@ -17,7 +21,7 @@ type TCPClient struct {
 func (c *TCPClient) Start() (*Connection, error) {
 	logrus.Infof("TCPClient: connecting to %s:%d", c.Host, c.Port)
 
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", c.Host, c.Port))
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.Host, strconv.Itoa(int(c.Port))), dialTimeout)
 	if err != nil {
 		logrus.WithError(err).Warn("TCPClient: failed to connect to host")
 		return nil, err
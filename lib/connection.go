@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"errors"
 	"net"
+	"sync"
 
 	"github.com/donothingloop/hamgo/parameters"
 
@@ -18,7 +19,7 @@ type Connection struct {
 	Received    chan []byte
 	Send        chan *Message
 	close       chan interface{}
-	Closed      bool
+	closeOnce   sync.Once
 }
 
 // Message is a message that is sent to the connection.
@@ -29,9 +30,25 @@ type Message struct {
 
 // Close the connection.
 func (c *Connection) Close() {
-	c.Closed = true
-	close(c.close)
-	c.Connection.Close()
+	c.closeOnce.Do(func() {
+		close(c.close)
+		c.Connection.Close()
+	})
+}
+
+// IsClosed checks if the connection was closed.
+func (c *Connection) IsClosed() bool {
+	select {
+	case <-c.close:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Connection) Done() <-chan interface{} {
+	return c.close
 }
 
 func (c *Connection) sendMessage(msg *Message) {
@@ -187,7 +204,11 @@ func (c *Connection) connectionWorker() {
 			}).Debugf("Connection: received frame end")
 
 			// send the received data
-			c.Received <- buf[:idx]
+			select {
+			case c.Received <- buf[:idx]:
+			case <-c.close:
+				return
+			}
 
 			// create a new buffer
 			buf = make([]byte, parameters.TransportMaxPackageSize)
@@ -3,6 +3,7 @@ package lib
 import (
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -11,8 +12,11 @@ import (
 type TCPServer struct {
 	Port          uint
 	listener      net.Listener
-	close         bool
+	done          chan interface{}
+	stopOnce      sync.Once
 	NewConnection chan *Connection
+	// Accept decides if a connection from the remote address is accepted, all are accepted if nil
+	Accept func(net.Addr) bool
 }
 
 func (t *TCPServer) worker() {
@@ -21,10 +25,23 @@ func (t *TCPServer) worker() {
 
 		conn, err := t.listener.Accept()
 		if err != nil {
+			select {
+			case <-t.done:
+				logrus.Debug("TCPServer: worker stopped")
+				return
+			default:
+			}
+
 			logrus.WithError(err).Warn("TCPServer: failed to accept client")
 			continue
 		}
 
+		if t.Accept != nil && !t.Accept(conn.RemoteAddr()) {
+			logrus.Warnf("TCPServer: rejected connection: %s", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+
 		logrus.Infof("TCPServer: new connection: %s", conn.RemoteAddr().String())
 
 		// create a new connection
@@ -36,7 +53,12 @@ func (t *TCPServer) worker() {
 		}
 
 		// signal that a new connection is established
-		t.NewConnection <- &c
+		select {
+		case t.NewConnection <- &c:
+		case <-t.done:
+			conn.Close()
+			return
+		}
 
 		// start a goroutine for the worker
 		go c.connectionWorker()
@@ -55,6 +77,7 @@ func (t *TCPServer) Start() error {
 	}
 
 	t.NewConnection = make(chan *Connection)
+	t.done = make(chan interface{})
 	t.listener = conn
 
 	// start the listener accept worker
@@ -63,14 +86,29 @@ func (t *TCPServer) Start() error {
 	return nil
 }
 
+// Addr returns the address the server is listening on.
+func (t *TCPServer) Addr() net.Addr {
+	if t.listener == nil {
+		return nil
+	}
+
+	return t.listener.Addr()
+}
+
 // Stop the tcp server.
 func (t *TCPServer) Stop() {
 	logrus.Debug("TCPServer: stopping")
 
-	t.close = true
-
-	err := t.listener.Close()
-	if err != nil {
-		logrus.WithError(err).Warn("TCPServer: failed to stop listener")
+	if t.listener == nil {
+		return
 	}
+
+	t.stopOnce.Do(func() {
+		close(t.done)
+
+		err := t.listener.Close()
+		if err != nil {
+			logrus.WithError(err).Warn("TCPServer: failed to stop listener")
+		}
+	})
 }
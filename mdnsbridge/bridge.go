@@ -0,0 +1,449 @@
+package mdnsbridge
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/donothingloop/hamgo/node"
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// Default values for the bridge.
+const (
+	defaultInterval = 120
+	// collectDelay is the time the responses to a query are collected
+	collectDelay = 3 * time.Second
+	// lifetimeIntervals is the lifetime of a bridged service in browse intervals
+	lifetimeIntervals = 3
+	// maxPacketSize of an mDNS message
+	maxPacketSize = 9000
+)
+
+// Node spreads the bridged services and provides the remote ones.
+type Node interface {
+	SpreadMessage(msg *protocol.Message) error
+	Services(typ string) []node.Service
+}
+
+// normalizeType converts "_http._tcp", "_http._tcp.local." or "HTTP" to "http".
+func normalizeType(s string) string {
+	s = strings.ToLower(strings.TrimSuffix(s, "."))
+	s = strings.TrimSuffix(s, ".local")
+	s = strings.TrimSuffix(s, "._tcp")
+	s = strings.TrimSuffix(s, "._udp")
+
+	return strings.TrimPrefix(s, "_")
+}
+
+// filter decides which service types cross the bridge.
+type filter struct {
+	allow map[string]bool
+	deny  map[string]bool
+}
+
+func newFilter(allow []string, deny []string) filter {
+	f := filter{
+		allow: make(map[string]bool),
+		deny:  make(map[string]bool),
+	}
+
+	for _, t := range allow {
+		f.allow[normalizeType(t)] = true
+	}
+
+	for _, t := range deny {
+		f.deny[normalizeType(t)] = true
+	}
+
+	return f
+}
+
+// allowed checks if a type crosses the bridge, the deny list wins and an
+// empty allow list allows all types.
+func (f filter) allowed(typ string) bool {
+	typ = normalizeType(typ)
+
+	if f.deny[typ] {
+		return false
+	}
+
+	return len(f.allow) == 0 || f.allow[typ]
+}
+
+type entryKey struct {
+	instance string
+	typ      string
+}
+
+// Bridge re-announces the services of the LAN into the network and
+// advertises the remote services on the LAN.
+type Bridge struct {
+	settings parameters.MDNSSettings
+	local    string
+	filter   filter
+	interval time.Duration
+	seq      uint64
+
+	node      Node
+	conn      *net.UDPConn
+	cache     *cache
+	announced map[entryKey]Entry
+	now       func() time.Time
+	lock      sync.Mutex
+	wg        sync.WaitGroup
+}
+
+// NewBridge creates a new bridge for the station.
+func NewBridge(sett parameters.MDNSSettings, station parameters.Station) *Bridge {
+	interval := time.Duration(sett.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultInterval * time.Second
+	} else if interval < collectDelay {
+		interval = collectDelay
+	}
+
+	return &Bridge{
+		settings: sett,
+		local:    strings.ToUpper(station.Callsign),
+		filter:   newFilter(sett.Allow, sett.Deny),
+		interval: interval,
+		// the sequence numbers of the announcements must not repeat across restarts
+		seq:       uint64(time.Now().UnixNano()),
+		cache:     newCache(),
+		announced: make(map[entryKey]Entry),
+		now:       time.Now,
+	}
+}
+
+// Start joins the mDNS group and handles the received messages.
+func (b *Bridge) Start(n Node) error {
+	var ifi *net.Interface
+
+	if b.settings.Interface != "" {
+		i, err := net.InterfaceByName(b.settings.Interface)
+		if err != nil {
+			return err
+		}
+
+		ifi = i
+	}
+
+	conn, err := net.ListenMulticastUDP("udp4", ifi, mdnsGroup)
+	if err != nil {
+		return err
+	}
+
+	b.node = n
+	b.conn = conn
+
+	b.wg.Add(1)
+	go b.receive()
+
+	logrus.WithField("advertise", b.settings.Advertise).Info("MDNSBridge: joined the mDNS group")
+	return nil
+}
+
+// Close leaves the mDNS group.
+func (b *Bridge) Close() {
+	if b.conn == nil {
+		return
+	}
+
+	b.conn.Close()
+	b.wg.Wait()
+}
+
+// Init the bridge, it browses the LAN until the context is done.
+func (b *Bridge) Init(ctx context.Context, n Node) {
+	logrus.Debug("MDNSBridge: starting")
+
+	if err := b.Start(n); err != nil {
+		logrus.WithError(err).Warn("MDNSBridge: failed to start")
+		return
+	}
+
+	// the bridged services expire after their lifetime once the bridge stopped
+	defer b.Close()
+
+	for {
+		if err := b.query(); err != nil {
+			logrus.WithError(err).Warn("MDNSBridge: failed to send query")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(collectDelay):
+		}
+
+		b.sync()
+
+		select {
+		case <-ctx.Done():
+			logrus.Debug("MDNSBridge: shutting down")
+			return
+		case <-time.After(b.interval - collectDelay):
+		}
+	}
+}
+
+// receive handles the messages of the group until the connection is closed.
+func (b *Bridge) receive() {
+	defer b.wg.Done()
+	buf := make([]byte, maxPacketSize)
+
+	for {
+		l, src, err := b.conn.ReadFromUDP(buf)
+		if err != nil {
+			logrus.WithError(err).Debug("MDNSBridge: stopped receiving")
+			return
+		}
+
+		msg := new(dns.Msg)
+		if err := msg.Unpack(buf[:l]); err != nil {
+			logrus.WithError(err).Debug("MDNSBridge: failed to parse message")
+			continue
+		}
+
+		if reply := b.handle(msg, src); reply != nil {
+			b.send(reply, src)
+		}
+	}
+}
+
+// handle caches the records of a response or answers a query, it returns the
+// reply to send.
+func (b *Bridge) handle(msg *dns.Msg, src *net.UDPAddr) *dns.Msg {
+	if msg.Response {
+		now := b.now()
+
+		b.lock.Lock()
+		for _, sec := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+			for _, rr := range sec {
+				b.cache.add(rr, now)
+			}
+		}
+		b.lock.Unlock()
+
+		return nil
+	}
+
+	if !b.settings.Advertise || msg.Opcode != dns.OpcodeQuery {
+		return nil
+	}
+
+	reply := answer(msg, b.advertisements())
+	if reply == nil {
+		return nil
+	}
+
+	// legacy unicast queries get the question and ID back, RFC 6762 section 6.7
+	if src != nil && src.Port != mdnsGroup.Port {
+		reply.Id = msg.Id
+		reply.Question = msg.Question
+	}
+
+	return reply
+}
+
+// send transmits a message, multicast replies go to the group.
+func (b *Bridge) send(msg *dns.Msg, src *net.UDPAddr) {
+	dst := mdnsGroup
+	if src != nil && src.Port != mdnsGroup.Port {
+		dst = src
+	}
+
+	buf, err := msg.Pack()
+	if err != nil {
+		logrus.WithError(err).Warn("MDNSBridge: failed to pack message")
+		return
+	}
+
+	if _, err := b.conn.WriteToUDP(buf, dst); err != nil {
+		logrus.WithError(err).Debug("MDNSBridge: failed to send message")
+	}
+}
+
+// advertisements returns the remote services that are advertised on the LAN.
+func (b *Bridge) advertisements() []advertisement {
+	if b.node == nil {
+		return nil
+	}
+
+	now := b.now()
+	ads := []advertisement{}
+
+	for _, s := range b.node.Services("") {
+		// local services are on the LAN already
+		if strings.EqualFold(s.Source, b.local) || s.IP == "" || !b.filter.allowed(s.Type) {
+			continue
+		}
+
+		ads = append(ads, newAdvertisement(&s, now))
+	}
+
+	return ads
+}
+
+// questions returns the questions to browse the allowed service types.
+func (b *Bridge) questions() []dns.Question {
+	names := []string{}
+
+	if len(b.filter.allow) == 0 {
+		// browse the enumerated types
+		names = append(names, serviceEnumeration)
+
+		b.lock.Lock()
+		names = append(names, b.cache.types()...)
+		b.lock.Unlock()
+	} else {
+		for t := range b.filter.allow {
+			names = append(names, typeName(t, "tcp"), typeName(t, "udp"))
+		}
+	}
+
+	qs := []dns.Question{}
+	for _, n := range names {
+		qs = append(qs, dns.Question{Name: n, Qtype: dns.TypePTR, Qclass: dns.ClassINET})
+	}
+
+	return qs
+}
+
+// query asks the LAN for the allowed service types.
+func (b *Bridge) query() error {
+	msg := new(dns.Msg)
+	msg.Question = b.questions()
+
+	buf, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	_, err = b.conn.WriteToUDP(buf, mdnsGroup)
+	return err
+}
+
+// lifetime returns the lifetime of the bridged services in seconds.
+func (b *Bridge) lifetime() uint32 {
+	return uint32(lifetimeIntervals * b.interval / time.Second)
+}
+
+// sync announces the resolved services and withdraws the ones that
+// disappeared from the LAN.
+func (b *Bridge) sync() {
+	b.lock.Lock()
+	b.cache.expire(b.now())
+	entries := b.cache.entries()
+	b.lock.Unlock()
+
+	current := make(map[entryKey]Entry)
+
+	for _, e := range entries {
+		// services advertised by bridges would loop
+		if e.bridged() || !b.filter.allowed(e.Type) {
+			continue
+		}
+
+		key := entryKey{instance: e.Instance, typ: e.Type}
+		if _, ok := current[key]; ok {
+			continue
+		}
+
+		if err := b.announce(&e, b.lifetime()); err != nil {
+			logrus.WithError(err).WithField("service", e.Instance).Warn("MDNSBridge: failed to announce service")
+			continue
+		}
+
+		current[key] = e
+	}
+
+	for key, e := range b.announced {
+		if _, ok := current[key]; ok {
+			continue
+		}
+
+		if err := b.announce(&e, 0); err != nil {
+			logrus.WithError(err).WithField("service", e.Instance).Warn("MDNSBridge: failed to withdraw service")
+		}
+	}
+
+	b.announced = current
+}
+
+// announce spreads an entry as a service of the station, a lifetime of zero
+// withdraws it.
+func (b *Bridge) announce(e *Entry, lifetime uint32) error {
+	if b.node == nil {
+		return errors.New("bridge not started")
+	}
+
+	svc := protocol.ServicePayload{
+		Name:       e.Instance,
+		Type:       e.Type,
+		IPIndex:    0,
+		Port:       e.Port,
+		Lifetime:   lifetime,
+		Attributes: []protocol.ServiceAttribute{},
+	}
+
+	if e.Proto == "udp" {
+		svc.Attributes = append(svc.Attributes, protocol.ServiceAttribute{Key: protoAttribute, Value: e.Proto})
+	}
+
+	for _, t := range e.TXT {
+		if t == "" {
+			continue
+		}
+
+		a := protocol.ServiceAttribute{Key: t}
+		if i := strings.Index(t, "="); i >= 0 {
+			a.Key, a.Value = t[:i], t[i+1:]
+		}
+
+		svc.Attributes = append(svc.Attributes, a)
+	}
+
+	if err := svc.Validate(); err != nil {
+		return err
+	}
+
+	ip := protocol.ContactIP{Type: protocol.ContactIPv4, Data: []byte(e.IP)}
+	if ip4 := e.IP.To4(); ip4 != nil {
+		ip.Data = []byte(ip4)
+	} else {
+		ip.Type = protocol.ContactIPv6
+	}
+	ip.Length = uint8(len(ip.Data))
+
+	pbuf := svc.Bytes()
+
+	msg := protocol.Message{
+		Version:    protocol.Version,
+		SeqCounter: atomic.AddUint64(&b.seq, 1),
+		TTL:        255,
+		Source: protocol.Contact{
+			Type:           protocol.ContactTypeFixed,
+			CallsignLength: uint8(len(b.local)),
+			Callsign:       []byte(b.local),
+			NumberIPs:      1,
+			IPs:            []protocol.ContactIP{ip},
+		},
+
+		PayloadType:   protocol.PayloadService,
+		PayloadLenght: uint32(len(pbuf)),
+		Payload:       pbuf,
+	}
+
+	logrus.WithField("service", e.Instance).WithField("lifetime", lifetime).Debug("MDNSBridge: announcing service")
+	return b.node.SpreadMessage(&msg)
+}
@@ -0,0 +1,199 @@
+package mdnsbridge
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/node"
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/miekg/dns"
+)
+
+type testNode struct {
+	spread   []protocol.Message
+	services []node.Service
+	lock     sync.Mutex
+}
+
+func (n *testNode) SpreadMessage(msg *protocol.Message) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.spread = append(n.spread, *msg)
+	return nil
+}
+
+func (n *testNode) Services(typ string) []node.Service {
+	return n.services
+}
+
+// take returns and clears the spread announcements.
+func (n *testNode) take(t *testing.T) []protocol.ServicePayload {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	res := []protocol.ServicePayload{}
+	for _, msg := range n.spread {
+		if string(msg.Source.Callsign) != "OE1XYZ" {
+			t.Errorf("source = %s, want OE1XYZ", msg.Source.Callsign)
+		}
+
+		s, err := protocol.ParseServicePayload(msg.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if int(s.IPIndex) >= len(msg.Source.IPs) {
+			t.Fatalf("ip index %d out of range", s.IPIndex)
+		}
+
+		res = append(res, *s)
+	}
+
+	n.spread = nil
+	return res
+}
+
+func Test_filter_allowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		typ   string
+		want  bool
+	}{
+		{"empty lists", nil, nil, "http", true},
+		{"allowed", []string{"http"}, nil, "http", true},
+		{"allowed service name", []string{"_ipp._tcp"}, nil, "IPP", true},
+		{"not allowed", []string{"http"}, nil, "ssh", false},
+		{"denied", nil, []string{"_ssh._tcp.local."}, "ssh", false},
+		{"deny wins", []string{"ssh"}, []string{"ssh"}, "ssh", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newFilter(tt.allow, tt.deny).allowed(tt.typ); got != tt.want {
+				t.Errorf("allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func response(t *testing.T, rrs ...string) *dns.Msg {
+	m := new(dns.Msg)
+	m.Response = true
+
+	for _, s := range rrs {
+		m.Answer = append(m.Answer, mustRR(t, s))
+	}
+
+	return m
+}
+
+func TestBridge_sync(t *testing.T) {
+	n := &testNode{}
+	b := NewBridge(parameters.MDNSSettings{
+		Deny:     []string{"ssh"},
+		Interval: 60,
+	}, parameters.Station{Callsign: "oe1xyz"})
+	b.node = n
+
+	b.handle(response(t,
+		`_ipp._udp.local. 120 IN PTR Printer._ipp._udp.local.`,
+		`Printer._ipp._udp.local. 120 IN SRV 0 0 631 printer.local.`,
+		`Printer._ipp._udp.local. 120 IN TXT "rp=queue" "color"`,
+		`printer.local. 120 IN AAAA fd00::10`,
+		`_ssh._tcp.local. 120 IN PTR Shell._ssh._tcp.local.`,
+		`Shell._ssh._tcp.local. 120 IN SRV 0 0 22 printer.local.`,
+		// advertised by a bridge
+		`_http._tcp.local. 120 IN PTR Cam._http._tcp.local.`,
+		`Cam._http._tcp.local. 120 IN SRV 0 0 80 printer.local.`,
+		`Cam._http._tcp.local. 120 IN TXT "hamgo=OE3ABC"`,
+	), nil)
+
+	b.sync()
+
+	want := []protocol.ServicePayload{
+		{
+			Name:     "Printer",
+			Type:     "ipp",
+			Port:     631,
+			Lifetime: 180,
+			Attributes: []protocol.ServiceAttribute{
+				{Key: "proto", Value: "udp"},
+				{Key: "rp", Value: "queue"},
+				{Key: "color"},
+			},
+		},
+	}
+
+	if got := n.take(t); !reflect.DeepEqual(got, want) {
+		t.Errorf("announced = %v, want %v", got, want)
+	}
+
+	// the service disappears from the LAN and is withdrawn
+	b.handle(response(t, `_ipp._udp.local. 0 IN PTR Printer._ipp._udp.local.`), nil)
+	b.sync()
+
+	got := n.take(t)
+	if len(got) != 1 || got[0].Name != "Printer" || got[0].Lifetime != 0 {
+		t.Errorf("withdrawn = %v", got)
+	}
+
+	b.sync()
+	if got := n.take(t); len(got) != 0 {
+		t.Errorf("announced after withdrawal = %v", got)
+	}
+}
+
+func TestBridge_handle(t *testing.T) {
+	now := time.Now()
+	n := &testNode{
+		services: []node.Service{
+			{Source: "OE3ABC", Name: "Cam", Type: "http", IP: "44.143.2.1", Port: 80, Expires: now.Add(time.Minute)},
+			// local services are not advertised
+			{Source: "OE1XYZ", Name: "Own", Type: "http", IP: "44.143.1.1", Port: 80, Expires: now.Add(time.Minute)},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		advertise bool
+		src       *net.UDPAddr
+		want      int
+		id        bool
+	}{
+		{"not advertising", false, mdnsGroup, 0, false},
+		{"multicast", true, mdnsGroup, 1, false},
+		{"legacy unicast", true, &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 40000}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBridge(parameters.MDNSSettings{Advertise: tt.advertise}, parameters.Station{Callsign: "OE1XYZ"})
+			b.node = n
+
+			q := new(dns.Msg)
+			q.SetQuestion("_http._tcp.local.", dns.TypePTR)
+
+			reply := b.handle(q, tt.src)
+			if tt.want == 0 {
+				if reply != nil {
+					t.Errorf("handle() = %v, want nil", reply)
+				}
+				return
+			}
+
+			if reply == nil || len(reply.Answer) != tt.want {
+				t.Fatalf("handle() = %v, want %d answers", reply, tt.want)
+			}
+
+			if (reply.Id == q.Id) != tt.id {
+				t.Errorf("id = %v, query id = %v", reply.Id, q.Id)
+			}
+		})
+	}
+}
@@ -0,0 +1,437 @@
+package mdnsbridge
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/donothingloop/hamgo/dnsserver"
+	"github.com/donothingloop/hamgo/node"
+
+	"github.com/miekg/dns"
+)
+
+// mdnsGroup is the IPv4 multicast address of mDNS, RFC 6762.
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+const (
+	localDomain = "local."
+	// serviceEnumeration lists the service types announced on the link, RFC 6763
+	serviceEnumeration = "_services._dns-sd._udp.local."
+	// bridgeAttribute marks the services advertised by a bridge, they must not
+	// be bridged back into the network
+	bridgeAttribute = "hamgo"
+	// protoAttribute keeps the transport protocol of a bridged service
+	protoAttribute = "proto"
+	// maxRecordTTL limits the TTL of the advertised records
+	maxRecordTTL = 4500
+)
+
+// Entry is a service instance resolved on the LAN.
+type Entry struct {
+	// Instance name without the service type and domain
+	Instance string
+	// Type of the service without the leading underscore, e.g. http
+	Type string
+	// Proto is tcp or udp
+	Proto   string
+	IP      net.IP
+	Port    uint16
+	TXT     []string
+	Expires time.Time
+}
+
+// bridged checks if the entry was advertised by a bridge.
+func (e *Entry) bridged() bool {
+	for _, t := range e.TXT {
+		if t == bridgeAttribute || strings.HasPrefix(t, bridgeAttribute+"=") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unescape removes the escaping of a label in presentation format.
+func unescape(s string) string {
+	b := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b = append(b, s[i])
+			continue
+		}
+
+		// \DDD is a decimal byte value
+		if i+3 < len(s) && isDigit(s[i+1]) && isDigit(s[i+2]) && isDigit(s[i+3]) {
+			b = append(b, (s[i+1]-'0')*100+(s[i+2]-'0')*10+(s[i+3]-'0'))
+			i += 3
+			continue
+		}
+
+		b = append(b, s[i+1])
+		i++
+	}
+
+	return string(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// escape converts a string to a label in presentation format.
+func escape(s string) string {
+	b := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '.', ' ', '\\', '"', '(', ')', ';', '@', '$':
+			b = append(b, '\\')
+		}
+
+		b = append(b, s[i])
+	}
+
+	return string(b)
+}
+
+// parseServiceName splits "Instance._type._proto.local." into its parts, the
+// instance is empty for service type names.
+func parseServiceName(name string) (instance string, typ string, proto string, ok bool) {
+	labels := dns.SplitDomainName(strings.ToLower(dns.Fqdn(name)))
+	n := len(labels)
+
+	if n < 3 || labels[n-1] != "local" || !strings.HasPrefix(labels[n-3], "_") {
+		return "", "", "", false
+	}
+
+	if labels[n-2] != "_tcp" && labels[n-2] != "_udp" {
+		return "", "", "", false
+	}
+
+	typ = strings.TrimPrefix(labels[n-3], "_")
+	proto = strings.TrimPrefix(labels[n-2], "_")
+
+	// keep the case of the instance name
+	orig := dns.SplitDomainName(dns.Fqdn(name))
+	parts := []string{}
+	for _, l := range orig[:n-3] {
+		parts = append(parts, unescape(l))
+	}
+
+	return strings.Join(parts, "."), typ, proto, true
+}
+
+// typeName returns the name of a service type, e.g. "_http._tcp.local.".
+func typeName(typ string, proto string) string {
+	return "_" + typ + "._" + proto + "." + localDomain
+}
+
+type recordKey struct {
+	name string
+	typ  uint16
+}
+
+type cachedRecord struct {
+	rr      dns.RR
+	expires time.Time
+}
+
+// cache keeps the records heard on the LAN until their TTL expired.
+type cache struct {
+	records map[recordKey][]cachedRecord
+}
+
+func newCache() *cache {
+	return &cache{
+		records: make(map[recordKey][]cachedRecord),
+	}
+}
+
+// rdata returns the record without its header for comparison.
+func rdata(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
+
+// add stores a record, a TTL of zero removes it.
+func (c *cache) add(rr dns.RR, now time.Time) {
+	h := rr.Header()
+	key := recordKey{name: strings.ToLower(h.Name), typ: h.Rrtype}
+	data := rdata(rr)
+
+	recs := []cachedRecord{}
+	for _, r := range c.records[key] {
+		if rdata(r.rr) != data {
+			recs = append(recs, r)
+		}
+	}
+
+	if h.Ttl > 0 {
+		recs = append(recs, cachedRecord{
+			rr:      rr,
+			expires: now.Add(time.Duration(h.Ttl) * time.Second),
+		})
+	}
+
+	if len(recs) == 0 {
+		delete(c.records, key)
+		return
+	}
+
+	c.records[key] = recs
+}
+
+// expire removes the expired records.
+func (c *cache) expire(now time.Time) {
+	for key, recs := range c.records {
+		valid := []cachedRecord{}
+		for _, r := range recs {
+			if now.Before(r.expires) {
+				valid = append(valid, r)
+			}
+		}
+
+		if len(valid) == 0 {
+			delete(c.records, key)
+		} else {
+			c.records[key] = valid
+		}
+	}
+}
+
+func (c *cache) lookup(name string, typ uint16) []cachedRecord {
+	return c.records[recordKey{name: strings.ToLower(name), typ: typ}]
+}
+
+// types returns the names of the service types enumerated on the LAN.
+func (c *cache) types() []string {
+	res := []string{}
+
+	for _, r := range c.lookup(serviceEnumeration, dns.TypePTR) {
+		res = append(res, r.rr.(*dns.PTR).Ptr)
+	}
+
+	sort.Strings(res)
+	return res
+}
+
+// addresses returns the addresses of a host, IPv4 first.
+func (c *cache) addresses(host string) []net.IP {
+	ips := []net.IP{}
+
+	for _, r := range c.lookup(host, dns.TypeA) {
+		ips = append(ips, r.rr.(*dns.A).A.To4())
+	}
+
+	for _, r := range c.lookup(host, dns.TypeAAAA) {
+		ips = append(ips, r.rr.(*dns.AAAA).AAAA)
+	}
+
+	return ips
+}
+
+// entries resolves the service instances that have an address.
+func (c *cache) entries() []Entry {
+	res := []Entry{}
+
+	for key, ptrs := range c.records {
+		if key.typ != dns.TypePTR || key.name == serviceEnumeration {
+			continue
+		}
+
+		for _, p := range ptrs {
+			inst := p.rr.(*dns.PTR).Ptr
+
+			name, typ, proto, ok := parseServiceName(inst)
+			if !ok || name == "" {
+				continue
+			}
+
+			srvs := c.lookup(inst, dns.TypeSRV)
+			if len(srvs) == 0 {
+				continue
+			}
+
+			srv := srvs[0].rr.(*dns.SRV)
+			ips := c.addresses(srv.Target)
+			if len(ips) == 0 {
+				continue
+			}
+
+			e := Entry{
+				Instance: name,
+				Type:     typ,
+				Proto:    proto,
+				IP:       ips[0],
+				Port:     srv.Port,
+				TXT:      []string{},
+				Expires:  p.expires,
+			}
+
+			if srvs[0].expires.Before(e.Expires) {
+				e.Expires = srvs[0].expires
+			}
+
+			for _, t := range c.lookup(inst, dns.TypeTXT) {
+				e.TXT = append(e.TXT, t.rr.(*dns.TXT).Txt...)
+			}
+
+			res = append(res, e)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Type != res[j].Type {
+			return res[i].Type < res[j].Type
+		}
+
+		return res[i].Instance < res[j].Instance
+	})
+
+	return res
+}
+
+// advertisement holds the mDNS names of a remote service.
+type advertisement struct {
+	service  node.Service
+	typeName string
+	instance string
+	host     string
+	ttl      uint32
+}
+
+// newAdvertisement derives the mDNS names of a remote service.
+func newAdvertisement(s *node.Service, now time.Time) advertisement {
+	proto := "tcp"
+	for _, a := range s.Attributes {
+		if a.Key == protoAttribute && a.Value == "udp" {
+			proto = "udp"
+		}
+	}
+
+	tn := typeName(dnsserver.Label(s.Type), proto)
+
+	ttl := s.Expires.Sub(now) / time.Second
+	if ttl < 1 {
+		ttl = 1
+	} else if ttl > maxRecordTTL {
+		ttl = maxRecordTTL
+	}
+
+	return advertisement{
+		service:  *s,
+		typeName: tn,
+		instance: escape(s.Name+" @ "+s.Source) + "." + tn,
+		host:     dnsserver.Label(s.Name) + "-" + dnsserver.Label(s.Source) + "." + localDomain,
+		ttl:      uint32(ttl),
+	}
+}
+
+func header(name string, t uint16, ttl uint32) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: t, Class: dns.ClassINET, Ttl: ttl}
+}
+
+func (a *advertisement) ptr() dns.RR {
+	return &dns.PTR{Hdr: header(a.typeName, dns.TypePTR, a.ttl), Ptr: a.instance}
+}
+
+func (a *advertisement) srv() dns.RR {
+	return &dns.SRV{Hdr: header(a.instance, dns.TypeSRV, a.ttl), Port: a.service.Port, Target: a.host}
+}
+
+func (a *advertisement) txt() dns.RR {
+	txt := []string{bridgeAttribute + "=" + a.service.Source}
+
+	for _, at := range a.service.Attributes {
+		if at.Key != protoAttribute {
+			txt = append(txt, at.Key+"="+at.Value)
+		}
+	}
+
+	return &dns.TXT{Hdr: header(a.instance, dns.TypeTXT, a.ttl), Txt: txt}
+}
+
+// address returns the address records of the host for the type.
+func (a *advertisement) address(t uint16) []dns.RR {
+	ip := net.ParseIP(a.service.IP)
+	if ip == nil {
+		return nil
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		if t == dns.TypeA || t == dns.TypeANY {
+			return []dns.RR{&dns.A{Hdr: header(a.host, dns.TypeA, a.ttl), A: ip4}}
+		}
+
+		return nil
+	}
+
+	if t == dns.TypeAAAA || t == dns.TypeANY {
+		return []dns.RR{&dns.AAAA{Hdr: header(a.host, dns.TypeAAAA, a.ttl), AAAA: ip}}
+	}
+
+	return nil
+}
+
+// answer builds the response to a query from the advertised services, nil
+// if none of the questions is answered.
+func answer(q *dns.Msg, ads []advertisement) *dns.Msg {
+	m := new(dns.Msg)
+	m.Response = true
+	m.Authoritative = true
+
+	for _, qs := range q.Question {
+		name := strings.ToLower(qs.Name)
+		t := qs.Qtype
+
+		if name == serviceEnumeration && (t == dns.TypePTR || t == dns.TypeANY) {
+			types := map[string]bool{}
+
+			for i := range ads {
+				if !types[ads[i].typeName] {
+					types[ads[i].typeName] = true
+					m.Answer = append(m.Answer, &dns.PTR{
+						Hdr: header(serviceEnumeration, dns.TypePTR, ads[i].ttl),
+						Ptr: ads[i].typeName,
+					})
+				}
+			}
+
+			continue
+		}
+
+		for i := range ads {
+			a := &ads[i]
+
+			switch name {
+			case a.typeName:
+				if t == dns.TypePTR || t == dns.TypeANY {
+					m.Answer = append(m.Answer, a.ptr())
+					m.Extra = append(m.Extra, a.srv(), a.txt())
+					m.Extra = append(m.Extra, a.address(dns.TypeANY)...)
+				}
+
+			case strings.ToLower(a.instance):
+				if t == dns.TypeSRV || t == dns.TypeANY {
+					m.Answer = append(m.Answer, a.srv())
+					m.Extra = append(m.Extra, a.address(dns.TypeANY)...)
+				}
+
+				if t == dns.TypeTXT || t == dns.TypeANY {
+					m.Answer = append(m.Answer, a.txt())
+				}
+
+			case a.host:
+				m.Answer = append(m.Answer, a.address(t)...)
+			}
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		return nil
+	}
+
+	return m
+}
@@ -0,0 +1,182 @@
+package mdnsbridge
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/node"
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/miekg/dns"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rr
+}
+
+func Test_parseServiceName(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		instance string
+		typ      string
+		proto    string
+		ok       bool
+	}{
+		{"type", "_http._tcp.local.", "", "http", "tcp", true},
+		{"instance", `My\ Printer._IPP._tcp.local.`, "My Printer", "ipp", "tcp", true},
+		{"dotted instance", `a\.b._sip._udp.local`, "a.b", "sip", "udp", true},
+		{"no proto", "_http.local.", "", "", "", false},
+		{"not local", "_http._tcp.example.", "", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, typ, proto, ok := parseServiceName(tt.in)
+			if ok != tt.ok || instance != tt.instance || typ != tt.typ || proto != tt.proto {
+				t.Errorf("parseServiceName() = %q, %q, %q, %v, want %q, %q, %q, %v",
+					instance, typ, proto, ok, tt.instance, tt.typ, tt.proto, tt.ok)
+			}
+		})
+	}
+}
+
+func Test_cache_entries(t *testing.T) {
+	now := time.Now()
+	c := newCache()
+
+	for _, s := range []string{
+		`_http._tcp.local. 120 IN PTR Webcam\ 1._http._tcp.local.`,
+		`Webcam\ 1._http._tcp.local. 60 IN SRV 0 0 8080 cam.local.`,
+		`Webcam\ 1._http._tcp.local. 120 IN TXT "path=/cam"`,
+		`cam.local. 120 IN A 192.168.1.10`,
+		// unresolved instances are skipped
+		`_http._tcp.local. 120 IN PTR Other._http._tcp.local.`,
+		`_services._dns-sd._udp.local. 120 IN PTR _http._tcp.local.`,
+	} {
+		c.add(mustRR(t, s), now)
+	}
+
+	want := []Entry{
+		{
+			Instance: "Webcam 1",
+			Type:     "http",
+			Proto:    "tcp",
+			IP:       net.ParseIP("192.168.1.10").To4(),
+			Port:     8080,
+			TXT:      []string{"path=/cam"},
+			Expires:  now.Add(60 * time.Second),
+		},
+	}
+
+	if got := c.entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("entries() = %v, want %v", got, want)
+	}
+
+	if got := c.types(); !reflect.DeepEqual(got, []string{"_http._tcp.local."}) {
+		t.Errorf("types() = %v", got)
+	}
+
+	// the goodbye packet removes the instance
+	c.add(mustRR(t, `_http._tcp.local. 0 IN PTR Webcam\ 1._http._tcp.local.`), now)
+	if got := c.entries(); len(got) != 0 {
+		t.Errorf("entries() after goodbye = %v", got)
+	}
+
+	c.add(mustRR(t, `_http._tcp.local. 120 IN PTR Webcam\ 1._http._tcp.local.`), now)
+	c.expire(now.Add(61 * time.Second))
+	if got := c.entries(); len(got) != 0 {
+		t.Errorf("entries() after expiry = %v", got)
+	}
+}
+
+func Test_answer(t *testing.T) {
+	now := time.Now()
+	ad := newAdvertisement(&node.Service{
+		Source: "OE1XYZ",
+		Name:   "Webcam",
+		Type:   "http",
+		IP:     "44.143.1.2",
+		Port:   8080,
+		Attributes: []protocol.ServiceAttribute{
+			{Key: "path", Value: "/cam"},
+		},
+		Expires: now.Add(100 * time.Second),
+	}, now)
+
+	tests := []struct {
+		name   string
+		qname  string
+		qtype  uint16
+		answer []string
+		extra  int
+	}{
+		{
+			name:   "browse",
+			qname:  "_http._tcp.local.",
+			qtype:  dns.TypePTR,
+			answer: []string{"_http._tcp.local.\t100\tIN\tPTR\tWebcam\\ \\@\\ OE1XYZ._http._tcp.local."},
+			extra:  3,
+		},
+		{
+			name:   "enumerate",
+			qname:  "_services._dns-sd._udp.local.",
+			qtype:  dns.TypePTR,
+			answer: []string{"_services._dns-sd._udp.local.\t100\tIN\tPTR\t_http._tcp.local."},
+		},
+		{
+			name:   "txt",
+			qname:  "webcam\\ \\@\\ oe1xyz._http._tcp.local.",
+			qtype:  dns.TypeTXT,
+			answer: []string{"Webcam\\ \\@\\ OE1XYZ._http._tcp.local.\t100\tIN\tTXT\t\"hamgo=OE1XYZ\" \"path=/cam\""},
+		},
+		{
+			name:   "host",
+			qname:  "webcam-oe1xyz.local.",
+			qtype:  dns.TypeA,
+			answer: []string{"webcam-oe1xyz.local.\t100\tIN\tA\t44.143.1.2"},
+		},
+		{
+			name:  "other type",
+			qname: "_ipp._tcp.local.",
+			qtype: dns.TypePTR,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := new(dns.Msg)
+			q.SetQuestion(tt.qname, tt.qtype)
+
+			m := answer(q, []advertisement{ad})
+			if tt.answer == nil {
+				if m != nil {
+					t.Errorf("answer() = %v, want nil", m)
+				}
+				return
+			}
+
+			if m == nil {
+				t.Fatal("answer() = nil")
+			}
+
+			got := []string{}
+			for _, rr := range m.Answer {
+				got = append(got, rr.String())
+			}
+
+			if !reflect.DeepEqual(got, tt.answer) {
+				t.Errorf("answer = %q, want %q", got, tt.answer)
+			}
+
+			if len(m.Extra) != tt.extra {
+				t.Errorf("extra = %v, want %v records", m.Extra, tt.extra)
+			}
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+// ACL lists.
+const (
+	ACLAllowCallsigns = "allowCallsigns"
+	ACLDenyCallsigns  = "denyCallsigns"
+	ACLAllowPeers     = "allowPeers"
+	ACLDenyPeers      = "denyPeers"
+	ACLAllowNets      = "allowNets"
+	ACLDenyNets       = "denyNets"
+)
+
+// ACLStatus contains the counters of the access control lists.
+type ACLStatus struct {
+	DroppedMessages     uint64 `json:"droppedMessages"`
+	RejectedPeers       uint64 `json:"rejectedPeers"`
+	RejectedConnections uint64 `json:"rejectedConnections"`
+}
+
+// ACL stores the callsign, peer and address access control lists. The rules
+// can be changed at runtime, onChange is called after every change.
+type ACL struct {
+	rules     parameters.ACLSettings
+	allowNets []*net.IPNet
+	denyNets  []*net.IPNet
+	status    ACLStatus
+	onChange  func()
+	lock      sync.RWMutex
+}
+
+// NewACL creates the access control lists from the settings.
+func NewACL(rules parameters.ACLSettings) (*ACL, error) {
+	a := &ACL{}
+
+	if err := a.SetRules(rules); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// parseNets parses a list of CIDR networks, single addresses are accepted as well.
+func parseNets(list []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, v := range list {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", v)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", v)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// normalizeCallsigns upper cases and trims the callsign patterns.
+func normalizeCallsigns(list []string) []string {
+	res := []string{}
+
+	for _, v := range list {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// SetRules replaces all rules.
+func (a *ACL) SetRules(rules parameters.ACLSettings) error {
+	allow, err := parseNets(rules.AllowNets)
+	if err != nil {
+		return err
+	}
+
+	deny, err := parseNets(rules.DenyNets)
+	if err != nil {
+		return err
+	}
+
+	rules.AllowCallsigns = normalizeCallsigns(rules.AllowCallsigns)
+	rules.DenyCallsigns = normalizeCallsigns(rules.DenyCallsigns)
+	rules.AllowPeers = normalizeCallsigns(rules.AllowPeers)
+	rules.DenyPeers = normalizeCallsigns(rules.DenyPeers)
+
+	if rules.AllowNets == nil {
+		rules.AllowNets = []string{}
+	}
+
+	if rules.DenyNets == nil {
+		rules.DenyNets = []string{}
+	}
+
+	a.lock.Lock()
+	a.rules = rules
+	a.allowNets = allow
+	a.denyNets = deny
+	onChange := a.onChange
+	a.lock.Unlock()
+
+	if onChange != nil {
+		onChange()
+	}
+
+	return nil
+}
+
+// Rules returns a copy of the current rules.
+func (a *ACL) Rules() parameters.ACLSettings {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	r := a.rules
+	r.AllowCallsigns = append([]string{}, r.AllowCallsigns...)
+	r.DenyCallsigns = append([]string{}, r.DenyCallsigns...)
+	r.AllowPeers = append([]string{}, r.AllowPeers...)
+	r.DenyPeers = append([]string{}, r.DenyPeers...)
+	r.AllowNets = append([]string{}, r.AllowNets...)
+	r.DenyNets = append([]string{}, r.DenyNets...)
+
+	return r
+}
+
+// listByName returns a pointer to the named list of the rules.
+func listByName(r *parameters.ACLSettings, list string) (*[]string, error) {
+	switch list {
+	case ACLAllowCallsigns:
+		return &r.AllowCallsigns, nil
+	case ACLDenyCallsigns:
+		return &r.DenyCallsigns, nil
+	case ACLAllowPeers:
+		return &r.AllowPeers, nil
+	case ACLDenyPeers:
+		return &r.DenyPeers, nil
+	case ACLAllowNets:
+		return &r.AllowNets, nil
+	case ACLDenyNets:
+		return &r.DenyNets, nil
+	}
+
+	return nil, fmt.Errorf("unknown list %q", list)
+}
+
+// Add adds an entry to the named list.
+func (a *ACL) Add(list string, entry string) error {
+	r := a.Rules()
+
+	l, err := listByName(&r, list)
+	if err != nil {
+		return err
+	}
+
+	*l = append(*l, entry)
+	return a.SetRules(r)
+}
+
+// Remove removes an entry from the named list.
+func (a *ACL) Remove(list string, entry string) error {
+	r := a.Rules()
+
+	l, err := listByName(&r, list)
+	if err != nil {
+		return err
+	}
+
+	var res []string
+	found := false
+
+	for _, v := range *l {
+		if strings.EqualFold(v, entry) {
+			found = true
+			continue
+		}
+
+		res = append(res, v)
+	}
+
+	if !found {
+		return errors.New("entry not found")
+	}
+
+	*l = res
+	return a.SetRules(r)
+}
+
+// wildcardMatch matches a pattern with * and ? wildcards.
+func wildcardMatch(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+
+	return len(s) == 0
+}
+
+// matchCallsign matches a callsign against a pattern. A pattern without an
+// SSID matches the callsign with any SSID.
+func matchCallsign(pattern string, call string) bool {
+	if wildcardMatch(pattern, call) {
+		return true
+	}
+
+	if strings.Contains(pattern, "-") {
+		return false
+	}
+
+	if i := strings.LastIndex(call, "-"); i != -1 {
+		return wildcardMatch(pattern, call[:i])
+	}
+
+	return false
+}
+
+func matchCallsigns(patterns []string, call string) bool {
+	for _, p := range patterns {
+		if matchCallsign(p, call) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowCallsign checks if messages of the callsign are accepted.
+func (a *ACL) AllowCallsign(call string) bool {
+	call = strings.ToUpper(call)
+
+	a.lock.RLock()
+	allowed := !matchCallsigns(a.rules.DenyCallsigns, call) &&
+		(len(a.rules.AllowCallsigns) == 0 || matchCallsigns(a.rules.AllowCallsigns, call))
+	a.lock.RUnlock()
+
+	if !allowed {
+		a.lock.Lock()
+		a.status.DroppedMessages++
+		a.lock.Unlock()
+	}
+
+	return allowed
+}
+
+// AllowPeer checks if a peer announcing the identity is accepted. The peer
+// lists are independent of the callsign lists, which only match sources.
+func (a *ACL) AllowPeer(identity string) bool {
+	identity = strings.ToUpper(identity)
+
+	a.lock.RLock()
+	allowed := !matchCallsigns(a.rules.DenyPeers, identity) &&
+		(len(a.rules.AllowPeers) == 0 || matchCallsigns(a.rules.AllowPeers, identity))
+	a.lock.RUnlock()
+
+	if !allowed {
+		a.lock.Lock()
+		a.status.RejectedPeers++
+		a.lock.Unlock()
+	}
+
+	return allowed
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AllowAddr checks if a connection from the remote address is accepted.
+func (a *ACL) AllowAddr(addr net.Addr) bool {
+	var ip net.IP
+
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		ip = v.IP
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err == nil {
+			ip = net.ParseIP(host)
+		}
+	}
+
+	a.lock.RLock()
+	allowed := ip != nil && !containsIP(a.denyNets, ip) &&
+		(len(a.allowNets) == 0 || containsIP(a.allowNets, ip))
+	a.lock.RUnlock()
+
+	if !allowed {
+		a.lock.Lock()
+		a.status.RejectedConnections++
+		a.lock.Unlock()
+	}
+
+	return allowed
+}
+
+// Status returns the counters of the access control lists.
+func (a *ACL) Status() ACLStatus {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	return a.status
+}
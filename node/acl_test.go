@@ -0,0 +1,168 @@
+package node
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+func Test_matchCallsign(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		call    string
+		want    bool
+	}{
+		{"exact", "OE1AAA", "OE1AAA", true},
+		{"other", "OE1AAA", "OE1AAB", false},
+		{"any SSID", "OE1AAA", "OE1AAA-7", true},
+		{"SSID", "OE1AAA-7", "OE1AAA-7", true},
+		{"other SSID", "OE1AAA-7", "OE1AAA-9", false},
+		{"SSID without SSID", "OE1AAA-7", "OE1AAA", false},
+		{"prefix wildcard", "OE1*", "OE1AAA-1", true},
+		{"prefix wildcard other", "OE1*", "OE3AAA", false},
+		{"single wildcard", "OE?AAA", "OE5AAA", true},
+		{"single wildcard too short", "OE?AAA", "OEAAA", false},
+		{"wildcard SSID", "OE1AAA-*", "OE1AAA-12", true},
+		{"wildcard SSID without SSID", "OE1AAA-*", "OE1AAA", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchCallsign(tt.pattern, tt.call); got != tt.want {
+				t.Errorf("matchCallsign(%q, %q) = %v, want %v", tt.pattern, tt.call, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACL_Allow(t *testing.T) {
+	acl, err := NewACL(parameters.ACLSettings{
+		AllowCallsigns: []string{"oe*"},
+		DenyCallsigns:  []string{"OE1BAD"},
+		DenyPeers:      []string{"OE1EVL-*"},
+		AllowNets:      []string{"44.0.0.0/8", "2001:db8::/32"},
+		DenyNets:       []string{"44.143.0.0/16", "44.1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("NewACL() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		check func() bool
+		want  bool
+	}{
+		{"allowed callsign", func() bool { return acl.AllowCallsign("oe3aaa-1") }, true},
+		{"callsign not allowed", func() bool { return acl.AllowCallsign("DL1AAA") }, false},
+		{"denied callsign", func() bool { return acl.AllowCallsign("OE1BAD-5") }, false},
+		{"denied callsign as peer", func() bool { return acl.AllowPeer("OE1BAD") }, true},
+		{"peer not in callsign allow list", func() bool { return acl.AllowPeer("DL1AAA") }, true},
+		{"denied peer SSID", func() bool { return acl.AllowPeer("OE1EVL-2") }, false},
+		{"peer without SSID", func() bool { return acl.AllowPeer("OE1EVL") }, true},
+		{"denied peer as source", func() bool { return acl.AllowCallsign("OE1EVL-2") }, true},
+		{"allowed network", func() bool { return acl.AllowAddr(&net.TCPAddr{IP: net.ParseIP("44.1.0.1")}) }, true},
+		{"denied network", func() bool { return acl.AllowAddr(&net.TCPAddr{IP: net.ParseIP("44.143.7.1")}) }, false},
+		{"denied address", func() bool { return acl.AllowAddr(&net.TCPAddr{IP: net.ParseIP("44.1.2.3")}) }, false},
+		{"network not allowed", func() bool { return acl.AllowAddr(&net.TCPAddr{IP: net.ParseIP("10.0.0.1")}) }, false},
+		{"allowed IPv6 network", func() bool { return acl.AllowAddr(&net.TCPAddr{IP: net.ParseIP("2001:db8::1")}) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.check(); got != tt.want {
+				t.Errorf("allowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACL_SetRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		entry   string
+		wantErr bool
+	}{
+		{"callsign", ACLDenyCallsigns, "OE1AAA", false},
+		{"peer", ACLAllowPeers, "OE1*", false},
+		{"network", ACLAllowNets, "44.0.0.0/8", false},
+		{"address", ACLDenyNets, "2001:db8::1", false},
+		{"invalid network", ACLDenyNets, "44.0.0.0/33", true},
+		{"unknown list", "denyAll", "OE1AAA", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, _ := NewACL(parameters.ACLSettings{})
+
+			changed := 0
+			acl.onChange = func() { changed++ }
+
+			err := acl.Add(tt.list, tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if changed != 0 {
+					t.Error("onChange called for a rejected change")
+				}
+
+				return
+			}
+
+			if changed != 1 {
+				t.Errorf("onChange called %d times, want 1", changed)
+			}
+
+			if err := acl.Remove(tt.list, tt.entry); err != nil {
+				t.Errorf("Remove() error = %v", err)
+			}
+
+			if err := acl.Remove(tt.list, tt.entry); err == nil {
+				t.Error("Remove() of a missing entry succeeded")
+			}
+		})
+	}
+}
+
+func TestNode_ACLChange(t *testing.T) {
+	tests := []struct {
+		name  string
+		list  string
+		entry string
+	}{
+		{"denied network", ACLDenyNets, "127.0.0.0/8"},
+		{"network not allowed", ACLAllowNets, "44.0.0.0/8"},
+		{"denied peer", ACLDenyPeers, "OE1BBB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			a := testNode(t, ctx, "OE1AAA")
+			b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+
+			waitFor(t, 5*time.Second, "peers to connect", func() bool {
+				return connected(a) && connected(b)
+			})
+
+			if err := a.ACL().Add(tt.list, tt.entry); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			waitFor(t, 5*time.Second, "denied link to close", func() bool {
+				return len(a.PeerStatus()) == 0
+			})
+
+			// the reconnects of b are rejected as well
+			time.Sleep(300 * time.Millisecond)
+
+			if connected(a) || connected(b) {
+				t.Error("denied peer reconnected")
+			}
+		})
+	}
+}
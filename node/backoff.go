@@ -0,0 +1,145 @@
+package node
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+// Default values for the reconnect backoff.
+const (
+	backoffDefaultInitial    = 5
+	backoffDefaultMax        = 300
+	backoffDefaultMultiplier = 2
+	backoffDefaultJitter     = 0.25
+	backoffDefaultStable     = 30
+)
+
+// backoff implements an exponential backoff with jitter for reconnect attempts.
+type backoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	jitter     float64
+	stable     time.Duration
+	failures   uint
+	next       time.Time
+	rnd        *rand.Rand
+	lock       sync.Mutex
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// newBackoff creates a new backoff from the node settings and fills in defaults.
+func newBackoff(settings parameters.Settings) *backoff {
+	s := settings.Backoff
+
+	if s.Initial <= 0 {
+		s.Initial = float64(settings.ReconnectTimeout)
+	}
+
+	if s.Initial <= 0 {
+		s.Initial = backoffDefaultInitial
+	}
+
+	if s.Max <= 0 {
+		s.Max = backoffDefaultMax
+	}
+
+	if s.Max < s.Initial {
+		s.Max = s.Initial
+	}
+
+	if s.Multiplier < 1 {
+		s.Multiplier = backoffDefaultMultiplier
+	}
+
+	if s.Jitter == 0 {
+		s.Jitter = backoffDefaultJitter
+	}
+
+	if s.Jitter < 0 {
+		s.Jitter = 0
+	}
+
+	if s.Jitter > 1 {
+		s.Jitter = 1
+	}
+
+	if s.Stable <= 0 {
+		s.Stable = backoffDefaultStable
+	}
+
+	return &backoff{
+		initial:    seconds(s.Initial),
+		max:        seconds(s.Max),
+		multiplier: s.Multiplier,
+		jitter:     s.Jitter,
+		stable:     seconds(s.Stable),
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Next returns the delay until the next attempt and remembers the time of the attempt.
+func (b *backoff) Next() time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	d := float64(b.initial) * math.Pow(b.multiplier, float64(b.failures))
+	if d > float64(b.max) {
+		d = float64(b.max)
+	}
+
+	// spread the delay uniformly over [d*(1-jitter), d*(1+jitter)]
+	if b.jitter > 0 {
+		d += d * b.jitter * (2*b.rnd.Float64() - 1)
+	}
+
+	delay := time.Duration(d)
+	b.next = time.Now().Add(delay)
+
+	return delay
+}
+
+// Failure records a failed attempt.
+func (b *backoff) Failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures++
+	b.next = time.Time{}
+}
+
+// Connected clears the pending attempt after a successful connect.
+func (b *backoff) Connected() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.next = time.Time{}
+}
+
+// Disconnected resets the backoff if the connection was up long enough,
+// a connection that dropped earlier counts as a failed attempt.
+func (b *backoff) Disconnected(up time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if up >= b.stable {
+		b.failures = 0
+	} else {
+		b.failures++
+	}
+}
+
+// State returns the number of consecutive failures and the time of the next attempt.
+func (b *backoff) State() (uint, time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.failures, b.next
+}
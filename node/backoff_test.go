@@ -0,0 +1,118 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+func Test_backoff_Next(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings parameters.Settings
+		failures uint
+		want     time.Duration
+	}{
+		{"defaults", parameters.Settings{Backoff: parameters.BackoffSettings{Jitter: -1}}, 0, 5 * time.Second},
+		{"reconnect timeout", parameters.Settings{ReconnectTimeout: 2, Backoff: parameters.BackoffSettings{Jitter: -1}}, 0, 2 * time.Second},
+		{"exponential", parameters.Settings{Backoff: parameters.BackoffSettings{Initial: 1, Jitter: -1}}, 3, 8 * time.Second},
+		{"multiplier", parameters.Settings{Backoff: parameters.BackoffSettings{Initial: 1, Multiplier: 3, Jitter: -1}}, 2, 9 * time.Second},
+		{"capped", parameters.Settings{Backoff: parameters.BackoffSettings{Initial: 1, Max: 10, Jitter: -1}}, 10, 10 * time.Second},
+		{"max below initial", parameters.Settings{Backoff: parameters.BackoffSettings{Initial: 4, Max: 1, Jitter: -1}}, 1, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackoff(tt.settings)
+
+			for i := uint(0); i < tt.failures; i++ {
+				b.Failure()
+			}
+
+			if got := b.Next(); got != tt.want {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+
+			if failures, next := b.State(); failures != tt.failures || next.IsZero() {
+				t.Errorf("State() = %d, %v", failures, next)
+			}
+		})
+	}
+}
+
+func Test_backoff_jitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter float64
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"default", 0, 750 * time.Millisecond, 1250 * time.Millisecond},
+		{"half", 0.5, 500 * time.Millisecond, 1500 * time.Millisecond},
+		{"clamped", 2, 0, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackoff(parameters.Settings{Backoff: parameters.BackoffSettings{Initial: 1, Jitter: tt.jitter}})
+
+			spread := false
+			first := b.Next()
+
+			for i := 0; i < 100; i++ {
+				d := b.Next()
+				if d < tt.min || d > tt.max {
+					t.Fatalf("Next() = %v, want within [%v, %v]", d, tt.min, tt.max)
+				}
+
+				spread = spread || d != first
+			}
+
+			if !spread {
+				t.Error("Next() without jitter")
+			}
+		})
+	}
+}
+
+func Test_backoff_Disconnected(t *testing.T) {
+	tests := []struct {
+		name string
+		up   time.Duration
+		want uint
+	}{
+		{"short connection", 10 * time.Second, 4},
+		{"stable connection", 30 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackoff(parameters.Settings{})
+
+			for i := 0; i < 3; i++ {
+				b.Failure()
+			}
+
+			b.Next()
+			b.Connected()
+			b.Disconnected(tt.up)
+
+			if failures, next := b.State(); failures != tt.want || !next.IsZero() {
+				t.Errorf("State() = %d, %v, want %d", failures, next, tt.want)
+			}
+		})
+	}
+}
+
+func Test_backoff_shortConnections(t *testing.T) {
+	b := newBackoff(parameters.Settings{Backoff: parameters.BackoffSettings{Initial: 1, Max: 60, Jitter: -1}})
+
+	// a hub that accepts and drops every connection at once
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second}
+	for i, w := range want {
+		if got := b.Next(); got != w {
+			t.Errorf("attempt %d: Next() = %v, want %v", i, got, w)
+		}
+
+		b.Connected()
+		b.Disconnected(time.Millisecond)
+	}
+}
@@ -0,0 +1,285 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// directoryDefaultMaxStations is the default size of the station directory.
+const directoryDefaultMaxStations = 4096
+
+// Station is a directory entry built from the CQ messages of a callsign.
+type Station struct {
+	Callsign string               `json:"callsign"`
+	Type     protocol.ContactType `json:"type"`
+	IPs      []string             `json:"ips"`
+	Message  string               `json:"message"`
+	// Position sent with the latest CQ message
+	Position *protocol.Position `json:"position,omitempty"`
+	// Distance in km to the reference position of the query
+	Distance *float64 `json:"distance,omitempty"`
+	Sequence uint64   `json:"sequence"`
+	// FirstSeen is the time the station was first heard
+	FirstSeen time.Time `json:"firstSeen"`
+	// LastSeen is the time of the latest CQ message of the station
+	LastSeen time.Time `json:"lastSeen"`
+	// Hops between the station and the local node, 0 for local stations
+	Hops int `json:"hops"`
+	// Path the latest CQ message was heard through, starting at the originating node
+	Path []string `json:"path"`
+}
+
+// Station sort keys.
+const (
+	StationSortCallsign  = "callsign"
+	StationSortFirstSeen = "firstSeen"
+	StationSortLastSeen  = "lastSeen"
+	StationSortHops      = "hops"
+	StationSortDistance  = "distance"
+)
+
+// StationQuery selects and orders the directory entries.
+type StationQuery struct {
+	// Search matches callsigns and messages case-insensitively
+	Search string
+	// Sort is one of the station sort keys, defaults to the callsign
+	Sort string
+	Desc bool
+	// Near is the reference position of the distances, defaults to the
+	// position of the local station
+	Near *protocol.Position
+	// Within limits the distance to the reference in km, 0 for no limit
+	Within float64
+}
+
+// directory folds the CQ messages into one entry per callsign.
+type directory struct {
+	local       string
+	maxStations int
+	stations    map[string]*Station
+	now         func() time.Time
+	lock        sync.Mutex
+}
+
+func newDirectory(local string, s parameters.DirectorySettings) *directory {
+	max := int(s.MaxStations)
+	if max <= 0 {
+		max = directoryDefaultMaxStations
+	}
+
+	return &directory{
+		local:       strings.ToUpper(local),
+		maxStations: max,
+		stations:    make(map[string]*Station),
+		now:         time.Now,
+	}
+}
+
+// contactIPs converts the addresses of a contact to strings.
+func contactIPs(c *protocol.Contact) []string {
+	ips := []string{}
+
+	for _, ip := range c.IPs {
+		if len(ip.Data) == net.IPv4len || len(ip.Data) == net.IPv6len {
+			ips = append(ips, net.IP(ip.Data).String())
+		}
+	}
+
+	return ips
+}
+
+// update folds a CQ message into the directory, messages with an older
+// sequence number than the entry are ignored. The updated entry is returned.
+func (d *directory) update(msg *protocol.Message) (Station, bool) {
+	if msg.PayloadType != protocol.PayloadCQ || len(msg.Source.Callsign) == 0 {
+		return Station{}, false
+	}
+
+	cq, err := protocol.ParseCQPayload(msg.Payload)
+	if err != nil {
+		logrus.WithError(err).Warn("Node: failed to parse CQ message")
+		return Station{}, false
+	}
+
+	call := strings.ToUpper(string(msg.Source.Callsign))
+	now := d.now()
+
+	// the local node is not part of the path the message was heard through
+	path := []string{}
+	for _, s := range pathSegments(strings.ToUpper(msg.Path)) {
+		if s != d.local {
+			path = append(path, s)
+		}
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	s, ok := d.stations[call]
+	if ok && msg.SeqCounter <= s.Sequence {
+		return Station{}, false
+	}
+
+	if !ok {
+		if len(d.stations) >= d.maxStations {
+			d.evict()
+		}
+
+		s = &Station{
+			Callsign:  call,
+			FirstSeen: now,
+		}
+		d.stations[call] = s
+	}
+
+	s.Type = msg.Source.Type
+	s.IPs = contactIPs(&msg.Source)
+	s.Message = cq.Message
+	s.Position = cq.Position
+	s.Sequence = msg.SeqCounter
+	s.LastSeen = now
+	s.Hops = len(path)
+	s.Path = path
+
+	return copyStation(s), true
+}
+
+// evict removes the station heard least recently, the lock must be held.
+func (d *directory) evict() {
+	var oldest *Station
+
+	for _, s := range d.stations {
+		if oldest == nil || s.LastSeen.Before(oldest.LastSeen) {
+			oldest = s
+		}
+	}
+
+	if oldest != nil {
+		delete(d.stations, oldest.Callsign)
+	}
+}
+
+// copyStation returns a copy that does not share the slices of the entry.
+func copyStation(s *Station) Station {
+	c := *s
+	c.IPs = append([]string{}, s.IPs...)
+	c.Path = append([]string{}, s.Path...)
+
+	if s.Position != nil {
+		p := *s.Position
+		c.Position = &p
+	}
+
+	return c
+}
+
+// get returns the entry of a callsign.
+func (d *directory) get(call string) (Station, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	s, ok := d.stations[strings.ToUpper(call)]
+	if !ok {
+		return Station{}, false
+	}
+
+	return copyStation(s), true
+}
+
+// stationLess returns the ordering function of a sort key.
+func stationLess(key string) (func(a, b *Station) bool, error) {
+	switch key {
+	case "", StationSortCallsign:
+		return func(a, b *Station) bool { return a.Callsign < b.Callsign }, nil
+	case StationSortFirstSeen:
+		return func(a, b *Station) bool { return a.FirstSeen.Before(b.FirstSeen) }, nil
+	case StationSortLastSeen:
+		return func(a, b *Station) bool { return a.LastSeen.Before(b.LastSeen) }, nil
+	case StationSortHops:
+		return func(a, b *Station) bool { return a.Hops < b.Hops }, nil
+	case StationSortDistance:
+		// stations without a position are the farthest
+		return func(a, b *Station) bool {
+			return a.Distance != nil && (b.Distance == nil || *a.Distance < *b.Distance)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown sort key %q", key)
+}
+
+// query returns the matching entries in order.
+func (d *directory) query(q StationQuery) ([]Station, error) {
+	less, err := stationLess(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Near == nil && (q.Within > 0 || q.Sort == StationSortDistance) {
+		return nil, errors.New("reference position required")
+	}
+
+	search := strings.ToUpper(q.Search)
+	res := []Station{}
+
+	d.lock.Lock()
+	for _, s := range d.stations {
+		if search != "" && !strings.Contains(s.Callsign, search) &&
+			!strings.Contains(strings.ToUpper(s.Message), search) {
+			continue
+		}
+
+		c := copyStation(s)
+
+		if q.Near != nil && c.Position != nil {
+			dist := q.Near.Distance(c.Position)
+			c.Distance = &dist
+		}
+
+		if q.Within > 0 && (c.Distance == nil || *c.Distance > q.Within) {
+			continue
+		}
+
+		res = append(res, c)
+	}
+	d.lock.Unlock()
+
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := &res[i], &res[j]
+		if q.Desc {
+			a, b = b, a
+		}
+
+		if less(a, b) {
+			return true
+		}
+
+		// ties are ordered by callsign
+		return !less(b, a) && res[i].Callsign < res[j].Callsign
+	})
+
+	return res, nil
+}
+
+// Stations returns the station directory entries matching the query.
+func (n *Node) Stations(q StationQuery) ([]Station, error) {
+	if q.Near == nil {
+		q.Near = n.position
+	}
+
+	return n.directory.query(q)
+}
+
+// Station returns the directory entry of a callsign.
+func (n *Node) Station(call string) (Station, bool) {
+	return n.directory.get(call)
+}
@@ -0,0 +1,195 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func cqMessage(call string, seq uint64, path string, text string) *protocol.Message {
+	return &protocol.Message{
+		SeqCounter:  seq,
+		PayloadType: protocol.PayloadCQ,
+		Path:        path,
+		Source: protocol.Contact{
+			Type:      protocol.ContactTypeUser,
+			Callsign:  []byte(call),
+			NumberIPs: 1,
+			IPs:       []protocol.ContactIP{{Type: protocol.ContactIPv4, Length: 4, Data: []byte{44, 143, 0, 1}}},
+		},
+		Payload: []byte(text),
+	}
+}
+
+func TestDirectory(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d := newDirectory("OE1AAA", parameters.DirectorySettings{MaxStations: 3})
+	d.now = func() time.Time { return now }
+
+	d.update(cqMessage("oe1xyz", 2, ";OE1CCC;OE1BBB", "hello vienna"))
+
+	now = now.Add(time.Minute)
+	d.update(cqMessage("OE1XYZ", 1, ";OE1BBB", "older"))
+	d.update(cqMessage("OE3DEF", 1, "", "local user"))
+
+	// debug messages are not folded into the directory
+	dbg := cqMessage("OE5GHI", 1, "", "debug")
+	dbg.PayloadType = protocol.PayloadDebug
+	d.update(dbg)
+
+	s, ok := d.get("oe1xyz")
+	if !ok {
+		t.Fatal("get() did not find the station")
+	}
+
+	if s.Message != "hello vienna" || s.Hops != 2 || s.Path[0] != "OE1CCC" || s.IPs[0] != "44.143.0.1" {
+		t.Errorf("older sequence replaced the entry: %+v", s)
+	}
+
+	now = now.Add(time.Minute)
+	d.update(cqMessage("OE1XYZ", 3, ";OE1BBB;OE1AAA", "newer"))
+
+	s, _ = d.get("OE1XYZ")
+	if s.Message != "newer" || s.Hops != 1 || !s.LastSeen.Equal(now) || s.FirstSeen.Equal(now) {
+		t.Errorf("newer sequence did not replace the entry: %+v", s)
+	}
+
+	tests := []struct {
+		name    string
+		query   StationQuery
+		want    []string
+		wantErr bool
+	}{
+		{name: "default order", want: []string{"OE1XYZ", "OE3DEF"}},
+		{name: "search callsign", query: StationQuery{Search: "oe3"}, want: []string{"OE3DEF"}},
+		{name: "search message", query: StationQuery{Search: "NEWER"}, want: []string{"OE1XYZ"}},
+		{name: "hops", query: StationQuery{Sort: StationSortHops}, want: []string{"OE3DEF", "OE1XYZ"}},
+		{name: "last seen desc", query: StationQuery{Sort: StationSortLastSeen, Desc: true}, want: []string{"OE1XYZ", "OE3DEF"}},
+		{name: "unknown sort", query: StationQuery{Sort: "age"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.query(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("query() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("query() = %+v, want %v", got, tt.want)
+			}
+
+			for i, c := range tt.want {
+				if got[i].Callsign != c {
+					t.Errorf("query()[%d] = %s, want %s", i, got[i].Callsign, c)
+				}
+			}
+		})
+	}
+
+	// the station heard least recently is evicted
+	d.update(cqMessage("OE5GHI", 1, "", "a"))
+	d.update(cqMessage("OE6JKL", 1, "", "b"))
+
+	if _, ok := d.get("OE3DEF"); ok {
+		t.Error("oldest station was not evicted")
+	}
+}
+
+func TestDirectory_distance(t *testing.T) {
+	d := newDirectory("OE1AAA", parameters.DirectorySettings{})
+
+	for _, s := range []struct {
+		call string
+		pos  *protocol.Position
+	}{
+		{"OE1XYZ", &protocol.Position{Locator: "JN88ee", Lat: 48.1875, Lon: 16.375}},
+		{"OE6ABC", &protocol.Position{Locator: "JN77", Lat: 47.5, Lon: 15}},
+		{"OE9XYZ", nil},
+	} {
+		cq := protocol.CQPayload{Message: "cq", Position: s.pos}
+		d.update(cqMessage(s.call, 1, "", string(cq.Bytes())))
+	}
+
+	s, _ := d.get("OE1XYZ")
+	if s.Message != "cq" || s.Position == nil || s.Position.Locator != "JN88ee" {
+		t.Errorf("position not taken from the CQ message: %+v", s)
+	}
+
+	near := &protocol.Position{Lat: 48.5, Lon: 17}
+
+	tests := []struct {
+		name    string
+		query   StationQuery
+		want    []string
+		wantErr bool
+	}{
+		{name: "sorted by distance", query: StationQuery{Near: near, Sort: StationSortDistance}, want: []string{"OE1XYZ", "OE6ABC", "OE9XYZ"}},
+		{name: "farthest first", query: StationQuery{Near: near, Sort: StationSortDistance, Desc: true}, want: []string{"OE9XYZ", "OE6ABC", "OE1XYZ"}},
+		{name: "within", query: StationQuery{Near: near, Within: 100}, want: []string{"OE1XYZ"}},
+		{name: "within and search", query: StationQuery{Near: near, Within: 500, Search: "OE6"}, want: []string{"OE6ABC"}},
+		{name: "no reference", query: StationQuery{Within: 100}, wantErr: true},
+		{name: "no reference to sort", query: StationQuery{Sort: StationSortDistance}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.query(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("query() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("query() = %+v, want %v", got, tt.want)
+			}
+
+			for i, c := range tt.want {
+				if got[i].Callsign != c {
+					t.Errorf("query()[%d] = %s, want %s", i, got[i].Callsign, c)
+				}
+
+				if (got[i].Distance == nil) != (got[i].Position == nil) {
+					t.Errorf("query()[%d] distance = %v, position = %v", i, got[i].Distance, got[i].Position)
+				}
+			}
+		})
+	}
+}
+
+func TestNode_positions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := NewNode(ctx, parameters.Settings{}, parameters.Station{Callsign: "OE1AAA", Locator: "XX00"}); err == nil {
+		t.Error("NewNode() accepted an invalid locator")
+	}
+
+	n, err := NewNode(ctx, parameters.Settings{}, parameters.Station{Callsign: "OE1AAA", Locator: "JN88"})
+	if err != nil {
+		t.Fatalf("NewNode() error = %v", err)
+	}
+
+	if p := n.Position(); p == nil || p.Lat != 48.5 || p.Lon != 17 {
+		t.Errorf("Position() = %+v", p)
+	}
+
+	cq := protocol.CQPayload{Message: "cq", Position: &protocol.Position{Locator: "JN77", Lat: 47.5, Lon: 15}}
+	msg := cqMessage("OE6ABC", 1, ";OE6ABC", string(cq.Bytes()))
+
+	n.topology.observe(msg.Path)
+	n.indexMessage(msg)
+
+	// the distances default to the local station
+	st, err := n.Stations(StationQuery{Within: 200})
+	if err != nil || len(st) != 1 || st[0].Distance == nil {
+		t.Errorf("Stations() = %+v, %v", st, err)
+	}
+
+	for _, tn := range n.Topology().Nodes {
+		if tn.Position == nil {
+			t.Errorf("topology node %s has no position", tn.Callsign)
+		}
+	}
+}
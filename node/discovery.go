@@ -0,0 +1,380 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Default values for the service discovery.
+const (
+	discoveryDefaultTTL     = 4
+	discoveryDefaultTimeout = 3
+)
+
+// discoverySeenSize is the number of queries remembered to answer them only once.
+const discoverySeenSize = 256
+
+// ServiceQuery selects the services to discover. Zero values are taken from
+// the node settings.
+type ServiceQuery struct {
+	// Type of the services, empty for all types
+	Type string
+	// Name pattern of the services, * and ? are supported, empty for all names
+	Name string
+	// TTL limits the hops the query is flooded
+	TTL uint8
+	// Timeout of the window the replies are collected in
+	Timeout time.Duration
+}
+
+// discovery tracks the pending and answered service queries.
+type discovery struct {
+	seq     uint64
+	pending map[uint64]chan []protocol.ServiceRecord
+	seen    map[receiptKey]bool
+	order   []receiptKey
+	lock    sync.Mutex
+}
+
+func newDiscovery() *discovery {
+	return &discovery{
+		// the sequence numbers of the queries must not repeat across restarts
+		seq:     uint64(time.Now().UnixNano()),
+		pending: make(map[uint64]chan []protocol.ServiceRecord),
+		seen:    make(map[receiptKey]bool),
+	}
+}
+
+// nextSeq returns the sequence number for a new query.
+func (d *discovery) nextSeq() uint64 {
+	return atomic.AddUint64(&d.seq, 1)
+}
+
+// firstSeen checks if the query is seen for the first time.
+func (d *discovery) firstSeen(key receiptKey) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.seen[key] {
+		return false
+	}
+
+	if len(d.order) >= discoverySeenSize {
+		delete(d.seen, d.order[0])
+		d.order = d.order[1:]
+	}
+
+	d.seen[key] = true
+	d.order = append(d.order, key)
+
+	return true
+}
+
+func (d *discovery) register(seq uint64) chan []protocol.ServiceRecord {
+	ch := make(chan []protocol.ServiceRecord, eventSubscriptionBuffer)
+
+	d.lock.Lock()
+	d.pending[seq] = ch
+	d.lock.Unlock()
+
+	return ch
+}
+
+func (d *discovery) unregister(seq uint64) {
+	d.lock.Lock()
+	delete(d.pending, seq)
+	d.lock.Unlock()
+}
+
+// deliver hands the records of a reply to the pending query.
+func (d *discovery) deliver(seq uint64, records []protocol.ServiceRecord) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	ch, ok := d.pending[seq]
+	if !ok {
+		logrus.Debug("Node: reply for unknown or expired service query")
+		return
+	}
+
+	select {
+	case ch <- records:
+	default:
+		logrus.Warn("Node: service query overflow, reply dropped")
+	}
+}
+
+// match returns the registered services of the type that match the name pattern.
+func (r *serviceRegistry) match(typ string, name string) []Service {
+	pattern := strings.ToUpper(name)
+	res := []Service{}
+
+	for _, s := range r.find(typ) {
+		if pattern == "" || wildcardMatch(pattern, strings.ToUpper(s.Name)) {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+// serviceRecord converts a registered service to a reply record.
+func serviceRecord(s *Service, now time.Time) protocol.ServiceRecord {
+	rec := protocol.ServiceRecord{
+		Source: s.Source,
+		Service: protocol.ServicePayload{
+			Name:       s.Name,
+			Type:       s.Type,
+			Port:       s.Port,
+			Lifetime:   uint32(s.Expires.Sub(now) / time.Second),
+			Attributes: s.Attributes,
+			Position:   s.Position,
+		},
+	}
+
+	if ip := net.ParseIP(s.IP); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+
+		rec.Address = []byte(ip)
+	}
+
+	return rec
+}
+
+// recordService converts a reply record to a service.
+func recordService(rec *protocol.ServiceRecord, now time.Time) Service {
+	s := Service{
+		Source:     strings.ToUpper(rec.Source),
+		Name:       rec.Service.Name,
+		Type:       strings.ToLower(rec.Service.Type),
+		Port:       rec.Service.Port,
+		Attributes: rec.Service.Attributes,
+		Position:   rec.Service.Position,
+		Announced:  now,
+		Expires:    now.Add(time.Duration(rec.Service.Lifetime) * time.Second),
+	}
+
+	if len(rec.Address) == net.IPv4len || len(rec.Address) == net.IPv6len {
+		s.IP = net.IP(rec.Address).String()
+	}
+
+	return s
+}
+
+// handleDiscovery answers the service queries and routes the replies.
+func (n *Node) handleDiscovery(msg *protocol.Message, src *Peer) {
+	switch msg.PayloadType {
+	case protocol.PayloadServiceQuery:
+		n.handleServiceQuery(msg, src)
+
+	case protocol.PayloadServiceReply:
+		n.handleServiceReply(msg, src)
+	}
+}
+
+// handleServiceQuery answers a query with the matching registered services.
+func (n *Node) handleServiceQuery(msg *protocol.Message, src *Peer) {
+	// local queries are answered by the querying node itself
+	if src == nil || !n.logic.role.Originates() {
+		return
+	}
+
+	if !n.discovery.firstSeen(newReceiptKey(msg.Source.Callsign, msg.SeqCounter)) {
+		return
+	}
+
+	q, err := protocol.ParseServiceQueryPayload(msg.Payload)
+	if err != nil {
+		logrus.WithError(err).Warn("Node: failed to parse service query")
+		return
+	}
+
+	matches := n.services.match(q.Type, q.Name)
+	if len(matches) == 0 {
+		return
+	}
+
+	now := time.Now()
+	reply := protocol.ServiceReplyPayload{
+		QuerySeq: msg.SeqCounter,
+	}
+
+	// the reply travels the path of the query backwards
+	path := pathSegments(msg.Path)
+	for i := len(path) - 1; i >= 0; i-- {
+		reply.Route = append(reply.Route, path[i])
+	}
+
+	for i := range matches {
+		if len(reply.Records) == protocol.ServiceReplyMaxRecords {
+			break
+		}
+
+		reply.Records = append(reply.Records, serviceRecord(&matches[i], now))
+	}
+
+	logrus.WithField("services", len(reply.Records)).Debug("Node: answering service query")
+	n.routeServiceReply(&reply)
+}
+
+// handleServiceReply delivers a reply to the pending query or forwards it to the next hop.
+func (n *Node) handleServiceReply(msg *protocol.Message, src *Peer) {
+	if src == nil {
+		return
+	}
+
+	reply, err := protocol.ParseServiceReplyPayload(msg.Payload)
+	if err != nil {
+		logrus.WithError(err).Warn("Node: failed to parse service reply")
+		return
+	}
+
+	if len(reply.Route) == 0 || !strings.EqualFold(reply.Route[0], n.station.Callsign) {
+		logrus.Debug("Node: service reply not routed through this station, ignoring")
+		return
+	}
+
+	reply.Route = reply.Route[1:]
+
+	if len(reply.Route) == 0 {
+		n.discovery.deliver(reply.QuerySeq, reply.Records)
+		return
+	}
+
+	if !n.logic.role.Relays() {
+		logrus.Debugf("Node: %s node does not forward service replies", n.logic.role)
+		return
+	}
+
+	n.routeServiceReply(reply)
+}
+
+// routeServiceReply sends a reply to the next station of its route.
+func (n *Node) routeServiceReply(reply *protocol.ServiceReplyPayload) {
+	if len(reply.Route) == 0 {
+		return
+	}
+
+	p := n.PeerByIdentity(reply.Route[0])
+	if p == nil {
+		logrus.WithField("next", reply.Route[0]).Warn("Node: no peer for the next hop of a service reply")
+		return
+	}
+
+	pbuf := reply.Bytes()
+
+	msg := protocol.Message{
+		Version:    protocol.Version,
+		SeqCounter: 0,
+
+		// TTL set to zero so that the message is not spread
+		TTL:    0,
+		Flags:  protocol.FlagNoCache,
+		Source: n.Local,
+
+		PayloadType:   protocol.PayloadServiceReply,
+		PayloadLenght: uint32(len(pbuf)),
+		Payload:       pbuf,
+	}
+
+	p.QueueMessage(msg.Bytes(), MessagePriority(&msg))
+}
+
+// DiscoverServices floods a service query and collects the replies until the
+// timeout passed or the context is done. The local registry is included.
+func (n *Node) DiscoverServices(ctx context.Context, q ServiceQuery) ([]Service, error) {
+	if !n.logic.role.Originates() {
+		return nil, errors.New("node does not originate messages")
+	}
+
+	s := n.settings.Discovery
+
+	if q.TTL == 0 {
+		q.TTL = uint8(s.TTL)
+	}
+
+	if q.TTL == 0 {
+		q.TTL = discoveryDefaultTTL
+	}
+
+	if q.Timeout <= 0 {
+		q.Timeout = seconds(s.Timeout)
+	}
+
+	if q.Timeout <= 0 {
+		q.Timeout = discoveryDefaultTimeout * time.Second
+	}
+
+	qry := protocol.ServiceQueryPayload{Type: q.Type, Name: q.Name}
+	if len(qry.Type) > protocol.ServiceStringLength || len(qry.Name) > protocol.ServiceStringLength {
+		return nil, errors.New("query type or name too long")
+	}
+
+	seq := n.discovery.nextSeq()
+	replies := n.discovery.register(seq)
+	defer n.discovery.unregister(seq)
+
+	pbuf := qry.Bytes()
+	msg := protocol.Message{
+		Version:       protocol.Version,
+		SeqCounter:    seq,
+		TTL:           q.TTL,
+		Flags:         protocol.FlagNoCache,
+		Source:        n.Local,
+		PayloadType:   protocol.PayloadServiceQuery,
+		PayloadLenght: uint32(len(pbuf)),
+		Payload:       pbuf,
+	}
+
+	if err := n.SpreadMessage(&msg); err != nil {
+		return nil, err
+	}
+
+	res := []Service{}
+	known := make(map[serviceKey]bool)
+
+	add := func(s Service) {
+		key := serviceKey{source: s.Source, name: s.Name, typ: s.Type}
+		if !known[key] {
+			known[key] = true
+			res = append(res, s)
+		}
+	}
+
+	for _, s := range n.services.match(q.Type, q.Name) {
+		add(s)
+	}
+
+	timeout := time.NewTimer(q.Timeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case records := <-replies:
+			now := time.Now()
+			for i := range records {
+				add(recordService(&records[i], now))
+			}
+
+		case <-timeout.C:
+			return res, nil
+
+		case <-ctx.Done():
+			return res, ctx.Err()
+
+		case <-n.ctx.Done():
+			return res, errors.New("node closed")
+		}
+	}
+}
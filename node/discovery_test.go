@@ -0,0 +1,83 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func TestNode_DiscoverServices(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a - b - c - d
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+	c := testNode(t, ctx, "OE1CCC", b.settings.Port)
+	d := testNode(t, ctx, "OE1DDD", c.settings.Port)
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return connected(a) && len(b.PeerStatus()) == 2 && len(c.PeerStatus()) == 2 && connected(d)
+	})
+
+	// register services that are not spread to the other nodes
+	announce := func(n *Node, call string, seq uint64, s protocol.ServicePayload) {
+		msg := serviceMessage(call, seq, s)
+		msg.TTL = 1
+
+		if err := n.SpreadMessage(msg); err != nil {
+			t.Fatalf("SpreadMessage() error = %v", err)
+		}
+	}
+
+	announce(a, "OE1LOC", 1, protocol.ServicePayload{Name: "Camera Local", Type: "http", Port: 80, Lifetime: 60})
+	announce(c, "OE1XYZ", 1, protocol.ServicePayload{Name: "Camera Roof", Type: "http", Port: 8080, Lifetime: 60})
+	announce(c, "OE1XYZ", 2, protocol.ServicePayload{Name: "Shell", Type: "ssh", Port: 22, Lifetime: 60})
+	announce(d, "OE1FAR", 1, protocol.ServicePayload{Name: "Camera Far", Type: "http", Port: 80, Lifetime: 60})
+
+	waitFor(t, 5*time.Second, "services to be registered", func() bool {
+		return len(a.Services("")) == 1 && len(c.Services("")) == 2 && len(d.Services("")) == 1
+	})
+
+	// give the announcements time to arrive, if they were spread
+	time.Sleep(100 * time.Millisecond)
+
+	if len(a.Services("")) != 1 || len(b.Services("")) != 0 {
+		t.Fatalf("services were spread: %+v", a.Services(""))
+	}
+
+	// d is out of range of a query with a TTL of 3
+	got, err := a.DiscoverServices(ctx, ServiceQuery{
+		Type:    "http",
+		Name:    "camera*",
+		TTL:     3,
+		Timeout: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("DiscoverServices() error = %v", err)
+	}
+
+	names := make(map[string]Service)
+	for _, s := range got {
+		names[s.Name] = s
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("DiscoverServices() = %+v", got)
+	}
+
+	if s, ok := names["Camera Roof"]; !ok || s.Source != "OE1XYZ" || s.IP != "44.143.0.1" || s.Port != 8080 {
+		t.Errorf("remote service = %+v", s)
+	}
+
+	if _, ok := names["Camera Local"]; !ok {
+		t.Error("local service not included")
+	}
+
+	got, err = a.DiscoverServices(ctx, ServiceQuery{Type: "http", TTL: 4, Timeout: 500 * time.Millisecond})
+	if err != nil || len(got) != 3 {
+		t.Errorf("DiscoverServices() = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,185 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// EventType defines the type of a node event.
+type EventType string
+
+// Event types.
+const (
+	EventRateLimited     = EventType("rate-limited")
+	EventQuarantined     = EventType("quarantined")
+	EventPeerConnected   = EventType("peer-connected")
+	EventPeerDisconnect  = EventType("peer-disconnected")
+	EventReconnecting    = EventType("reconnecting")
+	EventReconnectFailed = EventType("reconnect-failed")
+	EventQueueOverflow   = EventType("queue-overflow")
+	EventSendFailed      = EventType("send-failed")
+)
+
+// Disconnect reasons.
+const (
+	ReasonConnectionLost   = "connection lost"
+	ReasonRetriesExhausted = "send retries exhausted"
+	ReasonPeerClosed       = "peer closed"
+	ReasonSelf             = "connected to self"
+	ReasonACL              = "blocked by ACL"
+	ReasonDuplicate        = "duplicate link"
+)
+
+// infoEvents are the event types that are logged as information, all other
+// types are logged as warning.
+var infoEvents = map[EventType]bool{
+	EventPeerConnected: true,
+	EventReconnecting:  true,
+}
+
+// eventLogSize is the number of events kept by the node.
+const eventLogSize = 256
+
+// Event is raised by the node on noteworthy conditions.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    EventType `json:"type"`
+	Peer    string    `json:"peer,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Message string    `json:"message"`
+}
+
+// eventSubscriptionBuffer is the channel size of an event subscription.
+const eventSubscriptionBuffer = 64
+
+// eventSubscription is a registered event subscriber.
+type eventSubscription struct {
+	types map[EventType]bool
+	ch    chan Event
+}
+
+// eventLog keeps the most recent events and delivers them to the subscribers.
+type eventLog struct {
+	events []Event
+	subs   []*eventSubscription
+	lock   sync.Mutex
+}
+
+// add appends an event and drops the oldest one if the log is full.
+func (l *eventLog) add(e Event) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.events) >= eventLogSize {
+		l.events = l.events[1:]
+	}
+
+	l.events = append(l.events, e)
+
+	for _, s := range l.subs {
+		if len(s.types) != 0 && !s.types[e.Type] {
+			continue
+		}
+
+		// slow subscribers miss events rather than stalling the node
+		select {
+		case s.ch <- e:
+		default:
+			logrus.WithField("type", e.Type).Debug("Node: event subscriber overflow, event dropped")
+		}
+	}
+}
+
+// subscribe adds a subscriber for the given event types, all types if none are given.
+func (l *eventLog) subscribe(types []EventType) *eventSubscription {
+	s := &eventSubscription{
+		types: make(map[EventType]bool),
+		ch:    make(chan Event, eventSubscriptionBuffer),
+	}
+
+	for _, t := range types {
+		s.types[t] = true
+	}
+
+	l.lock.Lock()
+	l.subs = append(l.subs, s)
+	l.lock.Unlock()
+
+	return s
+}
+
+// unsubscribe removes the subscriber and closes its channel.
+func (l *eventLog) unsubscribe(s *eventSubscription) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var subs []*eventSubscription
+	for _, v := range l.subs {
+		if v != s {
+			subs = append(subs, v)
+		}
+	}
+
+	l.subs = subs
+	close(s.ch)
+}
+
+// list returns a copy of the logged events.
+func (l *eventLog) list() []Event {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	events := make([]Event, len(l.events))
+	copy(events, l.events)
+
+	return events
+}
+
+// raiseEvent logs an event and stores it in the event log.
+func (n *Node) raiseEvent(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	log := logrus.WithFields(logrus.Fields{
+		"type":   e.Type,
+		"peer":   e.Peer,
+		"source": e.Source,
+		"reason": e.Reason,
+	})
+
+	if infoEvents[e.Type] {
+		log.Info("Node: " + e.Message)
+	} else {
+		log.Warn("Node: " + e.Message)
+	}
+
+	n.events.add(e)
+}
+
+// SubscribeEvents returns a channel that receives the events of the given
+// types, all events if no type is given. Events are dropped if the channel
+// is full. The channel is closed when the context is done or the node is closed.
+func (n *Node) SubscribeEvents(ctx context.Context, types ...EventType) <-chan Event {
+	s := n.events.subscribe(types)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-n.ctx.Done():
+		}
+
+		n.events.unsubscribe(s)
+	}()
+
+	return s.ch
+}
+
+// Events returns the most recent events of the node.
+func (n *Node) Events() []Event {
+	return n.events.list()
+}
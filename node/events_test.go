@@ -0,0 +1,109 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+// waitEvent waits for an event of the given type.
+func waitEvent(t *testing.T, events <-chan Event, typ EventType) Event {
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatalf("event channel closed while waiting for %s", typ)
+			}
+
+			if e.Type == typ {
+				return e
+			}
+
+		case <-timeout:
+			t.Fatalf("timeout waiting for event %s", typ)
+		}
+	}
+}
+
+func TestNode_PeerEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := testNode(t, ctx, "OE1AAA")
+
+	sctx, scancel := context.WithCancel(ctx)
+	defer scancel()
+
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+	events := b.SubscribeEvents(sctx, EventPeerConnected, EventPeerDisconnect, EventReconnecting)
+
+	waitEvent(t, events, EventPeerConnected)
+
+	a.Close()
+
+	if e := waitEvent(t, events, EventPeerDisconnect); e.Reason != ReasonConnectionLost {
+		t.Errorf("disconnect reason = %q, want %q", e.Reason, ReasonConnectionLost)
+	}
+
+	waitEvent(t, events, EventReconnecting)
+
+	waitFor(t, 5*time.Second, "failed reconnect in the event log", func() bool {
+		for _, e := range b.Events() {
+			if e.Type == EventReconnectFailed {
+				return e.Reason != ""
+			}
+		}
+
+		return false
+	})
+
+	scancel()
+
+	// the channel is closed once the subscription is cancelled
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+
+		case <-timeout:
+			t.Fatal("event channel not closed")
+		}
+	}
+}
+
+func TestPeerQueue_overflow(t *testing.T) {
+	q, err := newPeerQueue(parameters.Settings{PeerQueueSize: 1})
+	if err != nil {
+		t.Fatalf("newPeerQueue() error = %v", err)
+	}
+
+	if ok, started := q.push([]byte{1}, PriorityNormal); !ok || started {
+		t.Errorf("push() = %v, %v, want true, false", ok, started)
+	}
+
+	if ok, started := q.push([]byte{2}, PriorityNormal); ok || !started {
+		t.Errorf("push() = %v, %v, want false, true", ok, started)
+	}
+
+	// the overflow is only reported once
+	if ok, started := q.push([]byte{3}, PriorityNormal); ok || started {
+		t.Errorf("push() = %v, %v, want false, false", ok, started)
+	}
+
+	q.pop()
+
+	if ok, started := q.push([]byte{4}, PriorityNormal); !ok || started {
+		t.Errorf("push() = %v, %v, want true, false", ok, started)
+	}
+
+	if ok, started := q.push([]byte{5}, PriorityNormal); ok || !started {
+		t.Errorf("push() = %v, %v, want false, true", ok, started)
+	}
+}
@@ -0,0 +1,301 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+// FilterStage defines where in the message handling a filter runs.
+type FilterStage int
+
+// Filter stages.
+const (
+	// StageReceive runs on messages received from peers, before the access
+	// control and flood protection.
+	StageReceive FilterStage = iota
+
+	// StageCache runs on the copy of a message that is cached and delivered
+	// to the local handlers and subscribers.
+	StageCache
+
+	// StageRelay runs on received messages before they are forwarded.
+	StageRelay
+
+	// StageEgress runs once per peer on every message spread to it.
+	StageEgress
+
+	numStages
+)
+
+var stageNames = [numStages]string{"receive", "cache", "relay", "egress"}
+
+// String returns the name of the stage.
+func (s FilterStage) String() string {
+	if s < 0 || s >= numStages {
+		return "unknown"
+	}
+
+	return stageNames[s]
+}
+
+// ParseFilterStage returns the stage with the given name.
+func ParseFilterStage(name string) (FilterStage, error) {
+	for i, n := range stageNames {
+		if strings.EqualFold(n, name) {
+			return FilterStage(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown filter stage %q", name)
+}
+
+// FilterAction is the decision of a filter.
+type FilterAction int
+
+// Filter actions.
+const (
+	FilterAccept FilterAction = iota
+	FilterDrop
+)
+
+// MessageFilter decides if a message passes a stage. A filter may modify the
+// message in place, it always works on a copy owned by the stage. The peer is
+// the source on receive, cache and relay, the destination on egress and nil
+// for local messages.
+type MessageFilter interface {
+	Filter(msg *protocol.Message, peer *Peer) FilterAction
+}
+
+// FilterFunc adapts a function to a MessageFilter.
+type FilterFunc func(msg *protocol.Message, peer *Peer) FilterAction
+
+// Filter calls the function.
+func (f FilterFunc) Filter(msg *protocol.Message, peer *Peer) FilterAction {
+	return f(msg, peer)
+}
+
+type namedFilter struct {
+	name   string
+	filter MessageFilter
+}
+
+// FilterChain is an ordered list of filters per stage, filters can be added
+// and removed at runtime.
+type FilterChain struct {
+	stages [numStages][]namedFilter
+	lock   sync.RWMutex
+}
+
+// NewFilterChain creates a filter chain with the configured built-in filters.
+func NewFilterChain(settings []parameters.FilterSettings) (*FilterChain, error) {
+	c := &FilterChain{}
+
+	for i, s := range settings {
+		stage, err := ParseFilterStage(s.Stage)
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := newBuiltinFilter(s)
+		if err != nil {
+			return nil, err
+		}
+
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", s.Type, i)
+		}
+
+		if err := c.Add(stage, name, f); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Add appends a filter to the stage, names are unique per stage.
+func (c *FilterChain) Add(stage FilterStage, name string, f MessageFilter) error {
+	if stage < 0 || stage >= numStages {
+		return fmt.Errorf("unknown filter stage %d", stage)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, v := range c.stages[stage] {
+		if v.name == name {
+			return fmt.Errorf("filter %q already exists in stage %s", name, stage)
+		}
+	}
+
+	c.stages[stage] = append(c.stages[stage], namedFilter{name: name, filter: f})
+	return nil
+}
+
+// Remove removes the named filter from the stage.
+func (c *FilterChain) Remove(stage FilterStage, name string) error {
+	if stage < 0 || stage >= numStages {
+		return fmt.Errorf("unknown filter stage %d", stage)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var filters []namedFilter
+	found := false
+
+	for _, v := range c.stages[stage] {
+		if v.name == name {
+			found = true
+			continue
+		}
+
+		filters = append(filters, v)
+	}
+
+	if !found {
+		return fmt.Errorf("filter %q not found in stage %s", name, stage)
+	}
+
+	c.stages[stage] = filters
+	return nil
+}
+
+// Names returns the names of the filters of the stage in order.
+func (c *FilterChain) Names(stage FilterStage) []string {
+	names := []string{}
+
+	if stage < 0 || stage >= numStages {
+		return names
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	for _, v := range c.stages[stage] {
+		names = append(names, v.name)
+	}
+
+	return names
+}
+
+// active checks if the stage has any filters.
+func (c *FilterChain) active(stage FilterStage) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return len(c.stages[stage]) != 0
+}
+
+// run passes the message through the filters of the stage and returns false
+// if it was dropped.
+func (c *FilterChain) run(stage FilterStage, msg *protocol.Message, peer *Peer) bool {
+	c.lock.RLock()
+	filters := c.stages[stage]
+	c.lock.RUnlock()
+
+	for _, f := range filters {
+		if f.filter.Filter(msg, peer) == FilterDrop {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Built-in filter types.
+const (
+	FilterTypeMaxPayload  = "maxPayload"
+	FilterTypeDropPayload = "dropPayload"
+	FilterTypeStripIPs    = "stripIPs"
+)
+
+// filterMatch selects the messages a built-in filter applies to.
+type filterMatch struct {
+	payloadTypes map[protocol.PayloadType]bool
+	contactTypes map[protocol.ContactType]bool
+	peers        []string
+}
+
+func newFilterMatch(s parameters.FilterSettings) filterMatch {
+	m := filterMatch{
+		payloadTypes: make(map[protocol.PayloadType]bool),
+		contactTypes: make(map[protocol.ContactType]bool),
+		peers:        normalizeCallsigns(s.Peers),
+	}
+
+	for _, t := range s.PayloadTypes {
+		m.payloadTypes[protocol.PayloadType(t)] = true
+	}
+
+	for _, t := range s.ContactTypes {
+		m.contactTypes[protocol.ContactType(t)] = true
+	}
+
+	return m
+}
+
+// matches checks if the filter applies to the message.
+func (m *filterMatch) matches(msg *protocol.Message, peer *Peer) bool {
+	if len(m.payloadTypes) != 0 && !m.payloadTypes[msg.PayloadType] {
+		return false
+	}
+
+	if len(m.contactTypes) != 0 && !m.contactTypes[msg.Source.Type] {
+		return false
+	}
+
+	if len(m.peers) != 0 {
+		if peer == nil || !matchCallsigns(m.peers, strings.ToUpper(peer.Identity())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newBuiltinFilter creates a configured built-in filter.
+func newBuiltinFilter(s parameters.FilterSettings) (MessageFilter, error) {
+	m := newFilterMatch(s)
+
+	switch s.Type {
+	case FilterTypeMaxPayload:
+		if s.MaxSize == 0 {
+			return nil, fmt.Errorf("filter %s: maxSize missing", s.Type)
+		}
+
+		return FilterFunc(func(msg *protocol.Message, peer *Peer) FilterAction {
+			if m.matches(msg, peer) && uint(len(msg.Payload)) > s.MaxSize {
+				return FilterDrop
+			}
+
+			return FilterAccept
+		}), nil
+
+	case FilterTypeDropPayload:
+		return FilterFunc(func(msg *protocol.Message, peer *Peer) FilterAction {
+			if m.matches(msg, peer) {
+				return FilterDrop
+			}
+
+			return FilterAccept
+		}), nil
+
+	case FilterTypeStripIPs:
+		return FilterFunc(func(msg *protocol.Message, peer *Peer) FilterAction {
+			if m.matches(msg, peer) {
+				msg.Source.IPs = []protocol.ContactIP{}
+				msg.Source.NumberIPs = 0
+			}
+
+			return FilterAccept
+		}), nil
+	}
+
+	return nil, fmt.Errorf("unknown filter type %q", s.Type)
+}
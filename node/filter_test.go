@@ -0,0 +1,303 @@
+package node
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func filterTestMessage() *protocol.Message {
+	return &protocol.Message{
+		PayloadType: protocol.PayloadCQ,
+		Source: protocol.Contact{
+			Type:      protocol.ContactTypeUser,
+			Callsign:  []byte("OE1ABC"),
+			NumberIPs: 1,
+			IPs: []protocol.ContactIP{
+				{Type: protocol.ContactIPv4, Length: 4, Data: []byte{10, 0, 0, 1}},
+			},
+		},
+		Payload: make([]byte, 100),
+	}
+}
+
+func TestNewBuiltinFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings parameters.FilterSettings
+		want     FilterAction
+		wantIPs  int
+		wantErr  bool
+	}{
+		{
+			name:     "max payload accept",
+			settings: parameters.FilterSettings{Type: FilterTypeMaxPayload, MaxSize: 100},
+			want:     FilterAccept,
+			wantIPs:  1,
+		},
+		{
+			name:     "max payload drop",
+			settings: parameters.FilterSettings{Type: FilterTypeMaxPayload, MaxSize: 99},
+			want:     FilterDrop,
+			wantIPs:  1,
+		},
+		{
+			name:     "max payload without size",
+			settings: parameters.FilterSettings{Type: FilterTypeMaxPayload},
+			wantErr:  true,
+		},
+		{
+			name:     "drop payload type",
+			settings: parameters.FilterSettings{Type: FilterTypeDropPayload, PayloadTypes: []uint{protocol.PayloadCQ}},
+			want:     FilterDrop,
+			wantIPs:  1,
+		},
+		{
+			name:     "drop other payload type",
+			settings: parameters.FilterSettings{Type: FilterTypeDropPayload, PayloadTypes: []uint{protocol.PayloadDebug}},
+			want:     FilterAccept,
+			wantIPs:  1,
+		},
+		{
+			name:     "drop for peer without peer",
+			settings: parameters.FilterSettings{Type: FilterTypeDropPayload, Peers: []string{"OE1XYZ"}},
+			want:     FilterAccept,
+			wantIPs:  1,
+		},
+		{
+			name:     "strip user ips",
+			settings: parameters.FilterSettings{Type: FilterTypeStripIPs, ContactTypes: []uint{protocol.ContactTypeUser}},
+			want:     FilterAccept,
+			wantIPs:  0,
+		},
+		{
+			name:     "strip fixed ips",
+			settings: parameters.FilterSettings{Type: FilterTypeStripIPs, ContactTypes: []uint{protocol.ContactTypeFixed}},
+			want:     FilterAccept,
+			wantIPs:  1,
+		},
+		{
+			name:     "unknown type",
+			settings: parameters.FilterSettings{Type: "unknown"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newBuiltinFilter(tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newBuiltinFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			msg := filterTestMessage()
+			if got := f.Filter(msg, nil); got != tt.want {
+				t.Errorf("Filter() = %v, want %v", got, tt.want)
+			}
+
+			if len(msg.Source.IPs) != tt.wantIPs || int(msg.Source.NumberIPs) != tt.wantIPs {
+				t.Errorf("Filter() left %d ips, want %d", len(msg.Source.IPs), tt.wantIPs)
+			}
+		})
+	}
+}
+
+func TestNewFilterChain(t *testing.T) {
+	c, err := NewFilterChain([]parameters.FilterSettings{
+		{Type: FilterTypeMaxPayload, Stage: "receive", MaxSize: 4096},
+		{Name: "no-debug", Type: FilterTypeDropPayload, Stage: "relay", PayloadTypes: []uint{protocol.PayloadDebug}},
+	})
+	if err != nil {
+		t.Fatalf("NewFilterChain() error = %v", err)
+	}
+
+	if names := c.Names(StageReceive); len(names) != 1 || names[0] != "maxPayload-0" {
+		t.Errorf("Names(receive) = %v", names)
+	}
+
+	if err := c.Add(StageRelay, "no-debug", FilterFunc(func(*protocol.Message, *Peer) FilterAction {
+		return FilterAccept
+	})); err == nil {
+		t.Error("Add() accepted a duplicate name")
+	}
+
+	if err := c.Remove(StageRelay, "no-debug"); err != nil {
+		t.Errorf("Remove() error = %v", err)
+	}
+
+	if c.active(StageRelay) {
+		t.Error("relay stage still active after removing its filter")
+	}
+
+	if _, err := NewFilterChain([]parameters.FilterSettings{{Type: FilterTypeStripIPs, Stage: "nowhere"}}); err == nil {
+		t.Error("NewFilterChain() accepted an unknown stage")
+	}
+}
+
+func TestNode_FilterStages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a - b - c, b relays with filters
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+	c := testNode(t, ctx, "OE1CCC", b.settings.Port)
+
+	noDebug, _ := newBuiltinFilter(parameters.FilterSettings{Type: FilterTypeDropPayload, PayloadTypes: []uint{protocol.PayloadDebug}})
+	strip, _ := newBuiltinFilter(parameters.FilterSettings{Type: FilterTypeStripIPs, Peers: []string{"OE1AAA"}})
+
+	if err := b.Filters().Add(StageRelay, "no-debug", noDebug); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Filters().Add(StageEgress, "strip", strip); err != nil {
+		t.Fatal(err)
+	}
+
+	// a custom filter that refuses a sequence number on receive
+	if err := a.Filters().Add(StageReceive, "refuse", FilterFunc(func(msg *protocol.Message, peer *Peer) FilterAction {
+		if msg.SeqCounter == 3 {
+			return FilterDrop
+		}
+
+		return FilterAccept
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return connected(a) && connected(b) && connected(c) && len(b.PeerStatus()) == 2
+	})
+
+	debug := testMessage(c, 1)
+	debug.PayloadType = protocol.PayloadDebug
+
+	cq := filterTestMessage()
+	cq.Source = c.Local
+	cq.Source.NumberIPs = 1
+	cq.Source.IPs = []protocol.ContactIP{{Type: protocol.ContactIPv4, Length: 4, Data: []byte{10, 0, 0, 1}}}
+	cq.SeqCounter = 2
+	cq.TTL = 255
+
+	refused := testMessage(c, 3)
+
+	for _, m := range []*protocol.Message{debug, cq, refused} {
+		if err := c.SpreadMessage(m); err != nil {
+			t.Fatalf("SpreadMessage() error = %v", err)
+		}
+	}
+
+	waitFor(t, 5*time.Second, "messages to arrive at b", func() bool {
+		return cached(b, 1) && cached(b, 2) && cached(b, 3)
+	})
+
+	waitFor(t, 5*time.Second, "cq to arrive at a", func() bool {
+		return cached(a, 2)
+	})
+
+	// give the dropped messages time to arrive, if they were relayed
+	time.Sleep(200 * time.Millisecond)
+
+	if cached(a, 1) {
+		t.Error("debug message was relayed")
+	}
+
+	if cached(a, 3) {
+		t.Error("message refused on receive was cached")
+	}
+
+	for _, m := range a.CacheSnapshot() {
+		if m.SeqCounter == 2 && len(m.Source.IPs) != 0 {
+			t.Errorf("ips not stripped on egress: %v", m.Source.IPs)
+		}
+	}
+
+	for _, m := range b.CacheSnapshot() {
+		if m.SeqCounter == 2 && len(m.Source.IPs) != 1 {
+			t.Errorf("ips stripped in the cache of the relay: %v", m.Source.IPs)
+		}
+	}
+}
+
+func TestNode_StripIPsMesh(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a - b - d and a - c - d, only b strips the IPs on egress
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+	c := testNode(t, ctx, "OE1CCC", a.settings.Port)
+	d := testNode(t, ctx, "OE1DDD", b.settings.Port, c.settings.Port)
+
+	strip, _ := newBuiltinFilter(parameters.FilterSettings{Type: FilterTypeStripIPs})
+	if err := b.Filters().Add(StageEgress, "strip", strip); err != nil {
+		t.Fatal(err)
+	}
+
+	recordACKs(t, a)
+
+	var delivered int64
+	d.AddCallback(&MessageCallback{
+		Cb: func(msg *protocol.Message, src *Peer) {
+			if msg.SeqCounter == 1 {
+				atomic.AddInt64(&delivered, 1)
+			}
+		},
+	})
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return len(a.PeerStatus()) == 2 && len(d.PeerStatus()) == 2 &&
+			connected(a) && connected(b) && connected(c) && connected(d)
+	})
+
+	msg := filterTestMessage()
+	msg.Source.Callsign = a.Local.Callsign
+	msg.Source.CallsignLength = a.Local.CallsignLength
+	msg.SeqCounter = 1
+	msg.TTL = 255
+	msg.Flags = protocol.FlagACK
+
+	if err := a.SpreadMessage(msg); err != nil {
+		t.Fatalf("SpreadMessage() error = %v", err)
+	}
+
+	waitFor(t, 5*time.Second, "ACK of d to arrive", func() bool {
+		r, ok := a.Receipts("OE1AAA", 1)
+		if !ok {
+			return false
+		}
+
+		for _, ack := range r.Acks {
+			if ack.Station == "OE1DDD" {
+				return true
+			}
+		}
+
+		return false
+	})
+
+	// give the second copy time to arrive
+	time.Sleep(200 * time.Millisecond)
+
+	if n := atomic.LoadInt64(&delivered); n != 1 {
+		t.Errorf("message delivered %d times", n)
+	}
+
+	copies := 0
+	for _, m := range d.CacheSnapshot() {
+		if m.SeqCounter == 1 {
+			copies++
+		}
+	}
+
+	if copies != 1 {
+		t.Errorf("message cached %d times", copies)
+	}
+}
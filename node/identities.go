@@ -0,0 +1,180 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+// LocalIdentity is a callsign the node sends as.
+type LocalIdentity struct {
+	callsign     string
+	seq          uint64
+	payloadTypes map[protocol.PayloadType]bool
+}
+
+// IdentityStatus describes a local identity.
+type IdentityStatus struct {
+	Callsign     string                 `json:"callsign"`
+	Primary      bool                   `json:"primary"`
+	PayloadTypes []protocol.PayloadType `json:"payloadTypes,omitempty"`
+	Sequence     uint64                 `json:"sequence"`
+}
+
+func newLocalIdentity(sett parameters.Identity, seq uint64) (*LocalIdentity, error) {
+	id := &LocalIdentity{
+		callsign:     strings.ToUpper(sett.Callsign),
+		seq:          seq,
+		payloadTypes: make(map[protocol.PayloadType]bool),
+	}
+
+	if id.callsign == "" {
+		return nil, errors.New("identity callsign required")
+	}
+
+	for _, t := range sett.PayloadTypes {
+		id.payloadTypes[protocol.PayloadType(t)] = true
+	}
+
+	return id, nil
+}
+
+// nextSeq returns the sequence counter for a new message.
+func (i *LocalIdentity) nextSeq() uint64 {
+	return atomic.AddUint64(&i.seq, 1)
+}
+
+// allows checks if messages of the payload type may be sent as the identity.
+func (i *LocalIdentity) allows(t protocol.PayloadType) bool {
+	return len(i.payloadTypes) == 0 || i.payloadTypes[t]
+}
+
+// identities holds the local identities, the first one is the station.
+type identities struct {
+	list   []*LocalIdentity
+	byCall map[string]*LocalIdentity
+}
+
+// newIdentities creates the identities of the station. The station callsign
+// is always an identity, it can be listed to restrict it.
+func newIdentities(station parameters.Station) (*identities, error) {
+	ids := &identities{
+		byCall: make(map[string]*LocalIdentity),
+	}
+
+	// the counters continue above the ones used before a restart
+	seq := uint64(time.Now().UnixNano())
+
+	primary, err := newLocalIdentity(parameters.Identity{Callsign: station.Callsign}, seq)
+	if err != nil {
+		return nil, err
+	}
+
+	ids.list = append(ids.list, primary)
+	ids.byCall[primary.callsign] = primary
+	configured := false
+
+	for _, sett := range station.Identities {
+		id, err := newLocalIdentity(sett, seq)
+		if err != nil {
+			return nil, err
+		}
+
+		// the station itself may be listed once to restrict it
+		if id.callsign == primary.callsign && !configured {
+			*primary = *id
+			configured = true
+			continue
+		}
+
+		if _, ok := ids.byCall[id.callsign]; ok {
+			return nil, fmt.Errorf("duplicate identity %s", id.callsign)
+		}
+
+		ids.list = append(ids.list, id)
+		ids.byCall[id.callsign] = id
+	}
+
+	return ids, nil
+}
+
+// get returns the identity of a callsign.
+func (ids *identities) get(call string) (*LocalIdentity, bool) {
+	id, ok := ids.byCall[strings.ToUpper(call)]
+	return id, ok
+}
+
+// local checks if the callsign is one of the local identities.
+func (ids *identities) local(call string) bool {
+	_, ok := ids.get(call)
+	return ok
+}
+
+// inPath checks if a path contains one of the local identities.
+func (ids *identities) inPath(path string) bool {
+	for _, s := range pathSegments(path) {
+		if ids.local(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Identities returns the local identities of the node, the station first.
+func (n *Node) Identities() []IdentityStatus {
+	res := []IdentityStatus{}
+
+	for i, id := range n.identities.list {
+		s := IdentityStatus{
+			Callsign: id.callsign,
+			Primary:  i == 0,
+			Sequence: atomic.LoadUint64(&id.seq),
+		}
+
+		for t := range id.payloadTypes {
+			s.PayloadTypes = append(s.PayloadTypes, t)
+		}
+
+		sort.Slice(s.PayloadTypes, func(a, b int) bool {
+			return s.PayloadTypes[a] < s.PayloadTypes[b]
+		})
+
+		res = append(res, s)
+	}
+
+	return res
+}
+
+// AssignIdentity sends the message as a local identity, the station for an
+// empty callsign. A zero sequence counter is replaced by the next one of the
+// identity.
+func (n *Node) AssignIdentity(call string, msg *protocol.Message) error {
+	id := n.identities.list[0]
+
+	if call != "" {
+		var ok bool
+		if id, ok = n.identities.get(call); !ok {
+			return fmt.Errorf("unknown identity %s", call)
+		}
+	}
+
+	if !id.allows(msg.PayloadType) {
+		return fmt.Errorf("identity %s does not send payload type %d", id.callsign, msg.PayloadType)
+	}
+
+	msg.Source.Callsign = []byte(id.callsign)
+	msg.Source.CallsignLength = uint8(len(id.callsign))
+
+	if msg.SeqCounter == 0 {
+		msg.SeqCounter = id.nextSeq()
+	}
+
+	return nil
+}
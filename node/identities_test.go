@@ -0,0 +1,171 @@
+package node
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func Test_newIdentities(t *testing.T) {
+	tests := []struct {
+		name       string
+		identities []parameters.Identity
+		want       []string
+		wantErr    bool
+	}{
+		{name: "station only", want: []string{"OE1XYZ"}},
+		{
+			name: "additional identities",
+			identities: []parameters.Identity{
+				{Callsign: "OE1XYZ-5", PayloadTypes: []uint{protocol.PayloadService}},
+				{Callsign: "oe1club"},
+			},
+			want: []string{"OE1XYZ", "OE1XYZ-5", "OE1CLUB"},
+		},
+		{
+			name:       "station configured",
+			identities: []parameters.Identity{{Callsign: "OE1XYZ", PayloadTypes: []uint{protocol.PayloadCQ}}},
+			want:       []string{"OE1XYZ"},
+		},
+		{
+			name:       "duplicate",
+			identities: []parameters.Identity{{Callsign: "OE1XYZ-5"}, {Callsign: "oe1xyz-5"}},
+			wantErr:    true,
+		},
+		{
+			name:       "empty callsign",
+			identities: []parameters.Identity{{}},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids, err := newIdentities(parameters.Station{Callsign: "OE1XYZ", Identities: tt.identities})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newIdentities() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			got := []string{}
+			for _, id := range ids.list {
+				got = append(got, id.callsign)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("identities = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_identities_inPath(t *testing.T) {
+	ids, err := newIdentities(parameters.Station{
+		Callsign:   "OE1XYZ",
+		Identities: []parameters.Identity{{Callsign: "OE1CLUB"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"empty", "", false},
+		{"other stations", ";OE1AAA;OE1BBB", false},
+		{"station", ";OE1AAA;OE1XYZ", true},
+		{"identity", ";oe1club;OE1AAA", true},
+		{"prefix of a segment", ";OE1CLUBX", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids.inPath(tt.path); got != tt.want {
+				t.Errorf("inPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNode_AssignIdentity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := testNode(t, ctx, "OE1AAA")
+	ids, err := newIdentities(parameters.Station{
+		Callsign: "OE1AAA",
+		Identities: []parameters.Identity{
+			{Callsign: "OE1AAA-5", PayloadTypes: []uint{protocol.PayloadService}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n.identities = ids
+	n.logic.identities = ids
+
+	tests := []struct {
+		name     string
+		identity string
+		typ      protocol.PayloadType
+		seq      uint64
+		want     string
+		wantErr  bool
+	}{
+		{name: "station", typ: protocol.PayloadCQ, want: "OE1AAA"},
+		{name: "service identity", identity: "oe1aaa-5", typ: protocol.PayloadService, want: "OE1AAA-5"},
+		{name: "given sequence", identity: "OE1AAA-5", typ: protocol.PayloadService, seq: 42, want: "OE1AAA-5"},
+		{name: "payload not permitted", identity: "OE1AAA-5", typ: protocol.PayloadCQ, wantErr: true},
+		{name: "unknown identity", identity: "OE1BBB", typ: protocol.PayloadCQ, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &protocol.Message{PayloadType: tt.typ, SeqCounter: tt.seq}
+
+			err := n.AssignIdentity(tt.identity, msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AssignIdentity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if string(msg.Source.Callsign) != tt.want || int(msg.Source.CallsignLength) != len(tt.want) {
+				t.Errorf("source = %s, want %s", msg.Source.Callsign, tt.want)
+			}
+
+			if tt.seq != 0 && msg.SeqCounter != tt.seq {
+				t.Errorf("sequence = %d, want %d", msg.SeqCounter, tt.seq)
+			}
+
+			if msg.SeqCounter == 0 {
+				t.Error("sequence not assigned")
+			}
+		})
+	}
+
+	// each identity counts on its own
+	a, b := &protocol.Message{PayloadType: protocol.PayloadCQ}, &protocol.Message{PayloadType: protocol.PayloadCQ}
+	n.AssignIdentity("", a)
+	n.AssignIdentity("", b)
+	if b.SeqCounter != a.SeqCounter+1 {
+		t.Errorf("sequences = %d, %d, want consecutive", a.SeqCounter, b.SeqCounter)
+	}
+
+	// spreading as a restricted identity is checked as well
+	msg := testMessage(n, 1)
+	msg.Source.Callsign = []byte("OE1AAA-5")
+	msg.Source.CallsignLength = 8
+
+	if err := n.SpreadMessage(msg); err == nil {
+		t.Error("SpreadMessage() of a payload type not permitted for the identity succeeded")
+	}
+}
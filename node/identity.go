@@ -0,0 +1,158 @@
+package node
+
+import (
+	"strings"
+
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// sendHello announces the identity of the local node to a directly connected peer.
+func (n *Node) sendHello(p *Peer) {
+	msg := protocol.Message{
+		Version:    protocol.Version,
+		SeqCounter: 0,
+
+		// hello messages are only valid for the direct link
+		TTL:    0,
+		Flags:  protocol.FlagNoCache,
+		Source: n.Local,
+
+		PathLength:    0,
+		Path:          "",
+		PayloadType:   protocol.PayloadHello,
+		PayloadLenght: 0,
+		Payload:       []byte{},
+	}
+
+	logrus.Debug("Node: sending hello")
+	p.QueueMessage(msg.Bytes(), MessagePriority(&msg))
+}
+
+// PeerByIdentity returns the peer that announced the given callsign.
+func (n *Node) PeerByIdentity(identity string) *Peer {
+	for _, p := range n.logic.Peers() {
+		if strings.EqualFold(p.Identity(), identity) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// removePeer closes a peer and removes it from the peer list.
+func (n *Node) removePeer(p *Peer) {
+	logrus.WithField("identity", p.Identity()).Info("Node: removing peer")
+
+	n.logic.removePeer(p)
+	p.Close()
+}
+
+// identifyPeer stores the announced identity of a peer and merges duplicate
+// links to the same node.
+func (n *Node) identifyPeer(p *Peer, identity string) {
+	if p == nil || identity == "" {
+		return
+	}
+
+	logrus.WithField("identity", identity).Info("Node: peer identified")
+
+	if n.identities.local(identity) {
+		logrus.Warn("Node: peer is the local node, closing connection")
+
+		if conn := p.Connection(); conn != nil {
+			p.closeConnection(conn, ReasonSelf)
+		}
+
+		if p.fromServer {
+			n.removePeer(p)
+		}
+
+		return
+	}
+
+	if !n.acl.AllowPeer(identity) {
+		logrus.WithField("identity", identity).Warn("Node: peer blocked by ACL, closing connection")
+
+		if conn := p.Connection(); conn != nil {
+			p.closeConnection(conn, ReasonACL)
+		}
+
+		if p.fromServer {
+			n.removePeer(p)
+		}
+
+		return
+	}
+
+	// identification of concurrent links must not interleave
+	n.identifyLock.Lock()
+	defer n.identifyLock.Unlock()
+
+	p.setIdentity(identity)
+
+	var dup *Peer
+	for _, o := range n.logic.Peers() {
+		if o != p && strings.EqualFold(o.Identity(), identity) {
+			dup = o
+			break
+		}
+	}
+
+	if dup == nil {
+		return
+	}
+
+	n.mergePeers(p, dup, identity)
+}
+
+// mergePeers resolves two links to the same node. The configured peer is
+// kept if there is one, the surviving connection is the one dialed by the
+// node with the lower callsign, so both ends come to the same decision.
+// Of two inbound links the most recent one is kept, the remote node
+// reconnected and the older link is stale.
+func (n *Node) mergePeers(a *Peer, b *Peer, identity string) {
+	keep, drop := b, a
+	if keep.fromServer && !drop.fromServer {
+		keep, drop = a, b
+	}
+
+	if keep.fromServer && drop.fromServer {
+		if keep.connectedSince().Before(drop.connectedSince()) {
+			keep, drop = drop, keep
+		}
+
+		logrus.WithField("identity", identity).Info("Node: closing the older of two inbound links")
+
+		if conn := drop.Connection(); conn != nil {
+			drop.closeConnection(conn, ReasonDuplicate)
+		}
+
+		n.removePeer(drop)
+		return
+	}
+
+	if !keep.fromServer && !drop.fromServer {
+		logrus.WithField("identity", identity).Warn("Node: node configured as peer more than once")
+		return
+	}
+
+	// the connection dialed by the lower callsign survives
+	localDials := strings.ToUpper(n.station.Callsign) < strings.ToUpper(identity)
+	wantInbound := !localDials
+
+	logrus.WithFields(logrus.Fields{
+		"identity": identity,
+		"inbound":  wantInbound,
+	}).Info("Node: merging duplicate links")
+
+	if conn, inbound := keep.connectionState(); conn == nil || inbound != wantInbound {
+		keep.adoptConnection(drop)
+	} else if conn := drop.Connection(); conn != nil {
+		drop.closeConnection(conn, ReasonDuplicate)
+		drop.detach()
+	}
+
+	n.removePeer(drop)
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+func TestNode_mergePeers(t *testing.T) {
+	now := time.Now()
+
+	// link describes a peer, the age is the time since it connected
+	type link struct {
+		inbound bool
+		age     time.Duration
+	}
+
+	tests := []struct {
+		name string
+		// a is the link that was just identified, b the known one
+		a, b  link
+		wantA bool
+		wantB bool
+	}{
+		{"configured kept over inbound", link{inbound: true}, link{}, false, true},
+		{"configured kept over known inbound", link{}, link{inbound: true}, true, false},
+		{"configured twice", link{}, link{}, true, true},
+		{"newer inbound kept", link{true, time.Second}, link{true, time.Minute}, true, false},
+		{"known inbound kept if newer", link{true, time.Minute}, link{true, time.Second}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			n, err := NewNode(ctx, parameters.Settings{}, parameters.Station{Callsign: "OE1AAA"})
+			if err != nil {
+				t.Fatalf("NewNode() error = %v", err)
+			}
+
+			peer := func(l link) *Peer {
+				p := NewPeer("127.0.0.1", 9124, parameters.Settings{})
+				p.fromServer = l.inbound
+				p.connectedAt = now.Add(-l.age)
+				p.setIdentity("OE1BBB")
+				n.logic.addPeer(p)
+				return p
+			}
+
+			a, b := peer(tt.a), peer(tt.b)
+			n.mergePeers(a, b, "OE1BBB")
+
+			has := func(p *Peer) bool {
+				for _, o := range n.logic.Peers() {
+					if o == p {
+						return true
+					}
+				}
+
+				return false
+			}
+
+			if has(a) != tt.wantA || has(b) != tt.wantB {
+				t.Errorf("kept a = %v, b = %v, want %v, %v", has(a), has(b), tt.wantA, tt.wantB)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+// TestNode_Mesh spreads messages from all nodes of a small mesh concurrently
+// while the shared state is read, run it with -race.
+func TestNode_Mesh(t *testing.T) {
+	const perNode = 10
+
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a - b - c - d, with an additional link d - a
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+	c := testNode(t, ctx, "OE1CCC", b.settings.Port)
+	d := testNode(t, ctx, "OE1DDD", c.settings.Port, a.settings.Port)
+	nodes := []*Node{a, b, c, d}
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		for _, n := range nodes {
+			if !connected(n) {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	var received int64
+	for _, n := range nodes {
+		n.AddCallback(&MessageCallback{
+			Cb: func(*protocol.Message, *Peer) {
+				atomic.AddInt64(&received, 1)
+			},
+		})
+	}
+
+	stop := make(chan interface{})
+	readers := sync.WaitGroup{}
+
+	// read the state while messages are spread
+	for _, n := range nodes {
+		readers.Add(1)
+
+		go func(n *Node) {
+			defer readers.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				n.PeerStatus()
+				n.CacheSnapshot()
+				n.FloodStatus()
+				n.Events()
+				time.Sleep(time.Millisecond)
+			}
+		}(n)
+	}
+
+	spread := sync.WaitGroup{}
+	for _, n := range nodes {
+		spread.Add(1)
+
+		go func(n *Node) {
+			defer spread.Done()
+
+			for i := 1; i <= perNode; i++ {
+				if err := n.SpreadMessage(testMessage(n, uint64(i))); err != nil {
+					t.Errorf("SpreadMessage() error = %v", err)
+				}
+			}
+		}(n)
+	}
+
+	spread.Wait()
+
+	waitFor(t, 10*time.Second, "messages to arrive at all nodes", func() bool {
+		for _, n := range nodes {
+			if len(n.CacheSnapshot()) != len(nodes)*perNode {
+				return false
+			}
+		}
+
+		return true
+	})
+
+	close(stop)
+	readers.Wait()
+
+	for _, n := range nodes {
+		seen := make(map[string]bool)
+
+		for _, m := range n.CacheSnapshot() {
+			seen[fmt.Sprintf("%s/%d", m.Source.Callsign, m.SeqCounter)] = true
+		}
+
+		for _, src := range nodes {
+			for i := 1; i <= perNode; i++ {
+				key := fmt.Sprintf("%s/%d", src.station.Callsign, i)
+				if !seen[key] {
+					t.Errorf("node %s is missing message %s", n.station.Callsign, key)
+				}
+			}
+		}
+	}
+
+	waitFor(t, 5*time.Second, "callbacks to run", func() bool {
+		return atomic.LoadInt64(&received) == int64(len(nodes)*len(nodes)*perNode)
+	})
+
+	sctx, scancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer scancel()
+
+	for _, n := range nodes {
+		if err := n.Shutdown(sctx); err != nil {
+			t.Errorf("Node.Shutdown() error = %v", err)
+		}
+	}
+
+	checkLeaks(t, before)
+}
@@ -2,7 +2,8 @@ package node
 
 import (
 	"errors"
-	"strings"
+	"fmt"
+	"sync"
 
 	"github.com/donothingloop/hamgo/parameters"
 	"github.com/donothingloop/hamgo/protocol"
@@ -11,8 +12,9 @@ import (
 )
 
 type cacheEntry struct {
-	SeqCounter uint64
-	Source     protocol.Contact
+	SeqCounter     uint64
+	Retransmission uint8
+	Source         protocol.Contact
 }
 
 // Logic handles the forwarding of the nodes.
@@ -20,27 +22,99 @@ type Logic struct {
 	settings        parameters.LogicSettings
 	settingsStation parameters.Station
 	cache           []*cacheEntry
+	seen            map[receiptKey]bool
+	seenOrder       []receiptKey
+	cacheLock       sync.Mutex
 	peers           []*Peer
+	peersLock       sync.Mutex
+	filters         *FilterChain
+	role            Role
+	position        *protocol.Position
+	identities      *identities
 	Local           protocol.Contact
 }
 
-func (n *Logic) isMessageCached(msg *protocol.Message) bool {
-	logrus.Debug("Logic: check if message is cached")
+// Peers returns a copy of the current peer list.
+func (n *Logic) Peers() []*Peer {
+	n.peersLock.Lock()
+	defer n.peersLock.Unlock()
+
+	peers := make([]*Peer, len(n.peers))
+	copy(peers, n.peers)
+
+	return peers
+}
+
+// addPeer adds a peer to the peer list.
+func (n *Logic) addPeer(p *Peer) {
+	n.peersLock.Lock()
+	defer n.peersLock.Unlock()
+
+	n.peers = append(n.peers, p)
+}
+
+// removePeer removes a peer from the peer list.
+func (n *Logic) removePeer(p *Peer) {
+	n.peersLock.Lock()
+	defer n.peersLock.Unlock()
+
+	var peers []*Peer
+
+	for _, v := range n.peers {
+		if v != p {
+			peers = append(peers, v)
+		}
+	}
+
+	n.peers = peers
+}
 
+// cacheEntryOf returns the cache entry of the message, the lock must be held.
+func (n *Logic) cacheEntryOf(msg *protocol.Message) *cacheEntry {
 	for _, c := range n.cache {
-		if c.SeqCounter == msg.SeqCounter && c.Source.Compare(&msg.Source) {
-			logrus.Debug("Logic: message is cached")
-			return true
+		if c.SeqCounter == msg.SeqCounter && c.Source.SameCallsign(&msg.Source) {
+			return c
 		}
 	}
 
+	return nil
+}
+
+// isMessageCached checks if the message or a later retransmission of it is
+// cached, the lock must be held.
+func (n *Logic) isMessageCached(msg *protocol.Message) bool {
+	logrus.Debug("Logic: check if message is cached")
+
+	// no-cache messages without sequence counter cannot be told apart
+	if (msg.Flags & protocol.FlagNoCache) != 0 {
+		return msg.SeqCounter != 0 && n.seen[newReceiptKey(msg.Source.Callsign, msg.SeqCounter)]
+	}
+
+	if c := n.cacheEntryOf(msg); c != nil && c.Retransmission >= msg.Retransmission {
+		logrus.Debug("Logic: message is cached")
+		return true
+	}
+
 	logrus.Debug("Logic: message is not cached")
 	return false
 }
 
+// cacheMessage caches the message, the lock must be held.
 func (n *Logic) cacheMessage(msg *protocol.Message) {
+	// only the key of no-cache messages is kept, to relay every one once
 	if (msg.Flags & protocol.FlagNoCache) != 0 {
 		logrus.Debug("Logic: not caching message with no-cache flag")
+		if msg.SeqCounter != 0 {
+			n.markSeen(newReceiptKey(msg.Source.Callsign, msg.SeqCounter))
+		}
+
+		return
+	}
+
+	// retransmissions update the entry of the original message
+	if c := n.cacheEntryOf(msg); c != nil {
+		logrus.Debug("Logic: caching retransmission")
+		c.Retransmission = msg.Retransmission
 		return
 	}
 
@@ -52,44 +126,88 @@ func (n *Logic) cacheMessage(msg *protocol.Message) {
 	logrus.Debug("Logic: caching message")
 
 	n.cache = append(n.cache, &cacheEntry{
-		SeqCounter: msg.SeqCounter,
-		Source:     msg.Source,
+		SeqCounter:     msg.SeqCounter,
+		Retransmission: msg.Retransmission,
+		Source:         msg.Source,
 	})
 }
 
-// SpreadMessage caches a new message and spreads it afterwards.
-func (n *Logic) SpreadMessage(msg *protocol.Message) error {
-	if n.settings.ReadOnly {
-		logrus.Warn("Logic: node is read-only, ignoring spread message")
-		return errors.New("read-only node")
+// markSeen records a no-cache message, the oldest key is dropped if as many
+// keys as cached messages are kept. The lock must be held.
+func (n *Logic) markSeen(key receiptKey) {
+	if n.seen == nil {
+		n.seen = make(map[receiptKey]bool)
+	}
+
+	if uint(len(n.seenOrder)) >= n.settings.CacheSize && len(n.seenOrder) > 0 {
+		delete(n.seen, n.seenOrder[0])
+		n.seenOrder = n.seenOrder[1:]
 	}
 
+	n.seen[key] = true
+	n.seenOrder = append(n.seenOrder, key)
+}
+
+// cacheIfNew caches the message and returns false if it was already cached.
+func (n *Logic) cacheIfNew(msg *protocol.Message) bool {
+	n.cacheLock.Lock()
+	defer n.cacheLock.Unlock()
+
 	if n.isMessageCached(msg) {
+		return false
+	}
+
+	n.cacheMessage(msg)
+	return true
+}
+
+// cached checks if the message is cached.
+func (n *Logic) cached(msg *protocol.Message) bool {
+	n.cacheLock.Lock()
+	defer n.cacheLock.Unlock()
+
+	return n.isMessageCached(msg)
+}
+
+// SpreadMessage caches a new message and spreads it afterwards. The message
+// itself is not modified, as it may be shared with the node cache.
+func (n *Logic) SpreadMessage(msg *protocol.Message) error {
+	if !n.role.Originates() {
+		logrus.Warnf("Logic: %s node does not originate messages, ignoring spread message", n.role)
+		return fmt.Errorf("%s node does not originate messages", n.role)
+	}
+
+	return n.spread(msg)
+}
+
+// spread caches a new message and spreads it regardless of the role.
+func (n *Logic) spread(msg *protocol.Message) error {
+	if n.cached(msg) {
 		return errors.New("message already cached")
 	}
 
 	logrus.Debug("Logic: spreading new message")
 
-	if strings.Contains(msg.Path, n.settingsStation.Callsign) {
-		logrus.Info("Logic: path already contains this station, ignoring pacakge")
+	if n.identities.inPath(msg.Path) {
+		logrus.Info("Logic: path already contains this station, ignoring package")
 		return nil
 	}
 
+	m := *msg
+
 	// append local node to path
-	msg.Path += ";" + n.settingsStation.Callsign
-	msg.PathLength = uint16(len(msg.Path))
+	m.Path += ";" + n.settingsStation.Callsign
+	m.PathLength = uint16(len(m.Path))
 
 	// decrease TTL
-	if msg.TTL != 0 {
-		msg.TTL--
+	if m.TTL != 0 {
+		m.TTL--
 	}
 
-	if !n.isMessageCached(msg) {
-		n.cacheMessage(msg)
-
+	if n.cacheIfNew(&m) {
 		// spread message only if the TTL is above zero
-		if msg.TTL != 0 {
-			n.spreadCachedMessage(msg)
+		if m.TTL != 0 {
+			n.spreadCachedMessage(&m)
 		}
 	} else {
 		logrus.Info("Logic: message to be spread is already cached, ignoring")
@@ -98,18 +216,62 @@ func (n *Logic) SpreadMessage(msg *protocol.Message) error {
 	return nil
 }
 
+// inScope checks if the station forwards a scoped message. The originating
+// station and stations without a configured position always forward it.
+func (n *Logic) inScope(msg *protocol.Message, originated bool) bool {
+	if msg.Scope == nil || n.position == nil || originated {
+		return true
+	}
+
+	return msg.Scope.Contains(n.position)
+}
+
 // spreadCachedMessage spreads a message using the gossip protocol.
 func (n *Logic) spreadCachedMessage(msg *protocol.Message) {
+	// the path of a message originated here only contains this station
+	if !n.inScope(msg, len(pathSegments(msg.Path)) <= 1) {
+		logrus.WithField("locator", n.position.Locator).Debug("Logic: station outside of the message scope, not forwarding")
+		return
+	}
+
 	buf := msg.Bytes()
+	prio := MessagePriority(msg)
+	egress := n.filters.active(StageEgress)
 
 	logrus.Debugf("Logic: spreading cached message\n%+v", msg)
 
-	for _, p := range n.peers {
-		// enqueue the message for the peer to be sent
-		p.QueueMessage(buf)
+	for _, p := range n.Peers() {
+		if !egress {
+			// enqueue the message for the peer to be sent
+			p.QueueMessage(buf, prio)
+			continue
+		}
+
+		// the egress filters work on a copy per peer
+		m := msg.Clone()
+		if !n.filters.run(StageEgress, m, p) {
+			logrus.WithField("peer", peerKey(p)).Debug("Logic: message dropped by egress filter")
+			continue
+		}
+
+		p.QueueMessage(m.Bytes(), MessagePriority(m))
 	}
 }
 
+// relayMessage passes a received message through the relay filters and spreads it.
+func (n *Logic) relayMessage(msg *protocol.Message, src *Peer) {
+	if n.filters.active(StageRelay) {
+		msg = msg.Clone()
+
+		if !n.filters.run(StageRelay, msg, src) {
+			logrus.Debug("Logic: message dropped by relay filter")
+			return
+		}
+	}
+
+	n.spreadCachedMessage(msg)
+}
+
 func (n *Logic) sendACK(msg *protocol.Message) {
 	ack := protocol.ACKPayload{
 		SeqCounter: msg.SeqCounter,
@@ -118,8 +280,8 @@ func (n *Logic) sendACK(msg *protocol.Message) {
 	ackbuf := ack.Bytes()
 
 	pmsg := protocol.Message{
-		Version:    1,
-		SeqCounter: 0,
+		Version:    protocol.Version,
+		SeqCounter: n.identities.list[0].nextSeq(),
 		Flags:      protocol.FlagNoCache,
 		Source:     n.Local,
 
@@ -134,60 +296,36 @@ func (n *Logic) sendACK(msg *protocol.Message) {
 
 	logrus.Debug("Logic: sending ACK")
 
-	// send the ACK
-	n.SpreadMessage(&pmsg)
-}
-
-func pathContainsSegment(path string, segment string) bool {
-	tk := strings.Split(path, ";")
-	for _, t := range tk {
-		logrus.Debugf("Logic: path segment %s ?= %s", t, segment)
-		if t == "" {
-			continue
-		}
-
-		if t == segment {
-			return true
-		}
-	}
-
-	return false
+	// send the ACK, relay nodes acknowledge without originating messages
+	n.spread(&pmsg)
 }
 
-// HandleMessage handles an incoming message from a peer.
-func (n *Logic) HandleMessage(msg []byte) {
-	logrus.Debug("Logic: parsing incoming message")
-
-	// parse the incoming message
-	m, _ := protocol.ParseMessage(msg)
-
+// HandleMessage handles an incoming message from a peer, the message is
+// modified and must not be shared.
+func (n *Logic) HandleMessage(m *protocol.Message, src *Peer) {
 	logrus.Debug("Logic: handling incoming message")
 
-	if pathContainsSegment(m.Path, n.settingsStation.Callsign) {
+	if n.identities.inPath(m.Path) {
 		logrus.Info("Logic: path already contains this station, ignoring package")
 		return
 	}
 
-	// check if the message is not cached and relay it, otherwise ignore it
-	if !n.isMessageCached(m) {
-
-		// append local node to path
-		m.Path += ";" + n.settingsStation.Callsign
-		m.PathLength = uint16(len(m.Path))
-
-		if m.TTL != 0 {
-			m.TTL--
-		}
+	// append local node to path
+	m.Path += ";" + n.settingsStation.Callsign
+	m.PathLength = uint16(len(m.Path))
 
-		// cache message
-		n.cacheMessage(m)
+	if m.TTL != 0 {
+		m.TTL--
+	}
 
-		if m.TTL != 0 {
+	// check if the message is not cached and relay it, otherwise ignore it
+	if n.cacheIfNew(m) {
+		if m.TTL != 0 && n.role.Relays() {
 			// spread the message to peers
-			n.spreadCachedMessage(m)
+			n.relayMessage(m, src)
 		}
 
-		if (m.Flags & protocol.FlagACK) != 0 {
+		if (m.Flags&protocol.FlagACK) != 0 && n.role.Acknowledges() {
 			// send ACK
 			n.sendACK(m)
 		}
@@ -0,0 +1,117 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func TestLogic_cacheIfNew(t *testing.T) {
+	msg := func(seq uint64, flags uint8, retransmission uint8) *protocol.Message {
+		return &protocol.Message{
+			SeqCounter:     seq,
+			Flags:          flags,
+			Retransmission: retransmission,
+			Source:         protocol.Contact{CallsignLength: 6, Callsign: []byte("OE1AAA")},
+		}
+	}
+
+	tests := []struct {
+		name string
+		msgs []*protocol.Message
+		want []bool
+	}{
+		{
+			name: "cached message",
+			msgs: []*protocol.Message{msg(1, 0, 0), msg(1, 0, 0), msg(2, 0, 0)},
+			want: []bool{true, false, true},
+		},
+		{
+			name: "retransmission",
+			msgs: []*protocol.Message{msg(1, 0, 0), msg(1, protocol.FlagRetransmission, 1), msg(1, protocol.FlagRetransmission, 1)},
+			want: []bool{true, true, false},
+		},
+		{
+			name: "no-cache message is relayed once",
+			msgs: []*protocol.Message{msg(1, protocol.FlagNoCache, 0), msg(1, protocol.FlagNoCache, 0), msg(2, protocol.FlagNoCache, 0)},
+			want: []bool{true, false, true},
+		},
+		{
+			name: "no-cache message without sequence",
+			msgs: []*protocol.Message{msg(0, protocol.FlagNoCache, 0), msg(0, protocol.FlagNoCache, 0)},
+			want: []bool{true, true},
+		},
+		{
+			name: "oldest no-cache message is forgotten",
+			msgs: []*protocol.Message{
+				msg(1, protocol.FlagNoCache, 0), msg(2, protocol.FlagNoCache, 0),
+				msg(3, protocol.FlagNoCache, 0), msg(1, protocol.FlagNoCache, 0),
+			},
+			want: []bool{true, true, true, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Logic{settings: parameters.LogicSettings{CacheSize: 2}}
+
+			for i, m := range tt.msgs {
+				if got := l.cacheIfNew(m); got != tt.want[i] {
+					t.Errorf("message %d: cacheIfNew() = %v, want %v", i, got, tt.want[i])
+				}
+			}
+
+			if len(l.cache) > 2 || len(l.seenOrder) > 2 {
+				t.Errorf("cache holds %d messages and %d keys, want at most 2", len(l.cache), len(l.seenOrder))
+			}
+		})
+	}
+}
+
+func TestLogic_SpreadMessage_path(t *testing.T) {
+	ids, err := newIdentities(parameters.Station{Callsign: "OE1AB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters, err := NewFilterChain(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"empty path", "", true},
+		{"callsign with the station as prefix", ";OE1ABC", true},
+		{"station", ";OE1ABC;OE1AB", false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &Logic{
+				settings:   parameters.LogicSettings{CacheSize: 8},
+				role:       RoleFull,
+				filters:    filters,
+				identities: ids,
+			}
+
+			msg := &protocol.Message{
+				SeqCounter: uint64(i + 1),
+				TTL:        255,
+				Source:     protocol.Contact{CallsignLength: 6, Callsign: []byte("OE1XYZ")},
+				Path:       tt.path,
+				PathLength: uint16(len(tt.path)),
+			}
+
+			if err := l.SpreadMessage(msg); err != nil {
+				t.Fatalf("SpreadMessage() error = %v", err)
+			}
+
+			if got := l.cached(msg); got != tt.want {
+				t.Errorf("spread = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
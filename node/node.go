@@ -1,8 +1,12 @@
 package node
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
 	"sync"
+	"time"
 
 	"github.com/donothingloop/hamgo/lib"
 	"github.com/donothingloop/hamgo/parameters"
@@ -13,20 +17,41 @@ import (
 
 // Node is a node in the gossip protocol.
 type Node struct {
-	server      lib.TCPServer
-	settings    parameters.Settings
-	station     parameters.Station
-	peers       []*Peer
-	logic       *Logic
-	close       chan interface{}
-	cbs         []*MessageCallback
-	cbsPeerConn []*PeerConnCallback
-	Cache       []*protocol.Message
-	cacheLock   sync.Mutex
-	Local       protocol.Contact
+	server       lib.TCPServer
+	settings     parameters.Settings
+	station      parameters.Station
+	peers        []*Peer
+	logic        *Logic
+	ctx          context.Context
+	cancel       context.CancelFunc
+	closeOnce    sync.Once
+	cbs          []*MessageCallback
+	cbsPeerConn  []*PeerConnCallback
+	cbsLock      sync.Mutex
+	payloads     map[protocol.PayloadType]*PayloadHandler
+	subs         []*subscription
+	subsLock     sync.Mutex
+	dispatch     dispatcher
+	cache        []*protocol.Message
+	cacheLock    sync.Mutex
+	identifyLock sync.Mutex
+	Local        protocol.Contact
+	shaping      *tokenBucket
+	flood        *floodGuard
+	acl          *ACL
+	events       eventLog
+	receipts     *receiptTracker
+	deliveries   *deliveryTracker
+	topology     *topology
+	position     *protocol.Position
+	directory    *directory
+	services     *serviceRegistry
+	discovery    *discovery
+	identities   *identities
 }
 
 // MessageCallback is a callback that is called when a message was received.
+// The callbacks are called in order from a single goroutine.
 type MessageCallback struct {
 	Cb func(*protocol.Message, *Peer)
 }
@@ -38,11 +63,17 @@ type PeerConnCallback struct {
 
 // AddCallback adds a callback for received messages.
 func (n *Node) AddCallback(cb *MessageCallback) {
+	n.cbsLock.Lock()
+	defer n.cbsLock.Unlock()
+
 	n.cbs = append(n.cbs, cb)
 }
 
 // RemoveCallback removes the callback from the buffer.
 func (n *Node) RemoveCallback(cb *MessageCallback) {
+	n.cbsLock.Lock()
+	defer n.cbsLock.Unlock()
+
 	var cbs []*MessageCallback
 
 	for _, v := range n.cbs {
@@ -56,18 +87,38 @@ func (n *Node) RemoveCallback(cb *MessageCallback) {
 
 // triggerPeerConnected is used to trigger all peer connected callbacks.
 func (n *Node) triggerPeerConnected(peer *Peer) {
-	for _, cb := range n.cbsPeerConn {
+	direction := "outbound"
+	if peer.fromServer {
+		direction = "inbound"
+	}
+
+	peer.raise(EventPeerConnected, "", "peer connected ("+direction+")")
+
+	// announce the identity before anything else is sent
+	n.sendHello(peer)
+
+	n.cbsLock.Lock()
+	cbs := n.cbsPeerConn
+	n.cbsLock.Unlock()
+
+	for _, cb := range cbs {
 		cb.PeerConnected(peer)
 	}
 }
 
 // AddPeerConnCallback adds a peer connected callback.
 func (n *Node) AddPeerConnCallback(cb *PeerConnCallback) {
+	n.cbsLock.Lock()
+	defer n.cbsLock.Unlock()
+
 	n.cbsPeerConn = append(n.cbsPeerConn, cb)
 }
 
 // RemovePeerConnCallback removes a previously added peer connected callback.
 func (n *Node) RemovePeerConnCallback(cb *PeerConnCallback) {
+	n.cbsLock.Lock()
+	defer n.cbsLock.Unlock()
+
 	var cbs []*PeerConnCallback
 
 	for _, v := range n.cbsPeerConn {
@@ -79,23 +130,56 @@ func (n *Node) RemovePeerConnCallback(cb *PeerConnCallback) {
 	n.cbsPeerConn = cbs
 }
 
-// existsInCache checks if a given message exists in the cache.
-func (n *Node) existsInCache(msg *protocol.Message) bool {
+// CacheSnapshot returns a copy of the cached messages. The messages must not
+// be modified.
+func (n *Node) CacheSnapshot() []*protocol.Message {
+	n.cacheLock.Lock()
+	defer n.cacheLock.Unlock()
+
+	return append([]*protocol.Message{}, n.cache...)
+}
+
+// cacheIndex returns the index of a message in the cache or -1 if it is not
+// cached, the lock must be held.
+func (n *Node) cacheIndex(msg *protocol.Message) int {
 	logrus.WithField("msg", msg).Debug("Node: check if message is in cache")
 
-	for _, v := range n.Cache {
-		if (v.SeqCounter == msg.SeqCounter) && v.Source.Compare(&msg.Source) {
+	for i, v := range n.cache {
+		if (v.SeqCounter == msg.SeqCounter) && v.Source.SameCallsign(&msg.Source) {
 			logrus.WithField("msg", msg).Debug("Node: found message in cache")
-			return true
+			return i
 		}
 	}
 
 	logrus.Debug("Node: did not find message in cache")
-	return false
+	return -1
+}
+
+// isCached checks if a message is already in the cache.
+func (n *Node) isCached(msg *protocol.Message) bool {
+	n.cacheLock.Lock()
+	defer n.cacheLock.Unlock()
+
+	return n.cacheIndex(msg) != -1
 }
 
 // AddToCache adds a remote message to the cache.
 func (n *Node) AddToCache(msg *protocol.Message) {
+	if !n.logic.filters.run(StageReceive, msg, nil) {
+		logrus.Debug("Node: message dropped by receive filter, not caching")
+		return
+	}
+
+	if !msg.Source.ValidCallsign() {
+		logrus.Warnf("Node: invalid source callsign %q, not caching", msg.Source.Callsign)
+		return
+	}
+
+	if !n.acl.AllowCallsign(string(msg.Source.Callsign)) {
+		logrus.Debug("Node: source blocked by ACL, not caching")
+		return
+	}
+
 	// append local node to path
 	msg.Path += ";" + n.station.Callsign
 	msg.PathLength = uint16(len(msg.Path))
@@ -105,60 +189,253 @@ func (n *Node) AddToCache(msg *protocol.Message) {
 		msg.TTL--
 	}
 
-	n.pushToCache(msg)
+	if c := n.filterForCache(msg, nil); c != nil && n.pushToCache(c) == cacheNew {
+		n.indexMessage(c)
+	}
+}
+
+// indexMessage adds a new message to the station directory and the service registry.
+func (n *Node) indexMessage(msg *protocol.Message) {
+	if st, ok := n.directory.update(msg); ok && st.Position != nil {
+		n.topology.locate(st.Callsign, *st.Position)
+	}
+
+	n.services.announce(msg)
+}
+
+// filterForCache returns the copy of the message to cache, nil if it was
+// dropped by the cache filters.
+func (n *Node) filterForCache(msg *protocol.Message, src *Peer) *protocol.Message {
+	c := msg.Clone()
+
+	if !n.logic.filters.run(StageCache, c, src) {
+		logrus.Debug("Node: message dropped by cache filter")
+		return nil
+	}
+
+	return c
 }
 
-// pushToCache pushes a message to cache if it does not exist in it
-func (n *Node) pushToCache(msg *protocol.Message) bool {
+// acceptMessage caches the filtered copy of a message and hands it to the
+// handlers. It returns false if the message is already cached, retransmissions
+// of a cached message are accepted but not delivered again.
+func (n *Node) acceptMessage(msg *protocol.Message, src *Peer) bool {
+	c := n.filterForCache(msg, src)
+	if c == nil {
+		return true
+	}
+
+	switch n.pushToCache(c) {
+	case cacheKnown:
+		return false
+	case cacheRetransmission:
+		return true
+	}
+
+	n.dispatch.push(c, src)
+	return true
+}
+
+// cacheResult is the outcome of pushing a message to the cache.
+type cacheResult int
+
+const (
+	// cacheKnown means the message or a later retransmission is already cached
+	cacheKnown cacheResult = iota
+	// cacheNew means the message was not cached before
+	cacheNew
+	// cacheRetransmission means the message is a later retransmission of a cached message
+	cacheRetransmission
+)
+
+// pushToCache pushes a message to cache if it does not exist in it. A later
+// retransmission replaces the cached message.
+func (n *Node) pushToCache(msg *protocol.Message) cacheResult {
 	n.cacheLock.Lock()
 	defer n.cacheLock.Unlock()
 
 	if (msg.Flags & protocol.FlagNoCache) != 0 {
 		logrus.Debug("node: not caching message with no-cache flag")
-		return true
+		return cacheNew
 	}
 
-	if n.existsInCache(msg) {
+	if i := n.cacheIndex(msg); i != -1 {
+		if msg.Retransmission > n.cache[i].Retransmission {
+			logrus.Debug("Node: retransmission of cached message")
+
+			// the cached messages are shared, replace instead of modifying it
+			n.cache[i] = msg
+			return cacheRetransmission
+		}
+
 		logrus.Debug("Node: message already cached, ignoring")
-		return false
+		return cacheKnown
 	}
 
 	// remove first cache entry, if cache is full
-	if uint(len(n.Cache)) == n.settings.LogicSettings.CacheSize && len(n.Cache) > 1 {
-		n.Cache = n.Cache[1:]
+	if uint(len(n.cache)) == n.settings.LogicSettings.CacheSize && len(n.cache) > 1 {
+		n.cache = n.cache[1:]
 	}
 
-	n.Cache = append(n.Cache, msg)
-	return true
+	n.cache = append(n.cache, msg)
+	return cacheNew
 }
 
-// handleCallbacks calls all registered callbacks that hook the received messages.
+// handleCallbacks calls all registered handlers, callbacks and subscribers
+// that hook the received messages.
 func (n *Node) handleCallbacks(msg *protocol.Message, src *Peer) {
 	// call some fixed handlers
 	n.consoleHandler(msg)
+	n.indexMessage(msg)
+	n.handleDiscovery(msg, src)
+	n.handlePayload(msg, src)
 
-	for _, v := range n.cbs {
+	n.cbsLock.Lock()
+	cbs := n.cbs
+	n.cbsLock.Unlock()
+
+	for _, v := range cbs {
 		v.Cb(msg, src)
 	}
+
+	n.notify(msg, src)
 }
 
 // SpreadMessage spreads a message by gossip.
 func (n *Node) SpreadMessage(msg *protocol.Message) error {
-	if n.settings.LogicSettings.ReadOnly {
-		logrus.Warn("Node: node is read-only, ignoring spread message")
-		return errors.New("read-only node")
+	if role := n.logic.role; !role.Originates() {
+		logrus.Warnf("Node: %s node does not originate messages, ignoring spread message", role)
+		return fmt.Errorf("%s node does not originate messages", role)
+	}
+
+	// peers drop messages with an invalid source
+	call, err := protocol.NormalizeCallsign(string(msg.Source.Callsign))
+	if err != nil {
+		return fmt.Errorf("invalid source: %v", err)
+	}
+
+	msg.Source.Callsign = []byte(call)
+	msg.Source.CallsignLength = uint8(len(call))
+
+	if !n.acl.AllowCallsign(string(msg.Source.Callsign)) {
+		return errors.New("source blocked by ACL")
+	}
+
+	if id, ok := n.identities.get(string(msg.Source.Callsign)); ok && !id.allows(msg.PayloadType) {
+		return fmt.Errorf("identity %s does not send payload type %d", id.callsign, msg.PayloadType)
 	}
 
 	// message already cached, ignoring
-	if !n.pushToCache(msg) {
+	if !n.acceptMessage(msg, nil) {
 		return nil
 	}
 
-	go n.handleCallbacks(msg, nil)
+	// record the receipts of messages that request an ACK
+	if (msg.Flags & protocol.FlagACK) != 0 {
+		n.receipts.track(msg)
+	}
 
 	return n.logic.SpreadMessage(msg)
 }
 
+// allowPeer applies the peer rate limit and quarantine to a received message
+// and raises the resulting events.
+func (n *Node) allowPeer(src *Peer) bool {
+	ok, events := n.flood.checkPeer(src)
+
+	for _, e := range events {
+		n.raiseEvent(e)
+	}
+
+	return ok
+}
+
+// allowSource applies the source rate limit to a received message and raises
+// the resulting events. Messages originated locally and copies of cached or
+// already relayed no-cache messages do not count for the source.
+func (n *Node) allowSource(msg *protocol.Message, src *Peer) bool {
+	if src == nil || n.isCached(msg) {
+		return true
+	}
+
+	if (msg.Flags&protocol.FlagNoCache) != 0 && n.logic.cached(msg) {
+		return true
+	}
+
+	ok, events := n.flood.checkSource(msg, src)
+
+	for _, e := range events {
+		n.raiseEvent(e)
+	}
+
+	return ok
+}
+
+// ACL returns the access control lists of the node.
+func (n *Node) ACL() *ACL {
+	return n.acl
+}
+
+// enforceACL closes the links the current access control lists deny, it is
+// called after the rules changed.
+func (n *Node) enforceACL() {
+	for _, p := range n.logic.Peers() {
+		conn := p.Connection()
+		if conn == nil {
+			continue
+		}
+
+		identity := p.Identity()
+		denied := identity != "" && !n.acl.AllowPeer(identity)
+
+		// the networks only apply to inbound connections
+		if !denied && p.fromServer {
+			denied = !n.acl.AllowAddr(conn.Connection.RemoteAddr())
+		}
+
+		if !denied {
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"identity": identity,
+			"host":     p.client.Host,
+		}).Warn("Node: peer blocked by changed ACL, closing connection")
+
+		p.closeConnection(conn, ReasonACL)
+
+		if p.fromServer {
+			n.removePeer(p)
+		}
+	}
+}
+
+// Role returns the role of the node.
+func (n *Node) Role() Role {
+	return n.logic.role
+}
+
+// InScope checks if the local station forwards a cached message, it is false
+// for received messages whose scope does not contain the station.
+func (n *Node) InScope(msg *protocol.Message) bool {
+	return n.logic.inScope(msg, msg.Path == "")
+}
+
+// Position returns the position of the local station, nil if not configured.
+func (n *Node) Position() *protocol.Position {
+	return n.position
+}
+
+// Filters returns the message filter chain of the node.
+func (n *Node) Filters() *FilterChain {
+	return n.logic.filters
+}
+
+// FloodStatus returns the state of the flood protection.
+func (n *Node) FloodStatus() FloodStatus {
+	return n.flood.Status()
+}
+
 // handleMessage handles a message from a peer.
 func (n *Node) handleMessage(msg []byte, src *Peer) {
 	pmsg, _ := protocol.ParseMessage(msg)
@@ -167,31 +444,119 @@ func (n *Node) handleMessage(msg []byte, src *Peer) {
 		return
 	}
 
-	if pathContainsSegment(pmsg.Path, n.station.Callsign) {
+	if !pmsg.Source.ValidCallsign() {
+		logrus.Warnf("Node: invalid source callsign %q, ignoring message", pmsg.Source.Callsign)
+		return
+	}
+
+	// hello messages are never cached or relayed
+	if pmsg.PayloadType == protocol.PayloadHello {
+		n.identifyPeer(src, string(pmsg.Source.Callsign))
+
+		// the identified peer is a direct neighbour
+		if id := src.Identity(); id != "" {
+			n.topology.observe(";" + id)
+		}
+		return
+	}
+
+	if n.identities.inPath(pmsg.Path) {
 		logrus.Info("Node: path already contains this station, ignoring package")
 		return
 	}
 
+	if !n.logic.filters.run(StageReceive, pmsg, src) {
+		logrus.Debug("Node: message dropped by receive filter")
+		return
+	}
+
+	if !n.acl.AllowCallsign(string(pmsg.Source.Callsign)) {
+		logrus.Debug("Node: source blocked by ACL")
+		return
+	}
+
+	if !n.allowPeer(src) {
+		logrus.Debug("Node: message dropped by peer flood protection")
+		return
+	}
+
+	if !n.allowSource(pmsg, src) {
+		logrus.Debug("Node: message dropped by source flood protection")
+		return
+	}
+
 	// message already cached, ignoring
-	if !n.pushToCache(pmsg) {
+	if !n.acceptMessage(pmsg, src) {
 		return
 	}
 
-	go n.handleCallbacks(pmsg, src)
+	n.topology.observe(pmsg.Path)
+	n.logic.HandleMessage(pmsg, src)
+}
+
+// PeerStatus returns the state of all peers of the node.
+func (n *Node) PeerStatus() []PeerStatus {
+	st := []PeerStatus{}
 
-	n.logic.HandleMessage(msg)
+	for _, p := range n.logic.Peers() {
+		st = append(st, p.Status())
+	}
+
+	return st
 }
 
-// Close the node.
+// drainInterval is the interval in which the peer queues are checked on shutdown.
+const drainInterval = 50 * time.Millisecond
+
+// Close the node immediately, queued messages are discarded.
 func (n *Node) Close() {
-	logrus.Debug("Node: closing")
+	n.closeOnce.Do(func() {
+		logrus.Debug("Node: closing")
 
-	// close all peers
-	for _, p := range n.peers {
-		p.Close()
-	}
+		n.cancel()
+		n.server.Stop()
+
+		// close all peers
+		for _, p := range n.logic.Peers() {
+			p.Close()
+		}
+	})
+}
+
+// Shutdown stops accepting connections and waits until the queues of the
+// connected peers are drained or the context expires, then closes the node.
+func (n *Node) Shutdown(ctx context.Context) error {
+	logrus.Debug("Node: shutting down")
 
 	n.server.Stop()
+
+	tick := time.NewTicker(drainInterval)
+	defer tick.Stop()
+
+	for !n.drained() {
+		select {
+		case <-ctx.Done():
+			logrus.Warn("Node: shutdown deadline reached, discarding queued messages")
+			n.Close()
+			return ctx.Err()
+
+		case <-tick.C:
+		}
+	}
+
+	n.Close()
+	return nil
+}
+
+// drained checks if all connected peers have sent their queued messages.
+func (n *Node) drained() bool {
+	for _, p := range n.logic.Peers() {
+		if p.Status().Connected && p.pending() {
+			return false
+		}
+	}
+
+	return true
 }
 
 func (n *Node) peerWorker(p *Peer) {
@@ -199,7 +564,7 @@ func (n *Node) peerWorker(p *Peer) {
 
 	for {
 		select {
-		case <-n.close:
+		case <-n.ctx.Done():
 			logrus.Debug("Node: peerWorker: closing globally")
 			return
 
@@ -212,6 +577,16 @@ func (n *Node) peerWorker(p *Peer) {
 			n.triggerPeerConnected(p)
 			break
 
+		case <-p.disconnected:
+			logrus.Debug("Node: peer disconnected")
+
+			// inbound peers are recreated on the next connection
+			if p.fromServer {
+				n.removePeer(p)
+				return
+			}
+			break
+
 		case msg := <-p.Received:
 			logrus.Debug("Node: message received")
 			n.handleMessage(msg, p)
@@ -226,56 +601,46 @@ func (n *Node) createPeers() {
 
 	for _, v := range n.settings.Peers {
 		p := NewPeer(v.Host, v.Port, n.settings)
+		p.shaper = newShaper(n.settings.Shaping, v.Shaping, n.shaping)
+		p.onEvent = n.raiseEvent
 		n.peers = append(n.peers, p)
+		n.logic.addPeer(p)
 
 		logrus.Debug("Node: starting peer")
 
 		// start the peer worker
 		go n.peerWorker(p)
 
-		// start the peer
+		// start the peer, the reconnect worker establishes the connection
 		p.Start()
-		p.Reconnect()
 	}
 }
 
-func (n *Node) findPeerByConn(conn *lib.Connection) *Peer {
-	for _, p := range n.logic.peers {
-		if p.connection == nil || conn.Connection == nil {
-			continue
-		}
-
-		if p.connection.Connection.RemoteAddr() == conn.Connection.RemoteAddr() {
-			return p
-		}
-	}
-
-	return nil
-}
-
+// handleConnection creates a new peer for an inbound connection. The peer
+// is merged with existing links once it announced its identity.
 func (n *Node) handleConnection(conn *lib.Connection) {
 	logrus.Debug("Node: handling connection")
-	logrus.Debug("Node: searching for existing connections")
-	p := n.findPeerByConn(conn)
 
-	if p == nil {
-		logrus.Info("Node: creating new peer")
-		np := NewPeer(conn.Connection.RemoteAddr().String(), n.settings.Port, n.settings)
-		np.fromServer = true
+	logrus.Info("Node: creating new peer")
+	p := NewPeer(conn.Connection.RemoteAddr().String(), n.settings.Port, n.settings)
+	p.fromServer = true
+	p.shaper = newShaper(n.settings.Shaping, nil, n.shaping)
+	p.onEvent = n.raiseEvent
 
-		// start the peer worker
-		go n.peerWorker(np)
+	// start the peer worker
+	go n.peerWorker(p)
 
-		np.Start()
+	p.Start()
 
-		// set the connection and start the read
-		np.SetConnection(conn)
+	// set the connection and start the read
+	p.SetConnection(conn)
 
-		n.logic.peers = append(n.logic.peers, np)
-		p = np
-	} else {
-		logrus.Debug("Node: setting connections")
-		p.SetConnection(conn)
+	n.logic.addPeer(p)
+
+	// the node may have been closed before the peer was added
+	if n.ctx.Err() != nil {
+		p.Close()
+		return
 	}
 
 	n.triggerPeerConnected(p)
@@ -287,9 +652,9 @@ func (n *Node) connectionWorker() {
 
 	for {
 		select {
-		case <-n.close:
+		case <-n.ctx.Done():
 			logrus.Debug("Node: connectionWorker: closing")
-			break
+			return
 
 		case conn := <-n.server.NewConnection:
 			n.handleConnection(conn)
@@ -298,19 +663,68 @@ func (n *Node) connectionWorker() {
 	}
 }
 
-// NewNode creates a new node.
-func NewNode(settings parameters.Settings, station parameters.Station) (*Node, error) {
+// NewNode creates a new node. The node is closed when the context is done.
+func NewNode(ctx context.Context, settings parameters.Settings, station parameters.Station) (*Node, error) {
 	logrus.Debug("Node: creating new instance")
 
+	acl, err := NewACL(settings.ACL)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := NewFilterChain(settings.LogicSettings.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := roleFromSettings(settings.LogicSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := newPeerQueue(settings); err != nil {
+		return nil, err
+	}
+
+	pos, err := protocol.ResolvePosition(station.Locator, station.Lat, station.Lon)
+	if err != nil {
+		return nil, fmt.Errorf("station position: %v", err)
+	}
+
+	ids, err := newIdentities(station)
+	if err != nil {
+		return nil, err
+	}
+
 	n := &Node{
-		settings: settings,
-		station:  station,
+		settings:   settings,
+		station:    station,
+		position:   pos,
+		shaping:    newTokenBucket(settings.Shaping.Global),
+		flood:      newFloodGuard(settings.Flood),
+		acl:        acl,
+		receipts:   newReceiptTracker(),
+		deliveries: newDeliveryTracker(),
+		topology:   newTopology(station.Callsign, settings.Topology),
+		directory:  newDirectory(station.Callsign, settings.Directory),
+		services:   newServiceRegistry(),
+		discovery:  newDiscovery(),
+		identities: ids,
 		server: lib.TCPServer{
-			Port: settings.Port,
+			Port:   settings.Port,
+			Accept: acl.AllowAddr,
+		},
+		payloads: make(map[protocol.PayloadType]*PayloadHandler),
+		dispatch: dispatcher{
+			signal: make(chan interface{}, 1),
 		},
 		logic: &Logic{
 			settings:        settings.LogicSettings,
 			settingsStation: station,
+			filters:         filters,
+			role:            role,
+			position:        pos,
+			identities:      ids,
 		},
 		Local: protocol.Contact{
 			Type:           protocol.ContactTypeFixed,
@@ -322,17 +736,30 @@ func NewNode(settings parameters.Settings, station parameters.Station) (*Node, e
 	}
 
 	n.logic.Local = n.Local
+	n.ctx, n.cancel = context.WithCancel(ctx)
+	acl.onChange = n.enforceACL
+
+	// the receipts of pending deliveries are needed until they finish
+	n.receipts.pinned = n.deliveries.pending
+
+	if pos != nil {
+		n.topology.locate(station.Callsign, *pos)
+	}
+
+	if err := n.installExtensions(); err != nil {
+		n.cancel()
+		return nil, err
+	}
 
 	return n, nil
 }
 
-// Init the node.
-func (n *Node) Init() error {
-	// create the peer instances
-	n.createPeers()
-
-	// set the peers for the logic
-	n.logic.peers = n.peers
+// Init starts the server and the peers of the node. The node is closed when
+// the context or the context passed to NewNode is done.
+func (n *Node) Init(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	logrus.Debug("Node: starting server")
 	err := n.server.Start()
@@ -344,5 +771,29 @@ func (n *Node) Init() error {
 	// start the connection worker for the server
 	go n.connectionWorker()
 
+	// start delivering the received messages
+	go n.dispatchWorker()
+
+	// remove the stale stations from the topology map
+	go n.topology.run(n.ctx)
+
+	// create the peer instances
+	n.createPeers()
+
+	// close the node with the contexts
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-n.ctx.Done():
+		}
+
+		n.Close()
+	}()
+
 	return nil
 }
+
+// Addr returns the address the node is listening on.
+func (n *Node) Addr() net.Addr {
+	return n.server.Addr()
+}
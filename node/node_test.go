@@ -0,0 +1,378 @@
+package node
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+// freePort returns a currently unused tcp port.
+func freePort(t *testing.T) uint {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find free port: %v", err)
+	}
+	defer l.Close()
+
+	return uint(l.Addr().(*net.TCPAddr).Port)
+}
+
+// testNode creates and starts a node that connects to the given peer ports.
+func testNode(t *testing.T, ctx context.Context, callsign string, peers ...uint) *Node {
+	return testNodeWith(t, ctx, callsign, nil, peers...)
+}
+
+// testNodeWith creates and starts a node with modified settings.
+func testNodeWith(t *testing.T, ctx context.Context, callsign string, modify func(*parameters.Settings, *parameters.Station), peers ...uint) *Node {
+	sett := parameters.Settings{
+		Port:          freePort(t),
+		PeerQueueSize: 64,
+		Retries:       3,
+		Backoff: parameters.BackoffSettings{
+			Initial: 0.05,
+			Max:     0.2,
+		},
+		LogicSettings: parameters.LogicSettings{
+			CacheSize: 64,
+		},
+	}
+
+	for _, p := range peers {
+		sett.Peers = append(sett.Peers, parameters.PeerSettings{
+			Host: "127.0.0.1",
+			Port: p,
+		})
+	}
+
+	station := parameters.Station{Callsign: callsign}
+
+	if modify != nil {
+		modify(&sett, &station)
+	}
+
+	n, err := NewNode(ctx, sett, station)
+	if err != nil {
+		t.Fatalf("NewNode() error = %v", err)
+	}
+
+	if err := n.Init(ctx); err != nil {
+		t.Fatalf("Node.Init() error = %v", err)
+	}
+
+	return n
+}
+
+// waitFor polls the condition until it is true or the timeout is reached.
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func connected(n *Node) bool {
+	for _, p := range n.PeerStatus() {
+		if p.Connected && p.Identity != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func cached(n *Node, seq uint64) bool {
+
+	for _, m := range n.CacheSnapshot() {
+		if m.SeqCounter == seq {
+			return true
+		}
+	}
+
+	return false
+}
+
+func testMessage(n *Node, seq uint64) *protocol.Message {
+	return &protocol.Message{
+		Version:       1,
+		SeqCounter:    seq,
+		TTL:           255,
+		Source:        n.Local,
+		PayloadType:   protocol.PayloadCQ,
+		PayloadLenght: 4,
+		Payload:       []byte("test"),
+	}
+}
+
+// checkLeaks waits for the goroutines to return to the given number and
+// reports the goroutines of this module that are still running.
+func checkLeaks(t *testing.T, before int) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+
+			var leaked []string
+			for _, g := range strings.Split(string(buf), "\n\n") {
+				if strings.Contains(g, "hamgo") {
+					leaked = append(leaked, g)
+				}
+			}
+
+			t.Fatalf("goroutines leaked: %d > %d\n%s", runtime.NumGoroutine(), before, strings.Join(leaked, "\n\n"))
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNode_ShutdownNoLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return connected(a) && connected(b)
+	})
+
+	if err := b.SpreadMessage(testMessage(b, 1)); err != nil {
+		t.Fatalf("SpreadMessage() error = %v", err)
+	}
+
+	waitFor(t, 5*time.Second, "message to arrive", func() bool {
+		return cached(a, 1)
+	})
+
+	sctx, scancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer scancel()
+
+	if err := b.Shutdown(sctx); err != nil {
+		t.Errorf("Node.Shutdown() error = %v", err)
+	}
+
+	if err := a.Shutdown(sctx); err != nil {
+		t.Errorf("Node.Shutdown() error = %v", err)
+	}
+
+	checkLeaks(t, before)
+}
+
+func TestNode_ContextCancelCloses(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return connected(a) && connected(b)
+	})
+
+	cancel()
+
+	checkLeaks(t, before)
+}
+
+func TestNode_Scope(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a - b - c, b is located outside of the scope
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNodeWith(t, ctx, "OE6BBB", func(s *parameters.Settings, st *parameters.Station) {
+		st.Locator = "JN77ta"
+	}, a.settings.Port)
+	c := testNode(t, ctx, "OE1CCC", b.settings.Port)
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return connected(a) && connected(b) && connected(c)
+	})
+
+	scoped := testMessage(a, 1)
+	scoped.Flags = protocol.FlagScope
+	scoped.Scope = &protocol.Scope{Locator: "JN88"}
+
+	if err := a.SpreadMessage(scoped); err != nil {
+		t.Fatalf("SpreadMessage() error = %v", err)
+	}
+
+	if err := a.SpreadMessage(testMessage(a, 2)); err != nil {
+		t.Fatalf("SpreadMessage() error = %v", err)
+	}
+
+	waitFor(t, 5*time.Second, "unscoped message to arrive", func() bool {
+		return cached(c, 2)
+	})
+
+	if !cached(b, 1) {
+		t.Error("station outside of the scope did not receive the scoped message")
+	}
+
+	if cached(c, 1) {
+		t.Error("scoped message was forwarded by a station outside of the scope")
+	}
+
+	if b.InScope(b.CacheSnapshot()[0]) && b.InScope(b.CacheSnapshot()[1]) {
+		t.Error("InScope() = true for all cached messages")
+	}
+}
+
+func TestNode_AddToCacheInvalidSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := testNode(t, ctx, "OE1AAA")
+
+	tests := []struct {
+		name     string
+		callsign string
+		seq      uint64
+		want     bool
+	}{
+		{"valid", "OE1BBB-1", 1, true},
+		{"lower case", "oe1bbb", 2, false},
+		{"invalid", "NOCALL", 3, false},
+		{"empty", "", 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testMessage(n, tt.seq)
+			msg.Source = protocol.Contact{
+				CallsignLength: uint8(len(tt.callsign)),
+				Callsign:       []byte(tt.callsign),
+			}
+
+			n.AddToCache(msg)
+
+			if got := cached(n, tt.seq); got != tt.want {
+				t.Errorf("cached = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNode_SpreadMessageSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n := testNode(t, ctx, "OE1AAA")
+
+	tests := []struct {
+		name     string
+		callsign string
+		length   uint8
+		seq      uint64
+		want     string
+		wantErr  bool
+	}{
+		{"valid", "OE1BBB", 6, 1, "OE1BBB", false},
+		{"lower case", "oe1bbb-1", 8, 2, "OE1BBB-1", false},
+		{"length mismatch", "OE1BBB", 3, 3, "OE1BBB", false},
+		{"SSID zero", "OE1BBB-0", 8, 4, "OE1BBB", false},
+		{"invalid", "NOCALL", 6, 5, "", true},
+		{"empty", "", 0, 6, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := testMessage(n, tt.seq)
+			msg.Source = protocol.Contact{
+				CallsignLength: tt.length,
+				Callsign:       []byte(tt.callsign),
+			}
+
+			err := n.SpreadMessage(msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SpreadMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if cached(n, tt.seq) {
+					t.Error("message with an invalid source was cached")
+				}
+
+				return
+			}
+
+			if !msg.Source.ValidCallsign() || string(msg.Source.Callsign) != tt.want {
+				t.Errorf("source = %q (%d), want %q", msg.Source.Callsign, msg.Source.CallsignLength, tt.want)
+			}
+
+			if !cached(n, tt.seq) {
+				t.Error("message was not cached")
+			}
+		})
+	}
+}
+
+func TestNode_Init(t *testing.T) {
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	done, cancelDone := context.WithCancel(context.Background())
+	cancelDone()
+
+	tests := []struct {
+		name    string
+		port    uint
+		ctx     context.Context
+		wantErr bool
+	}{
+		{"started", freePort(t), context.Background(), false},
+		{"port in use", uint(busy.Addr().(*net.TCPAddr).Port), context.Background(), true},
+		{"context done", freePort(t), done, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			n, err := NewNode(ctx, parameters.Settings{Port: tt.port, LogicSettings: parameters.LogicSettings{CacheSize: 16}}, parameters.Station{Callsign: "OE1AAA"})
+			if err != nil {
+				t.Fatalf("NewNode() error = %v", err)
+			}
+
+			if err := n.Init(tt.ctx); (err != nil) != tt.wantErr {
+				t.Errorf("Node.Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNode_InitContextCloses(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ictx, icancel := context.WithCancel(context.Background())
+
+	n, err := NewNode(context.Background(), parameters.Settings{Port: freePort(t), LogicSettings: parameters.LogicSettings{CacheSize: 16}}, parameters.Station{Callsign: "OE1AAA"})
+	if err != nil {
+		t.Fatalf("NewNode() error = %v", err)
+	}
+
+	if err := n.Init(ictx); err != nil {
+		t.Fatalf("Node.Init() error = %v", err)
+	}
+
+	icancel()
+
+	checkLeaks(t, before)
+}
@@ -1,6 +1,8 @@
 package node
 
 import (
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -11,33 +13,83 @@ import (
 )
 
 // Peer stores a peer of the gossip protocol.
+//
+// The connection state is guarded by connLock, the message in flight and the
+// send tries are owned by the send worker.
 type Peer struct {
-	Settings         parameters.Settings
+	Settings      parameters.Settings
+	queue         *peerQueue
+	shaper        *shaper
+	checkMessages chan interface{}
+	close         chan interface{}
+	reconnected   chan interface{}
+	disconnected  chan interface{}
+	closeOnce     sync.Once
+	sent          chan sendResult
+	Received      chan []byte
+	client        *lib.TCPClient
+	fromServer    bool
+	backoff       *backoff
+	onEvent       func(Event)
+
+	connLock         sync.Mutex
 	connection       *lib.Connection
-	queue            [][]byte
-	checkMessages    chan interface{}
-	close            chan interface{}
 	connActiveClose  chan interface{}
-	reconnected      chan interface{}
-	writeLock        sync.Mutex
-	sendTries        uint
 	connectionActive bool
-	Received         chan []byte
-	client           *lib.TCPClient
-	fromServer       bool
-	checkPending     bool
+	connectedAt      time.Time
+	connInbound      bool
+	closeReason      string
+	inflight         []byte
+	sendTries        uint
+
+	identity     string
+	identityLock sync.Mutex
+}
+
+// sendResult is the result of a write to a connection.
+type sendResult struct {
+	conn *lib.Connection
+	err  error
+}
+
+// PeerStatus describes the current state of a peer.
+type PeerStatus struct {
+	Identity      string        `json:"identity,omitempty"`
+	Host          string        `json:"host"`
+	Port          uint          `json:"port"`
+	Inbound       bool          `json:"inbound"`
+	Connected     bool          `json:"connected"`
+	ConnectedAt   *time.Time    `json:"connectedAt,omitempty"`
+	Failures      uint          `json:"failures"`
+	NextAttempt   *time.Time    `json:"nextAttempt,omitempty"`
+	NextAttemptIn float64       `json:"nextAttemptIn,omitempty"`
+	QueueLength   int           `json:"queueLength"`
+	Queues        []QueueStatus `json:"queues"`
+	Throttled     float64       `json:"throttledSeconds"`
 }
 
 // NewPeer creates a new peer.
 func NewPeer(host string, port uint, settings parameters.Settings) *Peer {
+	queue, err := newPeerQueue(settings)
+	if err != nil {
+		// the settings are validated by the node, fall back to the defaults
+		logrus.WithError(err).Warn("Peer: invalid queue settings, using the defaults")
+		settings.Queues = parameters.QueueSettings{}
+		queue, _ = newPeerQueue(settings)
+	}
+
 	return &Peer{
 		Settings:        settings,
-		checkMessages:   make(chan interface{}, 10),
+		checkMessages:   make(chan interface{}, 1),
 		connActiveClose: make(chan interface{}),
 		reconnected:     make(chan interface{}, 10),
+		disconnected:    make(chan interface{}, 10),
+		sent:            make(chan sendResult, 10),
 		sendTries:       0,
 		Received:        make(chan []byte, 10),
 		close:           make(chan interface{}),
+		backoff:         newBackoff(settings),
+		queue:           queue,
 		client: &lib.TCPClient{
 			Host: host,
 			Port: port,
@@ -45,48 +97,198 @@ func NewPeer(host string, port uint, settings parameters.Settings) *Peer {
 	}
 }
 
-// Close the peer.
+// Status returns the current state of the peer.
+func (p *Peer) Status() PeerStatus {
+	st := PeerStatus{
+		Identity:    p.Identity(),
+		Host:        p.client.Host,
+		Port:        p.client.Port,
+		Inbound:     p.fromServer,
+		QueueLength: p.queue.len(),
+		Queues:      p.queue.status(),
+		Throttled:   p.shaper.Throttled().Seconds(),
+	}
+
+	p.connLock.Lock()
+	st.Connected = p.activeConnection() != nil
+	if st.Connected && !p.connectedAt.IsZero() {
+		at := p.connectedAt
+		st.ConnectedAt = &at
+	}
+	p.connLock.Unlock()
+
+	if p.fromServer {
+		return st
+	}
+
+	failures, next := p.backoff.State()
+	st.Failures = failures
+
+	if !next.IsZero() {
+		st.NextAttempt = &next
+		st.NextAttemptIn = time.Until(next).Seconds()
+
+		if st.NextAttemptIn < 0 {
+			st.NextAttemptIn = 0
+		}
+	}
+
+	return st
+}
+
+// Identity returns the callsign the peer announced, empty if it is not yet known.
+func (p *Peer) Identity() string {
+	p.identityLock.Lock()
+	defer p.identityLock.Unlock()
+
+	return p.identity
+}
+
+func (p *Peer) setIdentity(identity string) {
+	p.identityLock.Lock()
+	defer p.identityLock.Unlock()
+
+	p.identity = identity
+}
+
+// Close the peer and its connection.
 func (p *Peer) Close() {
-	close(p.close)
+	p.closeOnce.Do(func() {
+		close(p.close)
+
+		if conn := p.Connection(); conn != nil {
+			conn.Close()
+		}
+	})
+}
+
+// Connection returns the current connection of the peer, it may be closed or nil.
+func (p *Peer) Connection() *lib.Connection {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+
+	return p.connection
+}
+
+// activeConnection returns the connection if it is active, the lock must be held.
+func (p *Peer) activeConnection() *lib.Connection {
+	if !p.connectionActive || p.connection == nil || p.connection.IsClosed() {
+		return nil
+	}
+
+	return p.connection
+}
+
+// raise reports a lifecycle event of the peer.
+func (p *Peer) raise(t EventType, reason string, msg string) {
+	if p.onEvent == nil {
+		return
+	}
+
+	p.onEvent(Event{
+		Type:    t,
+		Peer:    peerKey(p),
+		Reason:  reason,
+		Message: msg,
+	})
+}
+
+// closeConnection closes the connection and records the reason, if it is the current one.
+func (p *Peer) closeConnection(conn *lib.Connection, reason string) {
+	p.connLock.Lock()
+	if p.connection == conn && p.closeReason == "" {
+		p.closeReason = reason
+	}
+	p.connLock.Unlock()
+
+	conn.Close()
+}
+
+// disconnectReason returns the reason why the current connection was closed.
+func (p *Peer) disconnectReason() string {
+	if p.closed() {
+		return ReasonPeerClosed
+	}
+
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+
+	if p.closeReason != "" {
+		return p.closeReason
+	}
+
+	return ReasonConnectionLost
+}
+
+// signal wakes up the send worker.
+func (p *Peer) signal() {
+	select {
+	case p.checkMessages <- nil:
+	default:
+	}
+}
+
+// closed checks if the peer was closed.
+func (p *Peer) closed() bool {
+	select {
+	case <-p.close:
+		return true
+	default:
+		return false
+	}
 }
 
 func (p *Peer) writeCallback(conn *lib.Connection, err error) {
 	logrus.Debug("Peer: write callback")
 
-	// remove the message from the queue if the send is successful
-	if err == nil {
-		logrus.WithField("queuelen", len(p.queue)).Debug("Peer: queuelen")
+	select {
+	case p.sent <- sendResult{conn: conn, err: err}:
+	case <-p.close:
+	}
+}
 
-		if len(p.queue) == 0 || len(p.queue) == 1 {
-			// clear queue
-			p.queue = [][]byte{}
-		} else {
-			p.queue = p.queue[1:]
-		}
+// handleSendResult releases the message in flight or retries it.
+func (p *Peer) handleSendResult(conn *lib.Connection, err error) {
+	p.connLock.Lock()
 
+	// release the message in flight if the send is successful
+	if err == nil {
+		p.inflight = nil
 		p.sendTries = 0
+		p.connLock.Unlock()
 
-		logrus.WithField("queuelen", len(p.queue)).Debug("Peer: queuelen after")
+		logrus.WithField("queuelen", p.queue.len()).Debug("Peer: queuelen after")
 		logrus.Debug("Peer: message sent successfully, removed from queue")
-	} else {
-		p.sendTries++
-		logrus.Debug("Peer: message not sent successfully, retrying")
+		return
+	}
+
+	p.sendTries++
+	tries := p.sendTries
+	exhausted := p.sendTries > p.Settings.Retries
+	logrus.Debug("Peer: message not sent successfully, retrying")
 
-		if p.sendTries > p.Settings.Retries {
-			logrus.Debug("Peer: maximum number of retrys reached, closing connection")
+	if exhausted {
+		logrus.Debug("Peer: maximum number of retrys reached, closing connection")
 
-			// terminate the connection if it is faulty
-			p.connection.Close()
+		// terminate the connection if it is faulty, the read worker stops on close
+		if p.connection == conn {
 			p.connectionActive = false
 
-			// close the connection read worker
-			close(p.connActiveClose)
+			if p.closeReason == "" {
+				p.closeReason = ReasonRetriesExhausted
+			}
 		}
 
 		p.sendTries = 0
 	}
 
-	p.writeLock.Unlock()
+	p.connLock.Unlock()
+
+	p.raise(EventSendFailed, err.Error(), fmt.Sprintf("failed to send message to peer (try %d)", tries))
+
+	if exhausted {
+		conn.Close()
+	}
 }
 
 // Start the peer worker.
@@ -101,96 +303,225 @@ func (p *Peer) Start() {
 }
 
 // readWorker reads from the stream.
-func (p *Peer) readWorker() {
+func (p *Peer) readWorker(conn *lib.Connection, active chan interface{}) {
 	logrus.Debug("Peer: readWorker: active")
 
 	for {
 		select {
-		case <-p.connActiveClose:
+		case <-active:
 			logrus.Debug("Peer: connActiveClose signalled")
 			return
 
-		case msg := <-p.connection.Received:
+		case <-conn.Done():
+			logrus.Debug("Peer: connection closed")
+
+			// only signal if the connection was not replaced in the meantime
+			if p.Connection() == conn {
+				p.raise(EventPeerDisconnect, p.disconnectReason(), "peer disconnected")
+
+				select {
+				case p.disconnected <- nil:
+				case <-p.close:
+				}
+			}
+			return
+
+		case msg := <-conn.Received:
 			logrus.WithField("msg", msg).Debug("Peer: message received")
-			p.Received <- msg
-			break
+
+			select {
+			case p.Received <- msg:
+			case <-p.close:
+				return
+			}
 		}
 	}
 }
 
 // Reconnect the connection.
-func (p *Peer) Reconnect() {
+func (p *Peer) Reconnect() error {
 	logrus.Info("Peer: reconnecting")
 
 	conn, err := p.client.Start()
 	if err != nil {
 		logrus.WithError(err).Warn("Peer: failed to reconnect")
-		return
+		return err
 	}
 
 	logrus.Debug("Peer: reconnected")
 
-	p.connection = conn
-	p.connectionActive = true
+	if p.closed() {
+		conn.Close()
+		return errors.New("peer closed")
+	}
 
-	p.connActiveClose = make(chan interface{})
+	p.setConnection(conn, false)
 
 	// call the reconnect handlers
-	p.reconnected <- nil
+	select {
+	case p.reconnected <- nil:
+	case <-p.close:
+	}
+
+	return nil
+}
 
-	if !p.checkPending {
-		p.checkPending = true
+// setConnection replaces the connection, closes the previous one and starts
+// the read worker.
+func (p *Peer) setConnection(conn *lib.Connection, inbound bool) {
+	p.connLock.Lock()
 
-		// signal to check new messages
-		p.checkMessages <- nil
+	old := p.connection
+
+	if p.connectionActive {
+		close(p.connActiveClose)
 	}
 
+	p.connection = conn
+	p.connectionActive = true
+	p.connectedAt = time.Now()
+	p.connInbound = inbound
+	p.closeReason = ""
+	p.connActiveClose = make(chan interface{})
+
+	active := p.connActiveClose
+	p.connLock.Unlock()
+
+	if old != nil && old != conn {
+		old.Close()
+	}
+
+	// signal to check new messages
+	p.signal()
+
 	// start the read worker
-	go p.readWorker()
+	go p.readWorker(conn, active)
 }
 
-// SetConnection sets a new connection and initializes the workers.
+// SetConnection sets a new inbound connection and initializes the workers.
+// A previously active connection is closed.
 func (p *Peer) SetConnection(conn *lib.Connection) {
 	logrus.Debug("Peer: setting new connection")
 
+	p.setConnection(conn, true)
+}
+
+// adoptConnection takes over the connection of another peer that turned out
+// to be a duplicate link to the same node.
+func (p *Peer) adoptConnection(other *Peer) {
+	other.connLock.Lock()
+	conn := other.connection
+	inbound := other.connInbound
+	other.connLock.Unlock()
+
+	other.detach()
+
+	if conn != nil {
+		p.setConnection(conn, inbound)
+	}
+}
+
+// detach stops reading from the connection without closing it.
+func (p *Peer) detach() {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+
 	if p.connectionActive {
 		p.connectionActive = false
 		close(p.connActiveClose)
 	}
 
-	p.connection = conn
-	p.connectionActive = true
-	p.connActiveClose = make(chan interface{})
+	p.connection = nil
+}
+
+// connectionState returns the connection and its direction, the connection
+// is nil if it is not active.
+func (p *Peer) connectionState() (*lib.Connection, bool) {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+
+	return p.activeConnection(), p.connInbound
+}
+
+// connectedSince returns the time the current connection was set.
+func (p *Peer) connectedSince() time.Time {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+
+	return p.connectedAt
+}
+
+// connectionLost marks the connection as inactive if it is still the current
+// one and returns the time it was up.
+func (p *Peer) connectionLost(conn *lib.Connection) (time.Duration, bool) {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
 
-	if !p.checkPending {
-		p.checkPending = true
-		p.checkMessages <- nil
+	if p.connection != conn {
+		return 0, false
 	}
 
-	go p.readWorker()
+	p.connectionActive = false
+	return time.Since(p.connectedAt), true
 }
 
 // reconnectWorker handles the reconnecting of the connection.
+// Failed attempts are retried with an exponential backoff, the backoff
+// is reset once a connection stayed up for the configured stable time.
 func (p *Peer) reconnectWorker() {
-	recon := time.Tick(time.Duration(p.Settings.ReconnectTimeout) * time.Second)
+	// the first attempt is made right away
+	first := true
 
 	for {
+		// wait for the active connection to drop
+		if conn, _ := p.connectionState(); conn != nil {
+			select {
+			case <-p.close:
+				logrus.Debug("Peer: reconnect worker closed")
+				return
+
+			case <-conn.Done():
+				// the connection may have been replaced by a merged link
+				if up, ok := p.connectionLost(conn); ok {
+					p.backoff.Disconnected(up)
+					logrus.Info("Peer: connection lost")
+				}
+			}
+
+			continue
+		}
+
+		delay := time.Duration(0)
+		if !first {
+			delay = p.backoff.Next()
+		}
+		first = false
+
+		failures, _ := p.backoff.State()
+
+		logrus.WithFields(logrus.Fields{
+			"host":     p.client.Host,
+			"delay":    delay,
+			"failures": failures,
+		}).Debug("Peer: scheduling reconnect")
+
 		select {
 		case <-p.close:
 			logrus.Debug("Peer: reconnect worker closed")
 			return
 
-		case <-recon:
-			if p.connection != nil && p.connection.Closed {
-				p.connectionActive = false
-			}
+		case <-time.After(delay):
+		}
 
-			if !p.connectionActive {
-				logrus.Debug("Peer: reconnect timer tick")
-				p.Reconnect()
-			}
-			break
+		p.raise(EventReconnecting, "", fmt.Sprintf("reconnecting to peer (attempt %d)", failures+1))
+
+		if err := p.Reconnect(); err != nil {
+			p.raise(EventReconnectFailed, err.Error(), "failed to reconnect to peer")
+			p.backoff.Failure()
+			continue
 		}
+
+		p.backoff.Connected()
 	}
 }
 
@@ -198,57 +529,138 @@ func (p *Peer) reconnectWorker() {
 func (p *Peer) worker() {
 	for {
 		for {
-			p.writeLock.Lock()
+			conn, _ := p.connectionState()
 
 			// if the connection is not active anymore, wait for a checkMessages signal
-			if !p.connectionActive {
-				p.writeLock.Unlock()
+			if conn == nil {
 				logrus.Debug("Peer: worker: connection not active")
 				break
 			}
 
-			// if the queue is empty, wait for the signal
-			if len(p.queue) == 0 {
-				p.writeLock.Unlock()
-				logrus.Debug("Peer: worker: queue is empty")
-				break
+			p.connLock.Lock()
+			inflight := p.inflight
+			p.connLock.Unlock()
+
+			// take the next message by priority, unless a failed one is still pending
+			if inflight == nil {
+				next, prio, ok := p.queue.peek()
+				if !ok {
+					logrus.Debug("Peer: worker: queue is empty")
+					break
+				}
+
+				// wait for the shaper, a message of higher priority may be queued meanwhile
+				if d := p.shaper.delay(len(next), prio); d > 0 {
+					if !p.throttle(d) {
+						return
+					}
+					continue
+				}
+
+				buf, prio, _ := p.queue.pop()
+				p.shaper.take(len(buf), prio)
+				inflight = buf
+
+				p.connLock.Lock()
+				p.inflight = buf
+				p.connLock.Unlock()
 			}
 
 			msg := &lib.Message{
-				Data:     p.queue[0],
+				Data:     inflight,
 				Callback: p.writeCallback,
 			}
 
-			logrus.Debug("Peer: worker: acquiring lock")
-
 			logrus.Debug("Peer: worker: sending message")
-			p.connection.Send <- msg
+
+			select {
+			case conn.Send <- msg:
+			case <-conn.Done():
+				continue
+			case <-p.close:
+				return
+			}
+
+			if !p.waitSent(conn) {
+				return
+			}
 		}
 
 		logrus.Debug("Peer: worker: waiting for signal")
 
 		// wait for a signal
-		<-p.checkMessages
-
-		p.checkPending = false
+		select {
+		case <-p.checkMessages:
+		case <-p.close:
+			logrus.Debug("Peer: worker: closed")
+			return
+		}
 	}
 }
 
-// QueueMessage queues a message to be sent to the peer.
-func (p *Peer) QueueMessage(msg []byte) {
-	if uint(len(p.queue)) >= p.Settings.PeerQueueSize {
-		logrus.Warn("Peer: peer queue full, dropping oldest message")
-		p.queue = p.queue[1:]
+// waitSent waits for the result of a send and returns false if the peer was
+// closed. If the connection drops, the message stays in flight for the next one.
+func (p *Peer) waitSent(conn *lib.Connection) bool {
+	for {
+		select {
+		case r := <-p.sent:
+			// ignore late results of previous connections
+			if r.conn != conn {
+				continue
+			}
+
+			p.handleSendResult(conn, r.err)
+			return true
+
+		case <-conn.Done():
+			return true
+
+		case <-p.close:
+			return false
+		}
 	}
+}
 
-	p.queue = append(p.queue, msg)
+// pending checks if messages are waiting to be sent.
+func (p *Peer) pending() bool {
+	p.connLock.Lock()
+	inflight := p.inflight
+	p.connLock.Unlock()
 
-	logrus.WithField("msg", msg).Debug("Peer: queued peer message")
+	return inflight != nil || p.queue.len() != 0
+}
 
-	if !p.checkPending {
-		p.checkPending = true
+// throttle waits for the shaper and returns false if the peer was closed meanwhile.
+func (p *Peer) throttle(d time.Duration) bool {
+	logrus.WithField("delay", d).Debug("Peer: worker: throttled")
 
-		// send the check signal
-		p.checkMessages <- nil
+	start := time.Now()
+	defer func() {
+		p.shaper.addThrottled(time.Since(start))
+	}()
+
+	select {
+	case <-p.close:
+		return false
+
+	case <-time.After(d):
+		return true
+	}
+}
+
+// QueueMessage queues a message to be sent to the peer in the given priority class.
+func (p *Peer) QueueMessage(msg []byte, prio Priority) {
+	ok, started := p.queue.push(msg, prio)
+	if !ok {
+		logrus.WithField("class", prio).Debug("Peer: peer queue full, dropping message")
 	}
+
+	if started {
+		p.raise(EventQueueOverflow, prio.String(), "peer queue full, dropping messages")
+	}
+
+	logrus.WithField("msg", msg).Debug("Peer: queued peer message")
+
+	// send the check signal
+	p.signal()
 }
@@ -0,0 +1,213 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+// Priority defines the send priority class of a message.
+type Priority uint8
+
+// Priority classes, lower values are sent first.
+const (
+	PriorityHigh Priority = iota
+	PriorityNormal
+	PriorityBulk
+
+	numPriorities
+)
+
+// Drop policies for full queues.
+const (
+	DropOldest = "oldest"
+	DropNewest = "newest"
+)
+
+var priorityNames = [numPriorities]string{"high", "normal", "bulk"}
+
+// String returns the name of the priority class.
+func (p Priority) String() string {
+	if p >= numPriorities {
+		return "unknown"
+	}
+
+	return priorityNames[p]
+}
+
+// MessagePriority derives the priority class of a message from the header
+// flags or, if no explicit priority is set, from the payload type.
+func MessagePriority(msg *protocol.Message) Priority {
+	if (msg.Flags & protocol.FlagPriorityHigh) != 0 {
+		return PriorityHigh
+	}
+
+	if (msg.Flags & protocol.FlagPriorityBulk) != 0 {
+		return PriorityBulk
+	}
+
+	switch msg.PayloadType {
+	case protocol.PayloadMessengerEmergency, protocol.PayloadAck, protocol.PayloadHello:
+		return PriorityHigh
+
+	case protocol.PayloadUpd:
+		return PriorityBulk
+	}
+
+	return PriorityNormal
+}
+
+// QueueStatus describes the state of a priority class of a peer queue.
+type QueueStatus struct {
+	Class   string `json:"class"`
+	Length  int    `json:"length"`
+	Size    uint   `json:"size"`
+	Dropped uint64 `json:"dropped"`
+}
+
+type queueClass struct {
+	items      [][]byte
+	size       uint
+	dropOldest bool
+	dropped    uint64
+	overflow   bool
+}
+
+// peerQueue is an outbound queue with a FIFO per priority class.
+type peerQueue struct {
+	classes [numPriorities]*queueClass
+	lock    sync.Mutex
+}
+
+func newQueueClass(s parameters.QueueClassSettings, def uint) (*queueClass, error) {
+	size := s.Size
+	if size == 0 {
+		size = def
+	}
+
+	c := &queueClass{size: size}
+
+	switch s.Drop {
+	case "", DropOldest:
+		c.dropOldest = true
+	case DropNewest:
+	default:
+		return nil, fmt.Errorf("unknown drop policy %q", s.Drop)
+	}
+
+	return c, nil
+}
+
+func newPeerQueue(settings parameters.Settings) (*peerQueue, error) {
+	q := &peerQueue{}
+
+	for i, s := range []parameters.QueueClassSettings{settings.Queues.High, settings.Queues.Normal, settings.Queues.Bulk} {
+		c, err := newQueueClass(s, settings.PeerQueueSize)
+		if err != nil {
+			return nil, fmt.Errorf("%s queue: %v", Priority(i), err)
+		}
+
+		q.classes[i] = c
+	}
+
+	return q, nil
+}
+
+// push adds a message to the class of the given priority and returns false
+// if a message had to be dropped. The second value is true if the class just
+// started to overflow.
+func (q *peerQueue) push(msg []byte, prio Priority) (bool, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if prio >= numPriorities {
+		prio = PriorityNormal
+	}
+
+	c := q.classes[prio]
+
+	if uint(len(c.items)) >= c.size {
+		c.dropped++
+
+		started := !c.overflow
+		c.overflow = true
+
+		if c.dropOldest && len(c.items) != 0 {
+			c.items = c.items[1:]
+			c.items = append(c.items, msg)
+		}
+
+		return false, started
+	}
+
+	c.overflow = false
+	c.items = append(c.items, msg)
+	return true, false
+}
+
+// pop removes the next message, highest priority first.
+func (q *peerQueue) pop() ([]byte, Priority, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, c := range q.classes {
+		if len(c.items) == 0 {
+			continue
+		}
+
+		msg := c.items[0]
+		c.items[0] = nil
+		c.items = c.items[1:]
+
+		return msg, Priority(i), true
+	}
+
+	return nil, 0, false
+}
+
+// peek returns the next message without removing it.
+func (q *peerQueue) peek() ([]byte, Priority, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, c := range q.classes {
+		if len(c.items) != 0 {
+			return c.items[0], Priority(i), true
+		}
+	}
+
+	return nil, 0, false
+}
+
+// len returns the number of queued messages in all classes.
+func (q *peerQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	l := 0
+	for _, c := range q.classes {
+		l += len(c.items)
+	}
+
+	return l
+}
+
+// status returns the state of all classes.
+func (q *peerQueue) status() []QueueStatus {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	st := []QueueStatus{}
+	for i, c := range q.classes {
+		st = append(st, QueueStatus{
+			Class:   Priority(i).String(),
+			Length:  len(c.items),
+			Size:    c.size,
+			Dropped: c.dropped,
+		})
+	}
+
+	return st
+}
@@ -0,0 +1,81 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+func Test_newPeerQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		queues  parameters.QueueSettings
+		wantErr bool
+	}{
+		{"defaults", parameters.QueueSettings{}, false},
+		{"known policies", parameters.QueueSettings{
+			High: parameters.QueueClassSettings{Drop: DropNewest},
+			Bulk: parameters.QueueClassSettings{Drop: DropOldest},
+		}, false},
+		{"unknown policy", parameters.QueueSettings{
+			Bulk: parameters.QueueClassSettings{Drop: "random"},
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newPeerQueue(parameters.Settings{PeerQueueSize: 2, Queues: tt.queues})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newPeerQueue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_peerQueue_drop(t *testing.T) {
+	// every class holds two messages, three are pushed to each
+	queues := parameters.QueueSettings{
+		High:   parameters.QueueClassSettings{Drop: DropNewest},
+		Normal: parameters.QueueClassSettings{Drop: DropOldest},
+		Bulk:   parameters.QueueClassSettings{Size: 1},
+	}
+
+	q, err := newPeerQueue(parameters.Settings{PeerQueueSize: 2, Queues: queues})
+	if err != nil {
+		t.Fatalf("newPeerQueue() error = %v", err)
+	}
+
+	for _, prio := range []Priority{PriorityBulk, PriorityNormal, PriorityHigh} {
+		for _, m := range []string{"1", "2", "3"} {
+			q.push([]byte(prio.String()+m), prio)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		prio    Priority
+		dropped uint64
+	}{
+		{"newest dropped", "high1", PriorityHigh, 1},
+		{"newest dropped", "high2", PriorityHigh, 1},
+		{"oldest dropped", "normal2", PriorityNormal, 1},
+		{"oldest dropped", "normal3", PriorityNormal, 1},
+		{"default policy and own size", "bulk3", PriorityBulk, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if d := q.status()[tt.prio].Dropped; d != tt.dropped {
+				t.Errorf("dropped = %d, want %d", d, tt.dropped)
+			}
+
+			msg, prio, ok := q.pop()
+			if !ok || string(msg) != tt.want || prio != tt.prio {
+				t.Errorf("pop() = %s, %v, %v, want %s, %v", msg, prio, ok, tt.want, tt.prio)
+			}
+		})
+	}
+
+	if _, _, ok := q.pop(); ok {
+		t.Error("pop() of an empty queue succeeded")
+	}
+}
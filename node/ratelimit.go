@@ -0,0 +1,244 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+// rateLimiterPrune is the number of keys after which idle buckets are removed.
+const rateLimiterPrune = 1024
+
+// rateLimiter limits the message rate per key.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	limited map[string]bool
+	lock    sync.Mutex
+}
+
+func newRateLimiter(s parameters.RateLimitSettings) *rateLimiter {
+	if s.Rate <= 0 {
+		return nil
+	}
+
+	burst := float64(s.Burst)
+	if burst < 1 {
+		burst = s.Rate
+	}
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimiter{
+		rate:    s.Rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+		limited: make(map[string]bool),
+	}
+}
+
+// allow checks if a message for the key is allowed. The second value is true
+// if the key just started to be limited.
+func (r *rateLimiter) allow(key string) (bool, bool) {
+	if r == nil {
+		return true, false
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	b, ok := r.buckets[key]
+	if !ok {
+		if len(r.buckets) >= rateLimiterPrune {
+			r.prune()
+		}
+
+		b = newBucket(r.rate, r.burst)
+		r.buckets[key] = b
+	}
+
+	if b.allow(1) {
+		delete(r.limited, key)
+		return true, false
+	}
+
+	started := !r.limited[key]
+	r.limited[key] = true
+
+	return false, started
+}
+
+// prune removes the buckets that are full again, the lock must be held.
+func (r *rateLimiter) prune() {
+	for k, b := range r.buckets {
+		if b.full() {
+			delete(r.buckets, k)
+			delete(r.limited, k)
+		}
+	}
+}
+
+// FloodStatus describes the state of the flood protection.
+type FloodStatus struct {
+	DroppedSource     uint64               `json:"droppedSource"`
+	DroppedPeer       uint64               `json:"droppedPeer"`
+	DroppedQuarantine uint64               `json:"droppedQuarantine"`
+	Quarantined       map[string]time.Time `json:"quarantined"`
+}
+
+// floodGuard protects the node from misbehaving sources and peers.
+type floodGuard struct {
+	settings   parameters.FloodSettings
+	source     *rateLimiter
+	peer       *rateLimiter
+	drops      map[string]uint
+	quarantine map[string]time.Time
+	status     FloodStatus
+	lock       sync.Mutex
+}
+
+func newFloodGuard(s parameters.FloodSettings) *floodGuard {
+	return &floodGuard{
+		settings:   s,
+		source:     newRateLimiter(s.Source),
+		peer:       newRateLimiter(s.Peer),
+		drops:      make(map[string]uint),
+		quarantine: make(map[string]time.Time),
+	}
+}
+
+// peerKey returns the key that identifies a peer for the rate limits. Peers
+// that did not identify yet are keyed by their address without the port, so
+// a quarantined peer cannot escape by reconnecting.
+func peerKey(p *Peer) string {
+	if p == nil {
+		return ""
+	}
+
+	if id := p.Identity(); id != "" {
+		return id
+	}
+
+	if host, _, err := net.SplitHostPort(p.client.Host); err == nil {
+		return host
+	}
+
+	return p.client.Host
+}
+
+// checkPeer decides if a message received from a peer may be processed and
+// returns the events to raise. Every copy of a message counts for the peer.
+func (f *floodGuard) checkPeer(src *Peer) (bool, []Event) {
+	pk := peerKey(src)
+	if pk == "" {
+		return true, nil
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if until, ok := f.quarantine[pk]; ok {
+		if time.Now().Before(until) {
+			f.status.DroppedQuarantine++
+			return false, nil
+		}
+
+		delete(f.quarantine, pk)
+	}
+
+	ok, started := f.peer.allow(pk)
+	if ok {
+		delete(f.drops, pk)
+		return true, nil
+	}
+
+	f.status.DroppedPeer++
+
+	var events []Event
+	if started {
+		events = append(events, Event{
+			Type:    EventRateLimited,
+			Peer:    pk,
+			Message: "peer exceeded the message rate limit",
+		})
+	}
+
+	return false, append(events, f.dropped(pk)...)
+}
+
+// checkSource decides if a message that is not cached yet may be processed
+// and returns the events to raise. The relaying peer is only reported, drops
+// of a source never count towards the quarantine of the peer. Locally
+// originated messages are passed with a nil peer.
+func (f *floodGuard) checkSource(msg *protocol.Message, src *Peer) (bool, []Event) {
+	source := string(msg.Source.Callsign)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ok, started := f.source.allow(source)
+	if ok {
+		return true, nil
+	}
+
+	f.status.DroppedSource++
+
+	if !started {
+		return false, nil
+	}
+
+	return false, []Event{{
+		Type:    EventRateLimited,
+		Peer:    peerKey(src),
+		Source:  source,
+		Message: "source exceeded the message rate limit",
+	}}
+}
+
+// dropped counts a drop for the peer and quarantines it if the limit is
+// reached, the lock must be held.
+func (f *floodGuard) dropped(pk string) []Event {
+	if f.settings.QuarantineDrops == 0 {
+		return nil
+	}
+
+	f.drops[pk]++
+	if f.drops[pk] < f.settings.QuarantineDrops {
+		return nil
+	}
+
+	delete(f.drops, pk)
+
+	d := time.Duration(f.settings.QuarantineTime) * time.Second
+	f.quarantine[pk] = time.Now().Add(d)
+
+	return []Event{{
+		Type:    EventQuarantined,
+		Peer:    pk,
+		Message: fmt.Sprintf("peer quarantined for %s", d),
+	}}
+}
+
+// Status returns the counters and quarantined peers.
+func (f *floodGuard) Status() FloodStatus {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	st := f.status
+	st.Quarantined = make(map[string]time.Time)
+
+	for k, v := range f.quarantine {
+		if time.Now().Before(v) {
+			st.Quarantined[k] = v
+		}
+	}
+
+	return st
+}
@@ -0,0 +1,295 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func Test_peerKey(t *testing.T) {
+	identified := NewPeer("127.0.0.1:40001", 9124, parameters.Settings{})
+	identified.setIdentity("OE1AAA")
+
+	tests := []struct {
+		name string
+		peer *Peer
+		want string
+	}{
+		{"local", nil, ""},
+		{"identified", identified, "OE1AAA"},
+		{"inbound", NewPeer("44.143.0.1:40002", 9124, parameters.Settings{}), "44.143.0.1"},
+		{"inbound IPv6", NewPeer("[2001:db8::1]:40003", 9124, parameters.Settings{}), "2001:db8::1"},
+		{"outbound", NewPeer("peer.example.org", 9124, parameters.Settings{}), "peer.example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peerKey(tt.peer); got != tt.want {
+				t.Errorf("peerKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_floodGuard(t *testing.T) {
+	msg := func(call string) *protocol.Message {
+		return &protocol.Message{
+			Source: protocol.Contact{CallsignLength: uint8(len(call)), Callsign: []byte(call)},
+		}
+	}
+
+	// step is a message received from a peer, a nil message only checks the peer
+	type step struct {
+		peer string
+		msg  *protocol.Message
+		want bool
+	}
+
+	tests := []struct {
+		name      string
+		settings  parameters.FloodSettings
+		steps     []step
+		want      FloodStatus
+		wantQuar  []string
+		wantEvent []EventType
+	}{
+		{
+			name:  "unlimited",
+			steps: []step{{"10.0.0.1:1000", msg("OE1AAA"), true}, {"10.0.0.1:1000", msg("OE1AAA"), true}},
+		},
+		{
+			name:     "source burst",
+			settings: parameters.FloodSettings{Source: parameters.RateLimitSettings{Rate: 0.001, Burst: 2}},
+			steps: []step{
+				{"", msg("OE1AAA"), true},
+				{"", msg("OE1AAA"), true},
+				{"", msg("OE1AAA"), false},
+				{"", msg("OE1AAA"), false},
+				{"", msg("OE1BBB"), true},
+			},
+			want:      FloodStatus{DroppedSource: 2},
+			wantEvent: []EventType{EventRateLimited},
+		},
+		{
+			name: "source drops do not quarantine the peer",
+			settings: parameters.FloodSettings{
+				Source:          parameters.RateLimitSettings{Rate: 0.001, Burst: 1},
+				QuarantineDrops: 1,
+				QuarantineTime:  60,
+			},
+			steps: []step{
+				{"10.0.0.1:1000", msg("OE1AAA"), true},
+				{"10.0.0.1:1000", msg("OE1AAA"), false},
+				{"10.0.0.1:1000", msg("OE1AAA"), false},
+				{"10.0.0.1:1000", msg("OE1BBB"), true},
+			},
+			want:      FloodStatus{DroppedSource: 2},
+			wantEvent: []EventType{EventRateLimited},
+		},
+		{
+			name:     "peer burst",
+			settings: parameters.FloodSettings{Peer: parameters.RateLimitSettings{Rate: 0.001, Burst: 2}},
+			steps: []step{
+				{"10.0.0.1:1000", nil, true},
+				{"10.0.0.1:1000", nil, true},
+				{"10.0.0.1:1000", nil, false},
+				{"10.0.0.2:1000", nil, true},
+				{"", nil, true},
+			},
+			want:      FloodStatus{DroppedPeer: 1},
+			wantEvent: []EventType{EventRateLimited},
+		},
+		{
+			name: "peer quarantine survives a reconnect",
+			settings: parameters.FloodSettings{
+				Peer:            parameters.RateLimitSettings{Rate: 0.001, Burst: 1},
+				QuarantineDrops: 2,
+				QuarantineTime:  60,
+			},
+			steps: []step{
+				{"10.0.0.1:1000", nil, true},
+				{"10.0.0.1:1000", nil, false},
+				{"10.0.0.1:1000", nil, false},
+				{"10.0.0.1:1001", nil, false},
+				{"10.0.0.2:1000", nil, true},
+			},
+			want:      FloodStatus{DroppedPeer: 2, DroppedQuarantine: 1},
+			wantQuar:  []string{"10.0.0.1"},
+			wantEvent: []EventType{EventRateLimited, EventQuarantined},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFloodGuard(tt.settings)
+			events := []EventType{}
+
+			for i, s := range tt.steps {
+				var p *Peer
+				if s.peer != "" {
+					p = NewPeer(s.peer, 9124, parameters.Settings{})
+				}
+
+				ok, evs := f.checkPeer(p)
+				if ok && s.msg != nil {
+					var sevs []Event
+					ok, sevs = f.checkSource(s.msg, p)
+					evs = append(evs, sevs...)
+				}
+
+				if ok != s.want {
+					t.Errorf("step %d: allowed = %v, want %v", i, ok, s.want)
+				}
+
+				for _, e := range evs {
+					events = append(events, e.Type)
+				}
+			}
+
+			st := f.Status()
+			if st.DroppedSource != tt.want.DroppedSource || st.DroppedPeer != tt.want.DroppedPeer ||
+				st.DroppedQuarantine != tt.want.DroppedQuarantine {
+				t.Errorf("Status() = %+v, want %+v", st, tt.want)
+			}
+
+			if len(st.Quarantined) != len(tt.wantQuar) {
+				t.Errorf("quarantined = %v, want %v", st.Quarantined, tt.wantQuar)
+			}
+
+			for _, k := range tt.wantQuar {
+				if _, ok := st.Quarantined[k]; !ok {
+					t.Errorf("peer %s not quarantined", k)
+				}
+			}
+
+			if len(events) != len(tt.wantEvent) {
+				t.Fatalf("events = %v, want %v", events, tt.wantEvent)
+			}
+
+			for i := range events {
+				if events[i] != tt.wantEvent[i] {
+					t.Errorf("events = %v, want %v", events, tt.wantEvent)
+				}
+			}
+		})
+	}
+}
+
+func TestNode_FloodRelay(t *testing.T) {
+	const burst = 5
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a - b - d and a - c - d, only d limits the sources and quarantines
+	// after the first drop
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+	c := testNode(t, ctx, "OE1CCC", a.settings.Port)
+	d := testNodeWith(t, ctx, "OE1DDD", func(s *parameters.Settings, st *parameters.Station) {
+		s.Flood = parameters.FloodSettings{
+			Source:          parameters.RateLimitSettings{Rate: 0.001, Burst: burst},
+			QuarantineDrops: 1,
+			QuarantineTime:  60,
+		}
+	}, b.settings.Port, c.settings.Port)
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return len(a.PeerStatus()) == 2 && len(d.PeerStatus()) == 2 &&
+			connected(a) && connected(b) && connected(c) && connected(d)
+	})
+
+	// every message reaches d twice, the copies must not use up the burst
+	for i := uint64(1); i <= burst; i++ {
+		if err := a.SpreadMessage(testMessage(a, i)); err != nil {
+			t.Fatalf("SpreadMessage() error = %v", err)
+		}
+	}
+
+	waitFor(t, 5*time.Second, "messages within the burst to arrive", func() bool {
+		return len(d.CacheSnapshot()) == burst
+	})
+
+	// exceed the limit of the source
+	if err := a.SpreadMessage(testMessage(a, burst+1)); err != nil {
+		t.Fatalf("SpreadMessage() error = %v", err)
+	}
+
+	waitFor(t, 5*time.Second, "source to be limited", func() bool {
+		return d.FloodStatus().DroppedSource > 0
+	})
+
+	if st := d.FloodStatus(); len(st.Quarantined) != 0 {
+		t.Errorf("relays quarantined for forwarding a limited source: %v", st.Quarantined)
+	}
+
+	// both relays are still accepted
+	for i, relay := range []*Node{b, c} {
+		seq := uint64(100 + i)
+		if err := relay.SpreadMessage(testMessage(relay, seq)); err != nil {
+			t.Fatalf("SpreadMessage() error = %v", err)
+		}
+
+		waitFor(t, 5*time.Second, "message of the relay to arrive", func() bool {
+			return cached(d, seq)
+		})
+	}
+
+	if cached(d, burst+1) {
+		t.Error("message exceeding the source limit was cached")
+	}
+}
+
+func TestNode_allowSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the budget of a source is a single message
+	n, err := NewNode(ctx, parameters.Settings{
+		Flood:         parameters.FloodSettings{Source: parameters.RateLimitSettings{Rate: 0.001, Burst: 1}},
+		LogicSettings: parameters.LogicSettings{CacheSize: 16},
+	}, parameters.Station{Callsign: "OE1AAA"})
+	if err != nil {
+		t.Fatalf("NewNode() error = %v", err)
+	}
+
+	peer := NewPeer("127.0.0.1:40001", 9124, parameters.Settings{})
+	msg := func(seq uint64, flags uint8) *protocol.Message {
+		return &protocol.Message{
+			SeqCounter: seq,
+			Flags:      flags,
+			Source:     protocol.Contact{CallsignLength: 6, Callsign: []byte("OE1BBB")},
+		}
+	}
+
+	tests := []struct {
+		name string
+		msg  *protocol.Message
+		src  *Peer
+		// relayed marks the message as handled by the logic afterwards
+		relayed bool
+		want    bool
+	}{
+		{"first no-cache message", msg(1, protocol.FlagNoCache), peer, true, true},
+		{"copy of a relayed no-cache message", msg(1, protocol.FlagNoCache), peer, false, true},
+		{"local origination", msg(2, 0), nil, false, true},
+		{"local no-cache origination", msg(3, protocol.FlagNoCache), nil, false, true},
+		{"budget exceeded", msg(4, protocol.FlagNoCache), peer, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.allowSource(tt.msg, tt.src); got != tt.want {
+				t.Errorf("allowSource() = %v, want %v", got, tt.want)
+			}
+
+			if tt.relayed {
+				n.logic.cacheIfNew(tt.msg)
+			}
+		})
+	}
+
+	if st := n.FloodStatus(); st.DroppedSource != 1 {
+		t.Errorf("DroppedSource = %d, want 1", st.DroppedSource)
+	}
+}
@@ -0,0 +1,237 @@
+package node
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// receiptLogSize is the number of originated messages whose receipts are kept.
+const receiptLogSize = 256
+
+// Receipt is the acknowledgement of a message by a station.
+type Receipt struct {
+	Station string    `json:"station"`
+	Time    time.Time `json:"time"`
+	// Path the ACK travelled, starting with the acknowledging station
+	Path []string `json:"path"`
+	// Copies counts the ACKs received from the station, over any path
+	Copies uint `json:"copies"`
+}
+
+// MessageReceipts lists the receipts of an originated message.
+type MessageReceipts struct {
+	Source   string    `json:"source"`
+	Sequence uint64    `json:"sequence"`
+	Sent     time.Time `json:"sent"`
+	Acks     []Receipt `json:"acks"`
+}
+
+// ReceiptUpdate is delivered to the receipt subscribers when a station
+// acknowledges a message for the first time.
+type ReceiptUpdate struct {
+	Source   string  `json:"source"`
+	Sequence uint64  `json:"sequence"`
+	Receipt  Receipt `json:"receipt"`
+}
+
+type receiptKey struct {
+	source string
+	seq    uint64
+}
+
+func newReceiptKey(source []byte, seq uint64) receiptKey {
+	return receiptKey{
+		source: strings.ToUpper(string(source)),
+		seq:    seq,
+	}
+}
+
+// receiptTracker records the ACKs of the messages originated by the node.
+// The receipts of the keys pinned returns true for are not evicted.
+type receiptTracker struct {
+	messages map[receiptKey]*MessageReceipts
+	order    []receiptKey
+	subs     []chan ReceiptUpdate
+	pinned   func(receiptKey) bool
+	lock     sync.Mutex
+}
+
+func newReceiptTracker() *receiptTracker {
+	return &receiptTracker{
+		messages: make(map[receiptKey]*MessageReceipts),
+	}
+}
+
+// track starts recording the receipts of a message, the oldest tracked
+// message that is not pinned is dropped if the log is full.
+func (r *receiptTracker) track(msg *protocol.Message) {
+	key := newReceiptKey(msg.Source.Callsign, msg.SeqCounter)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.messages[key]; ok {
+		return
+	}
+
+	if len(r.order) >= receiptLogSize {
+		r.evict()
+	}
+
+	r.messages[key] = &MessageReceipts{
+		Source:   key.source,
+		Sequence: key.seq,
+		Sent:     time.Now(),
+		Acks:     []Receipt{},
+	}
+	r.order = append(r.order, key)
+}
+
+// evict drops the oldest receipts that are not pinned, the log grows if all
+// are pinned. The lock must be held.
+func (r *receiptTracker) evict() {
+	for i, k := range r.order {
+		if r.pinned != nil && r.pinned(k) {
+			continue
+		}
+
+		delete(r.messages, k)
+		r.order = append(r.order[:i], r.order[i+1:]...)
+		return
+	}
+}
+
+// record adds the ACK of a station and returns false if the message is not tracked.
+func (r *receiptTracker) record(ack *protocol.ACKPayload, msg *protocol.Message) bool {
+	key := newReceiptKey(ack.Source.Callsign, ack.SeqCounter)
+	station := strings.ToUpper(string(msg.Source.Callsign))
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	m, ok := r.messages[key]
+	if !ok {
+		return false
+	}
+
+	for i := range m.Acks {
+		if m.Acks[i].Station == station {
+			m.Acks[i].Copies++
+			return true
+		}
+	}
+
+	rc := Receipt{
+		Station: station,
+		Time:    time.Now(),
+		Path:    pathSegments(msg.Path),
+		Copies:  1,
+	}
+	m.Acks = append(m.Acks, rc)
+
+	u := ReceiptUpdate{
+		Source:   key.source,
+		Sequence: key.seq,
+		Receipt:  rc,
+	}
+
+	for _, s := range r.subs {
+		// slow subscribers miss updates rather than stalling the node
+		select {
+		case s <- u:
+		default:
+			logrus.Debug("Node: receipt subscriber overflow, update dropped")
+		}
+	}
+
+	return true
+}
+
+// get returns a copy of the receipts of a message.
+func (r *receiptTracker) get(source string, seq uint64) (MessageReceipts, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	m, ok := r.messages[newReceiptKey([]byte(source), seq)]
+	if !ok {
+		return MessageReceipts{}, false
+	}
+
+	c := *m
+	c.Acks = append([]Receipt{}, m.Acks...)
+
+	return c, true
+}
+
+func (r *receiptTracker) subscribe() chan ReceiptUpdate {
+	ch := make(chan ReceiptUpdate, eventSubscriptionBuffer)
+
+	r.lock.Lock()
+	r.subs = append(r.subs, ch)
+	r.lock.Unlock()
+
+	return ch
+}
+
+func (r *receiptTracker) unsubscribe(ch chan ReceiptUpdate) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var subs []chan ReceiptUpdate
+	for _, v := range r.subs {
+		if v != ch {
+			subs = append(subs, v)
+		}
+	}
+
+	r.subs = subs
+	close(ch)
+}
+
+// pathSegments splits a path into the callsigns.
+func pathSegments(path string) []string {
+	segs := []string{}
+
+	for _, s := range strings.Split(path, ";") {
+		if s != "" {
+			segs = append(segs, s)
+		}
+	}
+
+	return segs
+}
+
+// RecordACK records a received ACK for a message originated by this node.
+// It returns false if the acknowledged message is not tracked.
+func (n *Node) RecordACK(ack *protocol.ACKPayload, msg *protocol.Message) bool {
+	return n.receipts.record(ack, msg)
+}
+
+// Receipts returns the receipts of a message originated by this node.
+func (n *Node) Receipts(source string, seq uint64) (MessageReceipts, bool) {
+	return n.receipts.get(source, seq)
+}
+
+// SubscribeReceipts returns a channel that receives the first ACK of every
+// station for the messages originated by this node. The channel is closed
+// when the context is done or the node is closed.
+func (n *Node) SubscribeReceipts(ctx context.Context) <-chan ReceiptUpdate {
+	ch := n.receipts.subscribe()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-n.ctx.Done():
+		}
+
+		n.receipts.unsubscribe(ch)
+	}()
+
+	return ch
+}
@@ -0,0 +1,175 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func TestReceiptTracker(t *testing.T) {
+	r := newReceiptTracker()
+
+	msg := &protocol.Message{
+		SeqCounter: 7,
+		Flags:      protocol.FlagACK,
+		Source:     protocol.Contact{Callsign: []byte("oe1abc")},
+	}
+	r.track(msg)
+
+	ack := &protocol.ACKPayload{SeqCounter: 7, Source: protocol.Contact{Callsign: []byte("OE1ABC")}}
+	from := func(call string, path string) *protocol.Message {
+		return &protocol.Message{Source: protocol.Contact{Callsign: []byte(call)}, Path: path}
+	}
+
+	if !r.record(ack, from("OE1BBB", ";OE1BBB")) {
+		t.Fatal("record() = false for a tracked message")
+	}
+
+	r.record(ack, from("OE1CCC", ";OE1CCC;OE1BBB"))
+	r.record(ack, from("OE1BBB", ";OE1BBB;OE1CCC"))
+
+	if r.record(&protocol.ACKPayload{SeqCounter: 8, Source: ack.Source}, from("OE1BBB", "")) {
+		t.Error("record() = true for an untracked message")
+	}
+
+	got, ok := r.get("OE1ABC", 7)
+	if !ok {
+		t.Fatal("get() did not find the message")
+	}
+
+	if len(got.Acks) != 2 {
+		t.Fatalf("got %d acks, want 2", len(got.Acks))
+	}
+
+	if got.Acks[0].Station != "OE1BBB" || got.Acks[0].Copies != 2 || len(got.Acks[0].Path) != 1 {
+		t.Errorf("unexpected receipt %+v", got.Acks[0])
+	}
+
+	if got.Acks[1].Station != "OE1CCC" || len(got.Acks[1].Path) != 2 || got.Acks[1].Path[1] != "OE1BBB" {
+		t.Errorf("unexpected receipt %+v", got.Acks[1])
+	}
+
+	// the oldest messages are dropped
+	for i := uint64(100); i < 100+receiptLogSize; i++ {
+		r.track(&protocol.Message{SeqCounter: i, Source: msg.Source})
+	}
+
+	if _, ok := r.get("OE1ABC", 7); ok {
+		t.Error("oldest message was not dropped")
+	}
+}
+
+func TestReceiptTracker_pinned(t *testing.T) {
+	r := newReceiptTracker()
+	source := protocol.Contact{Callsign: []byte("OE1ABC")}
+
+	// the first two messages are pending reliable deliveries
+	r.pinned = func(k receiptKey) bool {
+		return k.seq < 2
+	}
+
+	for i := uint64(0); i < receiptLogSize+2; i++ {
+		r.track(&protocol.Message{SeqCounter: i, Source: source})
+	}
+
+	tests := []struct {
+		name string
+		seq  uint64
+		want bool
+	}{
+		{"pinned", 0, true},
+		{"pinned", 1, true},
+		{"oldest evicted", 2, false},
+		{"next evicted", 3, false},
+		{"kept", 4, true},
+		{"newest", receiptLogSize + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := r.get("OE1ABC", tt.seq); ok != tt.want {
+				t.Errorf("get(%d) found = %v, want %v", tt.seq, ok, tt.want)
+			}
+		})
+	}
+
+	// the log grows only while all receipts are pinned
+	r.pinned = func(receiptKey) bool { return true }
+	r.track(&protocol.Message{SeqCounter: 1000, Source: source})
+
+	if len(r.order) != receiptLogSize+1 {
+		t.Errorf("log holds %d receipts, want %d", len(r.order), receiptLogSize+1)
+	}
+}
+
+// recordACKs registers an ACK handler, the ack protocol extension is not
+// available in this package.
+func recordACKs(t *testing.T, n *Node) {
+	err := n.RegisterPayload(&PayloadHandler{
+		Type: protocol.PayloadAck,
+		Decode: func(buf []byte) (interface{}, error) {
+			ack := protocol.ParseACKPayload(buf)
+			if ack == nil {
+				return nil, errors.New("invalid ack")
+			}
+
+			return ack, nil
+		},
+		Handle: func(msg *protocol.Message, payload interface{}, src *Peer) {
+			n.RecordACK(payload.(*protocol.ACKPayload), msg)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNode_Receipts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+	c := testNode(t, ctx, "OE1CCC", b.settings.Port)
+
+	recordACKs(t, a)
+
+	updates := a.SubscribeReceipts(ctx)
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return connected(a) && connected(b) && connected(c)
+	})
+
+	msg := testMessage(a, 1)
+	msg.Flags |= protocol.FlagACK
+
+	if err := a.SpreadMessage(msg); err != nil {
+		t.Fatalf("SpreadMessage() error = %v", err)
+	}
+
+	stations := make(map[string][]string)
+	for len(stations) < 2 {
+		select {
+		case u := <-updates:
+			if u.Source != "OE1AAA" || u.Sequence != 1 {
+				t.Fatalf("unexpected update %+v", u)
+			}
+
+			stations[u.Receipt.Station] = u.Receipt.Path
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for receipts, got %v", stations)
+		}
+	}
+
+	if p := stations["OE1CCC"]; len(p) != 2 || p[0] != "OE1CCC" || p[1] != "OE1BBB" {
+		t.Errorf("path of the ACK of OE1CCC = %v", p)
+	}
+
+	r, ok := a.Receipts("oe1aaa", 1)
+	if !ok || len(r.Acks) != 2 {
+		t.Errorf("Receipts() = %+v, %v", r, ok)
+	}
+}
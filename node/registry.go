@@ -0,0 +1,127 @@
+package node
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// PayloadDecoder decodes the payload of a message.
+type PayloadDecoder func(buf []byte) (interface{}, error)
+
+// PayloadHandlerFunc handles a decoded payload, the peer is nil for messages
+// originated by the local node.
+type PayloadHandlerFunc func(msg *protocol.Message, payload interface{}, src *Peer)
+
+// PayloadHandler handles the messages of a payload type.
+type PayloadHandler struct {
+	Type   protocol.PayloadType
+	Decode PayloadDecoder
+	Handle PayloadHandlerFunc
+
+	// PeerConnected is called when a peer (re)connects, it is optional.
+	PeerConnected func(*Peer)
+}
+
+// Extension creates the payload handler of a protocol extension for a node.
+type Extension func(n *Node) *PayloadHandler
+
+var (
+	extensions     = make(map[string]Extension)
+	extensionNames []string
+	extensionsLock sync.Mutex
+)
+
+// RegisterExtension registers a protocol extension that is installed on every
+// node created afterwards. It is meant to be called from the init function of
+// the extension package.
+func RegisterExtension(name string, ext Extension) {
+	extensionsLock.Lock()
+	defer extensionsLock.Unlock()
+
+	if _, ok := extensions[name]; ok {
+		panic("node: extension registered twice: " + name)
+	}
+
+	extensions[name] = ext
+	extensionNames = append(extensionNames, name)
+}
+
+// installExtensions installs the registered extensions in the order of their registration.
+func (n *Node) installExtensions() error {
+	extensionsLock.Lock()
+	defer extensionsLock.Unlock()
+
+	for _, name := range extensionNames {
+		h := extensions[name](n)
+		if h == nil {
+			continue
+		}
+
+		if err := n.RegisterPayload(h); err != nil {
+			return fmt.Errorf("extension %s: %v", name, err)
+		}
+
+		logrus.WithField("extension", name).Debug("Node: installed extension")
+	}
+
+	return nil
+}
+
+// RegisterPayload registers the handler for a payload type, only one handler
+// per payload type is allowed.
+func (n *Node) RegisterPayload(h *PayloadHandler) error {
+	if h.Handle == nil {
+		return fmt.Errorf("missing handler for payload type %d", h.Type)
+	}
+
+	n.cbsLock.Lock()
+	defer n.cbsLock.Unlock()
+
+	if _, ok := n.payloads[h.Type]; ok {
+		return fmt.Errorf("payload type %d already registered", h.Type)
+	}
+
+	n.payloads[h.Type] = h
+
+	if h.PeerConnected != nil {
+		n.cbsPeerConn = append(n.cbsPeerConn, &PeerConnCallback{
+			PeerConnected: h.PeerConnected,
+		})
+	}
+
+	return nil
+}
+
+// payloadHandler returns the handler of the payload type, nil if there is none.
+func (n *Node) payloadHandler(t protocol.PayloadType) *PayloadHandler {
+	n.cbsLock.Lock()
+	defer n.cbsLock.Unlock()
+
+	return n.payloads[t]
+}
+
+// handlePayload decodes the payload of the message and calls the registered handler.
+func (n *Node) handlePayload(msg *protocol.Message, src *Peer) {
+	h := n.payloadHandler(msg.PayloadType)
+	if h == nil {
+		return
+	}
+
+	var payload interface{}
+
+	if h.Decode != nil {
+		p, err := h.Decode(msg.Payload)
+		if err != nil {
+			logrus.WithError(err).WithField("type", msg.PayloadType).Warn("Node: failed to decode payload")
+			return
+		}
+
+		payload = p
+	}
+
+	h.Handle(msg, payload, src)
+}
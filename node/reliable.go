@@ -0,0 +1,423 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Default values for the reliable broadcasts.
+const (
+	reliableDefaultInterval    = 5
+	reliableDefaultMaxInterval = 60
+	reliableDefaultDeadline    = 600
+)
+
+// DeliveryState is the state of a reliable broadcast.
+type DeliveryState string
+
+// Delivery states.
+const (
+	DeliveryPending   DeliveryState = "pending"
+	DeliveryDelivered DeliveryState = "delivered"
+	DeliveryExpired   DeliveryState = "expired"
+	// DeliveryCancelled means the node was closed before the delivery finished
+	DeliveryCancelled DeliveryState = "cancelled"
+)
+
+// ReliableOptions configures a reliable broadcast. Zero durations are taken
+// from the node settings.
+type ReliableOptions struct {
+	// Expected lists the stations that have to acknowledge the message
+	Expected []string
+	// Quorum is the number of acknowledging stations that completes the
+	// delivery, out of the expected stations if any. 0 requires all expected stations.
+	Quorum uint
+	// Interval before the first retransmission, it doubles after every retransmission
+	Interval time.Duration
+	// MaxInterval caps the delay between two retransmissions
+	MaxInterval time.Duration
+	// Deadline after which the delivery is given up
+	Deadline time.Duration
+}
+
+// DeliveryStatus is the state of a reliable broadcast.
+type DeliveryStatus struct {
+	Source   string        `json:"source"`
+	Sequence uint64        `json:"sequence"`
+	State    DeliveryState `json:"state"`
+	// Transmissions counts the original message and the retransmissions
+	Transmissions uint      `json:"transmissions"`
+	Expected      []string  `json:"expected"`
+	Quorum        uint      `json:"quorum"`
+	Acked         []string  `json:"acked"`
+	Missing       []string  `json:"missing"`
+	Started       time.Time `json:"started"`
+	Finished      time.Time `json:"finished,omitempty"`
+}
+
+// delivery tracks a reliable broadcast, done is closed when it finished.
+type delivery struct {
+	status DeliveryStatus
+	done   chan interface{}
+}
+
+// deliveryTracker keeps the state of the reliable broadcasts of the node.
+type deliveryTracker struct {
+	deliveries map[receiptKey]*delivery
+	order      []receiptKey
+	lock       sync.Mutex
+}
+
+func newDeliveryTracker() *deliveryTracker {
+	return &deliveryTracker{
+		deliveries: make(map[receiptKey]*delivery),
+	}
+}
+
+// add starts tracking a delivery, the oldest finished delivery is dropped if
+// the log is full. New deliveries are refused while the log only holds
+// pending ones.
+func (t *deliveryTracker) add(key receiptKey, opts ReliableOptions) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if d, ok := t.deliveries[key]; ok {
+		if d.status.State == DeliveryPending {
+			return errors.New("delivery already pending")
+		}
+
+		t.remove(key)
+	}
+
+	if len(t.order) >= receiptLogSize && !t.evict() {
+		return errors.New("too many pending deliveries")
+	}
+
+	t.deliveries[key] = &delivery{
+		status: DeliveryStatus{
+			Source:   key.source,
+			Sequence: key.seq,
+			State:    DeliveryPending,
+			Expected: opts.Expected,
+			Quorum:   opts.Quorum,
+			Acked:    []string{},
+			Missing:  append([]string{}, opts.Expected...),
+			Started:  time.Now(),
+		},
+		done: make(chan interface{}),
+	}
+	t.order = append(t.order, key)
+
+	return nil
+}
+
+// remove drops a delivery from the log, the lock must be held.
+func (t *deliveryTracker) remove(key receiptKey) {
+	delete(t.deliveries, key)
+
+	for i, k := range t.order {
+		if k == key {
+			t.order = append(t.order[:i], t.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// evict drops the oldest finished delivery, it returns false if all
+// deliveries are pending. The lock must be held.
+func (t *deliveryTracker) evict() bool {
+	for _, k := range t.order {
+		if t.deliveries[k].status.State != DeliveryPending {
+			t.remove(k)
+			return true
+		}
+	}
+
+	return false
+}
+
+// update applies a function to a pending delivery.
+func (t *deliveryTracker) update(key receiptKey, f func(s *DeliveryStatus)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	d, ok := t.deliveries[key]
+	if !ok || d.status.State != DeliveryPending {
+		return
+	}
+
+	f(&d.status)
+}
+
+// finish sets the final state of a delivery.
+func (t *deliveryTracker) finish(key receiptKey, state DeliveryState) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	d, ok := t.deliveries[key]
+	if !ok || d.status.State != DeliveryPending {
+		return
+	}
+
+	d.status.State = state
+	d.status.Finished = time.Now()
+	close(d.done)
+}
+
+// pending checks if the delivery is still waiting for its receipts.
+func (t *deliveryTracker) pending(key receiptKey) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	d, ok := t.deliveries[key]
+	return ok && d.status.State == DeliveryPending
+}
+
+// get returns a copy of the status of a delivery and the channel closed when
+// it finished.
+func (t *deliveryTracker) get(key receiptKey) (DeliveryStatus, <-chan interface{}, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	d, ok := t.deliveries[key]
+	if !ok {
+		return DeliveryStatus{}, nil, false
+	}
+
+	s := d.status
+	s.Acked = append([]string{}, d.status.Acked...)
+	s.Missing = append([]string{}, d.status.Missing...)
+
+	return s, d.done, true
+}
+
+// applyReceipts updates the acknowledging stations and returns true if the
+// delivery is complete.
+func (s *DeliveryStatus) applyReceipts(r MessageReceipts) bool {
+	s.Acked = []string{}
+	acked := make(map[string]bool)
+
+	for _, a := range r.Acks {
+		s.Acked = append(s.Acked, a.Station)
+		acked[a.Station] = true
+	}
+
+	s.Missing = []string{}
+	confirmed := uint(0)
+
+	for _, e := range s.Expected {
+		if acked[e] {
+			confirmed++
+		} else {
+			s.Missing = append(s.Missing, e)
+		}
+	}
+
+	if len(s.Expected) == 0 {
+		confirmed = uint(len(s.Acked))
+	}
+
+	if s.Quorum != 0 {
+		return confirmed >= s.Quorum
+	}
+
+	return len(s.Missing) == 0
+}
+
+// reliableOptions validates the options and fills in the defaults.
+func (n *Node) reliableOptions(opts ReliableOptions) (ReliableOptions, error) {
+	opts.Expected = normalizeCallsigns(opts.Expected)
+
+	if len(opts.Expected) == 0 && opts.Quorum == 0 {
+		return opts, errors.New("neither expected stations nor quorum given")
+	}
+
+	if len(opts.Expected) != 0 && opts.Quorum > uint(len(opts.Expected)) {
+		return opts, errors.New("quorum exceeds the expected stations")
+	}
+
+	s := n.settings.Reliable
+
+	if opts.Interval <= 0 {
+		opts.Interval = seconds(s.Interval)
+	}
+
+	if opts.Interval <= 0 {
+		opts.Interval = reliableDefaultInterval * time.Second
+	}
+
+	if opts.MaxInterval <= 0 {
+		opts.MaxInterval = seconds(s.MaxInterval)
+	}
+
+	if opts.MaxInterval <= 0 {
+		opts.MaxInterval = reliableDefaultMaxInterval * time.Second
+	}
+
+	if opts.MaxInterval < opts.Interval {
+		opts.MaxInterval = opts.Interval
+	}
+
+	if opts.Deadline <= 0 {
+		opts.Deadline = seconds(s.Deadline)
+	}
+
+	if opts.Deadline <= 0 {
+		opts.Deadline = reliableDefaultDeadline * time.Second
+	}
+
+	return opts, nil
+}
+
+// SpreadReliable spreads a message and retransmits it on a backoff schedule
+// until the expected stations or a quorum acknowledged it, or the deadline
+// passed. The outcome is reported by DeliveryStatus and WaitDelivery.
+func (n *Node) SpreadReliable(msg *protocol.Message, opts ReliableOptions) error {
+	opts, err := n.reliableOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	msg.Flags |= protocol.FlagACK
+	key := newReceiptKey(msg.Source.Callsign, msg.SeqCounter)
+
+	if err := n.deliveries.add(key, opts); err != nil {
+		return err
+	}
+
+	// subscribe before spreading to not miss any ACK
+	ctx, cancel := context.WithCancel(n.ctx)
+	updates := n.SubscribeReceipts(ctx)
+
+	if err := n.SpreadMessage(msg); err != nil {
+		cancel()
+		n.deliveries.finish(key, DeliveryCancelled)
+		return err
+	}
+
+	n.deliveries.update(key, func(s *DeliveryStatus) {
+		s.Transmissions = 1
+	})
+
+	go func() {
+		defer cancel()
+		n.reliableWorker(msg.Clone(), key, opts, updates)
+	}()
+
+	return nil
+}
+
+// reliableWorker retransmits a message until its delivery finished.
+func (n *Node) reliableWorker(msg *protocol.Message, key receiptKey, opts ReliableOptions, updates <-chan ReceiptUpdate) {
+	interval := opts.Interval
+	retransmit := time.NewTimer(interval)
+	deadline := time.NewTimer(opts.Deadline)
+
+	defer retransmit.Stop()
+	defer deadline.Stop()
+
+	for {
+		// the receipt log is the reference, updates may have been dropped
+		complete := false
+		if r, ok := n.receipts.get(key.source, key.seq); ok {
+			n.deliveries.update(key, func(s *DeliveryStatus) {
+				complete = s.applyReceipts(r)
+			})
+		}
+
+		if complete {
+			logrus.WithField("source", key.source).WithField("seq", key.seq).Info("Node: reliable message delivered")
+			n.deliveries.finish(key, DeliveryDelivered)
+			return
+		}
+
+		select {
+		case <-n.ctx.Done():
+			n.deliveries.finish(key, DeliveryCancelled)
+			return
+
+		case <-deadline.C:
+			logrus.WithField("source", key.source).WithField("seq", key.seq).Warn("Node: reliable message expired")
+			n.deliveries.finish(key, DeliveryExpired)
+			return
+
+		case u, ok := <-updates:
+			if !ok {
+				n.deliveries.finish(key, DeliveryCancelled)
+				return
+			}
+
+			if u.Source != key.source || u.Sequence != key.seq {
+				continue
+			}
+
+		case <-retransmit.C:
+			if msg.Retransmission == 255 {
+				logrus.Warn("Node: retransmission limit reached, waiting for the deadline")
+				continue
+			}
+
+			msg.Retransmission++
+			msg.Flags |= protocol.FlagRetransmission
+
+			if err := n.retransmit(msg); err != nil {
+				logrus.WithError(err).Warn("Node: failed to retransmit message")
+			}
+
+			n.deliveries.update(key, func(s *DeliveryStatus) {
+				s.Transmissions++
+			})
+
+			interval *= 2
+			if interval > opts.MaxInterval {
+				interval = opts.MaxInterval
+			}
+
+			retransmit.Reset(interval)
+		}
+	}
+}
+
+// retransmit spreads a retransmission of a local message, it replaces the
+// cached message but is not delivered to the handlers again.
+func (n *Node) retransmit(msg *protocol.Message) error {
+	m := msg.Clone()
+
+	if c := n.filterForCache(m, nil); c != nil {
+		n.pushToCache(c)
+	}
+
+	logrus.WithField("retransmission", m.Retransmission).Debug("Node: retransmitting message")
+	return n.logic.SpreadMessage(m)
+}
+
+// DeliveryStatus returns the state of a reliable broadcast.
+func (n *Node) DeliveryStatus(source string, seq uint64) (DeliveryStatus, bool) {
+	s, _, ok := n.deliveries.get(newReceiptKey([]byte(source), seq))
+	return s, ok
+}
+
+// WaitDelivery blocks until a reliable broadcast finished or the context is
+// done and returns its last state.
+func (n *Node) WaitDelivery(ctx context.Context, source string, seq uint64) (DeliveryStatus, error) {
+	key := newReceiptKey([]byte(source), seq)
+
+	_, done, ok := n.deliveries.get(key)
+	if !ok {
+		return DeliveryStatus{}, errors.New("unknown delivery")
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	s, _, _ := n.deliveries.get(key)
+	return s, ctx.Err()
+}
@@ -0,0 +1,187 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func TestDeliveryStatus_applyReceipts(t *testing.T) {
+	acks := MessageReceipts{Acks: []Receipt{{Station: "OE1BBB"}, {Station: "OE1CCC"}}}
+
+	tests := []struct {
+		name        string
+		expected    []string
+		quorum      uint
+		want        bool
+		wantMissing int
+	}{
+		{name: "all expected", expected: []string{"OE1BBB", "OE1CCC"}, want: true},
+		{name: "expected missing", expected: []string{"OE1BBB", "OE1DDD"}, want: false, wantMissing: 1},
+		{name: "quorum of expected", expected: []string{"OE1BBB", "OE1DDD"}, quorum: 1, want: true, wantMissing: 1},
+		{name: "quorum of any", quorum: 2, want: true},
+		{name: "quorum not reached", quorum: 3, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := DeliveryStatus{Expected: tt.expected, Quorum: tt.quorum}
+
+			if got := s.applyReceipts(acks); got != tt.want {
+				t.Errorf("applyReceipts() = %v, want %v", got, tt.want)
+			}
+
+			if len(s.Missing) != tt.wantMissing {
+				t.Errorf("applyReceipts() missing = %v, want %d", s.Missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func Test_deliveryTracker_full(t *testing.T) {
+	tr := newDeliveryTracker()
+	key := func(seq uint64) receiptKey {
+		return newReceiptKey([]byte("OE1AAA"), seq)
+	}
+
+	for i := uint64(0); i < receiptLogSize; i++ {
+		if err := tr.add(key(i), ReliableOptions{}); err != nil {
+			t.Fatalf("add(%d) error = %v", i, err)
+		}
+	}
+
+	if err := tr.add(key(receiptLogSize), ReliableOptions{}); err == nil {
+		t.Fatal("add() to a log of pending deliveries succeeded")
+	}
+
+	if _, _, ok := tr.get(key(0)); !ok {
+		t.Fatal("pending delivery was evicted")
+	}
+
+	// finished deliveries make room, the oldest first
+	tr.finish(key(5), DeliveryDelivered)
+	tr.finish(key(3), DeliveryExpired)
+
+	if err := tr.add(key(receiptLogSize), ReliableOptions{}); err != nil {
+		t.Fatalf("add() error = %v", err)
+	}
+
+	if _, _, ok := tr.get(key(3)); ok {
+		t.Error("oldest finished delivery was not evicted")
+	}
+
+	if _, _, ok := tr.get(key(5)); !ok {
+		t.Error("newer finished delivery was evicted")
+	}
+
+	// restarting a finished delivery keeps a single entry
+	if err := tr.add(key(5), ReliableOptions{}); err != nil {
+		t.Fatalf("add() of a finished delivery error = %v", err)
+	}
+
+	if len(tr.order) != receiptLogSize || len(tr.deliveries) != receiptLogSize {
+		t.Errorf("log holds %d keys and %d deliveries, want %d", len(tr.order), len(tr.deliveries), receiptLogSize)
+	}
+
+	// the pending deliveries still finish
+	_, done, _ := tr.get(key(0))
+	tr.finish(key(0), DeliveryDelivered)
+
+	select {
+	case <-done:
+	default:
+		t.Error("finished delivery was not signalled")
+	}
+}
+
+func TestNode_SpreadReliable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+	c := testNode(t, ctx, "OE1CCC", b.settings.Port)
+
+	recordACKs(t, a)
+
+	// c loses the first transmission
+	if err := c.Filters().Add(StageReceive, "lose", FilterFunc(func(msg *protocol.Message, peer *Peer) FilterAction {
+		if msg.PayloadType == protocol.PayloadCQ && msg.Retransmission == 0 {
+			return FilterDrop
+		}
+
+		return FilterAccept
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan uint8, 4)
+	c.AddCallback(&MessageCallback{Cb: func(msg *protocol.Message, src *Peer) {
+		if msg.PayloadType == protocol.PayloadCQ {
+			received <- msg.Retransmission
+		}
+	}})
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return connected(a) && connected(b) && connected(c) && len(b.PeerStatus()) == 2
+	})
+
+	opts := ReliableOptions{
+		Expected: []string{"oe1ccc"},
+		Interval: 100 * time.Millisecond,
+		Deadline: 5 * time.Second,
+	}
+
+	if err := a.SpreadReliable(testMessage(a, 1), opts); err != nil {
+		t.Fatalf("SpreadReliable() error = %v", err)
+	}
+
+	if err := a.SpreadReliable(testMessage(a, 1), opts); err == nil {
+		t.Error("SpreadReliable() accepted a pending message")
+	}
+
+	wctx, wcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer wcancel()
+
+	s, err := a.WaitDelivery(wctx, "OE1AAA", 1)
+	if err != nil {
+		t.Fatalf("WaitDelivery() error = %v", err)
+	}
+
+	if s.State != DeliveryDelivered || s.Transmissions < 2 || len(s.Missing) != 0 {
+		t.Errorf("WaitDelivery() = %+v", s)
+	}
+
+	select {
+	case r := <-received:
+		if r == 0 {
+			t.Error("first transmission was not lost")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered to the handlers of c")
+	}
+
+	// the retransmissions are delivered only once
+	time.Sleep(300 * time.Millisecond)
+	if len(received) != 0 {
+		t.Errorf("%d duplicate deliveries", len(received))
+	}
+
+	// nobody acknowledges for an unknown station
+	opts.Expected = []string{"OE1ZZZ"}
+	opts.Deadline = 300 * time.Millisecond
+
+	if err := a.SpreadReliable(testMessage(a, 2), opts); err != nil {
+		t.Fatalf("SpreadReliable() error = %v", err)
+	}
+
+	s, err = a.WaitDelivery(wctx, "OE1AAA", 2)
+	if err != nil {
+		t.Fatalf("WaitDelivery() error = %v", err)
+	}
+
+	if s.State != DeliveryExpired || len(s.Missing) != 1 || len(s.Acked) != 2 {
+		t.Errorf("WaitDelivery() = %+v", s)
+	}
+}
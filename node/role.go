@@ -0,0 +1,69 @@
+package node
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+// Role defines which traffic a node originates and forwards.
+type Role string
+
+// Node roles.
+const (
+	// RoleFull originates, relays and acknowledges messages
+	RoleFull Role = "full"
+	// RoleRelay relays and acknowledges messages but never originates any
+	RoleRelay Role = "relay"
+	// RoleLeaf originates, receives and acknowledges messages but never relays
+	RoleLeaf Role = "leaf"
+	// RoleObserver only receives and syncs messages, it sends no ACKs
+	RoleObserver Role = "observer"
+)
+
+// ParseRole returns the role with the given name, the empty name is a full node.
+func ParseRole(name string) (Role, error) {
+	switch r := Role(strings.ToLower(name)); r {
+	case "":
+		return RoleFull, nil
+	case RoleFull, RoleRelay, RoleLeaf, RoleObserver:
+		return r, nil
+	}
+
+	return "", fmt.Errorf("unknown node role %q", name)
+}
+
+// roleFromSettings returns the configured role, a read-only node without a
+// role is a relay.
+func roleFromSettings(s parameters.LogicSettings) (Role, error) {
+	if s.Role == "" && s.ReadOnly {
+		return RoleRelay, nil
+	}
+
+	r, err := ParseRole(s.Role)
+	if err != nil {
+		return "", err
+	}
+
+	if s.ReadOnly && r.Originates() {
+		return "", fmt.Errorf("read-only node with role %s", r)
+	}
+
+	return r, nil
+}
+
+// Originates checks if the role spreads local messages.
+func (r Role) Originates() bool {
+	return r == RoleFull || r == RoleLeaf
+}
+
+// Acknowledges checks if the role sends ACKs for the received messages.
+func (r Role) Acknowledges() bool {
+	return r != RoleObserver
+}
+
+// Relays checks if the role forwards the messages of other stations.
+func (r Role) Relays() bool {
+	return r == RoleFull || r == RoleRelay
+}
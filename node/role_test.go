@@ -0,0 +1,106 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func Test_roleFromSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings parameters.LogicSettings
+		want     Role
+		wantErr  bool
+	}{
+		{name: "default", want: RoleFull},
+		{name: "read-only", settings: parameters.LogicSettings{ReadOnly: true}, want: RoleRelay},
+		{name: "leaf", settings: parameters.LogicSettings{Role: "Leaf"}, want: RoleLeaf},
+		{name: "read-only observer", settings: parameters.LogicSettings{Role: "observer", ReadOnly: true}, want: RoleObserver},
+		{name: "read-only full", settings: parameters.LogicSettings{Role: "full", ReadOnly: true}, wantErr: true},
+		{name: "unknown", settings: parameters.LogicSettings{Role: "hub"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := roleFromSettings(tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("roleFromSettings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("roleFromSettings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNode_Roles(t *testing.T) {
+	tests := []struct {
+		role      Role
+		originate bool
+		relay     bool
+		ack       bool
+	}{
+		{role: RoleLeaf, originate: true, ack: true},
+		{role: RoleRelay, relay: true, ack: true},
+		{role: RoleObserver},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// a - b - c, b has the role under test
+			a := testNode(t, ctx, "OE1AAA")
+			b := testNodeWith(t, ctx, "OE1BBB", func(s *parameters.Settings, st *parameters.Station) {
+				s.LogicSettings.Role = string(tt.role)
+			}, a.settings.Port)
+			c := testNode(t, ctx, "OE1CCC", b.settings.Port)
+
+			recordACKs(t, a)
+
+			waitFor(t, 5*time.Second, "peers to connect", func() bool {
+				return connected(a) && connected(b) && connected(c) && len(b.PeerStatus()) == 2
+			})
+
+			msg := testMessage(a, 1)
+			msg.Flags |= protocol.FlagACK
+
+			if err := a.SpreadMessage(msg); err != nil {
+				t.Fatalf("SpreadMessage() error = %v", err)
+			}
+
+			if err := b.SpreadMessage(testMessage(b, 2)); (err == nil) != tt.originate {
+				t.Errorf("SpreadMessage() error = %v, originate %v", err, tt.originate)
+			}
+
+			waitFor(t, 5*time.Second, "message to arrive at b", func() bool {
+				return cached(b, 1)
+			})
+
+			// give the messages time to arrive, if they were sent
+			time.Sleep(200 * time.Millisecond)
+
+			if cached(c, 1) != tt.relay {
+				t.Errorf("message relayed = %v, want %v", cached(c, 1), tt.relay)
+			}
+
+			if cached(a, 2) != tt.originate {
+				t.Errorf("local message spread = %v, want %v", cached(a, 2), tt.originate)
+			}
+
+			r, _ := a.Receipts("OE1AAA", 1)
+			acked := false
+			for _, v := range r.Acks {
+				acked = acked || v.Station == "OE1BBB"
+			}
+
+			if acked != tt.ack {
+				t.Errorf("message acknowledged = %v, want %v", acked, tt.ack)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package node
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Service is a service announced by a station.
+type Service struct {
+	Source     string                      `json:"source"`
+	Sequence   uint64                      `json:"sequence"`
+	Name       string                      `json:"name"`
+	Type       string                      `json:"type"`
+	IP         string                      `json:"ip,omitempty"`
+	Port       uint16                      `json:"port"`
+	Attributes []protocol.ServiceAttribute `json:"attributes"`
+	Position   *protocol.Position          `json:"position,omitempty"`
+	Announced  time.Time                   `json:"announced"`
+	Expires    time.Time                   `json:"expires"`
+}
+
+type serviceKey struct {
+	source string
+	name   string
+	typ    string
+}
+
+// serviceRegistry keeps the announced services until they expire.
+type serviceRegistry struct {
+	services map[serviceKey]*Service
+	now      func() time.Time
+	lock     sync.Mutex
+}
+
+func newServiceRegistry() *serviceRegistry {
+	return &serviceRegistry{
+		services: make(map[serviceKey]*Service),
+		now:      time.Now,
+	}
+}
+
+// newService creates the registry entry of an announcement.
+func newService(msg *protocol.Message, s *protocol.ServicePayload, now time.Time) *Service {
+	svc := &Service{
+		Source:     strings.ToUpper(string(msg.Source.Callsign)),
+		Sequence:   msg.SeqCounter,
+		Name:       s.Name,
+		Type:       strings.ToLower(s.Type),
+		Port:       s.Port,
+		Attributes: append([]protocol.ServiceAttribute{}, s.Attributes...),
+		Position:   s.Position,
+		Announced:  now,
+		Expires:    now.Add(time.Duration(s.Lifetime) * time.Second),
+	}
+
+	if int(s.IPIndex) < len(msg.Source.IPs) {
+		if ip := msg.Source.IPs[s.IPIndex].Data; len(ip) == net.IPv4len || len(ip) == net.IPv6len {
+			svc.IP = net.IP(ip).String()
+		}
+	}
+
+	return svc
+}
+
+// announce applies a service announcement, announcements with an older
+// sequence number than the entry are ignored.
+func (r *serviceRegistry) announce(msg *protocol.Message) {
+	if msg.PayloadType != protocol.PayloadService {
+		return
+	}
+
+	s, err := protocol.ParseServicePayload(msg.Payload)
+	if err != nil {
+		logrus.WithError(err).Warn("Node: failed to parse service announcement")
+		return
+	}
+
+	svc := newService(msg, s, r.now())
+	key := serviceKey{source: svc.Source, name: svc.Name, typ: svc.Type}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if old, ok := r.services[key]; ok && msg.SeqCounter < old.Sequence {
+		return
+	}
+
+	// a lifetime of zero withdraws the service
+	if s.Lifetime == 0 {
+		delete(r.services, key)
+		return
+	}
+
+	r.services[key] = svc
+}
+
+// expire removes the expired services, the lock must be held.
+func (r *serviceRegistry) expire(now time.Time) {
+	for k, s := range r.services {
+		if !now.Before(s.Expires) {
+			delete(r.services, k)
+		}
+	}
+}
+
+// find returns the services of a type, all services if the type is empty.
+func (r *serviceRegistry) find(typ string) []Service {
+	typ = strings.ToLower(typ)
+	res := []Service{}
+
+	r.lock.Lock()
+	r.expire(r.now())
+
+	for _, s := range r.services {
+		if typ != "" && s.Type != typ {
+			continue
+		}
+
+		c := *s
+		c.Attributes = append([]protocol.ServiceAttribute{}, s.Attributes...)
+		res = append(res, c)
+	}
+	r.lock.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Source != res[j].Source {
+			return res[i].Source < res[j].Source
+		}
+
+		if res[i].Type != res[j].Type {
+			return res[i].Type < res[j].Type
+		}
+
+		return res[i].Name < res[j].Name
+	})
+
+	return res
+}
+
+// Services returns the announced services of a type that did not expire,
+// all services if the type is empty.
+func (n *Node) Services(typ string) []Service {
+	return n.services.find(typ)
+}
@@ -0,0 +1,59 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func serviceMessage(call string, seq uint64, s protocol.ServicePayload) *protocol.Message {
+	msg := cqMessage(call, seq, "", "")
+	msg.PayloadType = protocol.PayloadService
+	msg.Payload = s.Bytes()
+
+	return msg
+}
+
+func TestServiceRegistry(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	r := newServiceRegistry()
+	r.now = func() time.Time { return now }
+
+	cam := protocol.ServicePayload{Name: "Webcam", Type: "HTTP", Port: 80, Lifetime: 60}
+	bbs := protocol.ServicePayload{Name: "BBS", Type: "telnet", Port: 23, Lifetime: 600, IPIndex: 3}
+
+	r.announce(serviceMessage("oe1xyz", 2, cam))
+	r.announce(serviceMessage("OE3DEF", 1, bbs))
+
+	got := r.find("http")
+	if len(got) != 1 || got[0].Source != "OE1XYZ" || got[0].IP != "44.143.0.1" || got[0].Type != "http" {
+		t.Fatalf("find(http) = %+v", got)
+	}
+
+	// an invalid address index is ignored
+	if got := r.find("telnet"); len(got) != 1 || got[0].IP != "" {
+		t.Errorf("find(telnet) = %+v", got)
+	}
+
+	// older announcements do not withdraw the service
+	withdraw := cam
+	withdraw.Lifetime = 0
+	r.announce(serviceMessage("OE1XYZ", 1, withdraw))
+
+	if got := r.find(""); len(got) != 2 {
+		t.Errorf("older announcement withdrew the service: %+v", got)
+	}
+
+	// the services expire
+	now = now.Add(time.Minute)
+	if got := r.find(""); len(got) != 1 || got[0].Name != "BBS" {
+		t.Errorf("find() after expiry = %+v", got)
+	}
+
+	r.announce(serviceMessage("OE3DEF", 2, protocol.ServicePayload{Name: "BBS", Type: "telnet"}))
+	if got := r.find(""); len(got) != 0 {
+		t.Errorf("find() after withdrawal = %+v", got)
+	}
+}
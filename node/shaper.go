@@ -0,0 +1,196 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+// tokenBucket limits a rate of bytes per second with a configurable burst.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+}
+
+// newTokenBucket creates a token bucket, nil if the limit is disabled.
+func newTokenBucket(s parameters.TokenBucketSettings) *tokenBucket {
+	return newBucket(float64(s.Rate), float64(s.Burst))
+}
+
+// newBucket creates a full bucket, the burst defaults to one second of the rate.
+func newBucket(rate float64, burst float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	if burst <= 0 {
+		burst = rate
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens gathered since the last call, the lock must be held.
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+
+	b.last = now
+}
+
+// delay returns the time to wait until n bytes may be sent. Messages larger
+// than the burst are allowed as soon as the bucket is full.
+func (b *tokenBucket) delay(n int) time.Duration {
+	if b == nil {
+		return 0
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+
+	need := float64(n)
+	if need > b.burst {
+		need = b.burst
+	}
+
+	if b.tokens >= need {
+		return 0
+	}
+
+	return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+}
+
+// allow takes n tokens if they are available.
+func (b *tokenBucket) allow(n float64) bool {
+	if b == nil {
+		return true
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+
+	if b.tokens < n {
+		return false
+	}
+
+	b.tokens -= n
+	return true
+}
+
+// full checks if the bucket has refilled completely.
+func (b *tokenBucket) full() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+	return b.tokens >= b.burst
+}
+
+// take removes the tokens for n bytes, the bucket may become negative.
+func (b *tokenBucket) take(n int) {
+	if b == nil {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+	b.tokens -= float64(n)
+}
+
+// shaper combines the token bucket of a peer with the global one.
+type shaper struct {
+	peer      *tokenBucket
+	global    *tokenBucket
+	unshaped  [numPriorities]bool
+	throttled time.Duration
+	lock      sync.Mutex
+}
+
+// newShaper creates the shaper for a peer that shares the given global bucket.
+func newShaper(s parameters.ShapingSettings, peer *parameters.TokenBucketSettings, global *tokenBucket) *shaper {
+	ps := s.Peer
+	if peer != nil {
+		ps = *peer
+	}
+
+	sh := &shaper{
+		peer:   newTokenBucket(ps),
+		global: global,
+	}
+
+	for _, c := range s.Unshaped {
+		for i, name := range priorityNames {
+			if name == c {
+				sh.unshaped[i] = true
+			}
+		}
+	}
+
+	return sh
+}
+
+// delay returns the time to wait before a message of n bytes in the given
+// priority class may be sent.
+func (s *shaper) delay(n int, prio Priority) time.Duration {
+	if s == nil || (prio < numPriorities && s.unshaped[prio]) {
+		return 0
+	}
+
+	d := s.peer.delay(n)
+	if g := s.global.delay(n); g > d {
+		d = g
+	}
+
+	return d
+}
+
+// take consumes the tokens for a sent message.
+func (s *shaper) take(n int, prio Priority) {
+	if s == nil || (prio < numPriorities && s.unshaped[prio]) {
+		return
+	}
+
+	s.peer.take(n)
+	s.global.take(n)
+}
+
+// addThrottled records time spent waiting for tokens.
+func (s *shaper) addThrottled(d time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.throttled += d
+}
+
+// Throttled returns the total time spent waiting for tokens.
+func (s *shaper) Throttled() time.Duration {
+	if s == nil {
+		return 0
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.throttled
+}
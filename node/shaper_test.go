@@ -0,0 +1,101 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+)
+
+func Test_tokenBucket_delay(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings parameters.TokenBucketSettings
+		// taken bytes before the delay is checked
+		taken int
+		n     int
+		want  time.Duration
+	}{
+		{"disabled", parameters.TokenBucketSettings{}, 1000, 1000, 0},
+		{"within burst", parameters.TokenBucketSettings{Rate: 100, Burst: 500}, 0, 500, 0},
+		{"burst defaults to rate", parameters.TokenBucketSettings{Rate: 100}, 100, 200, time.Second},
+		{"empty bucket", parameters.TokenBucketSettings{Rate: 100, Burst: 500}, 500, 50, 500 * time.Millisecond},
+		{"negative bucket", parameters.TokenBucketSettings{Rate: 100, Burst: 500}, 700, 100, 3 * time.Second},
+		{"larger than burst", parameters.TokenBucketSettings{Rate: 100, Burst: 500}, 0, 5000, 0},
+		{"larger than burst waits for full", parameters.TokenBucketSettings{Rate: 100, Burst: 500}, 100, 5000, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.settings)
+			b.take(tt.taken)
+
+			got := b.delay(tt.n)
+
+			// allow for the time passing between take and delay
+			if got > tt.want || got < tt.want-10*time.Millisecond {
+				t.Errorf("delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_tokenBucket_refill(t *testing.T) {
+	b := newTokenBucket(parameters.TokenBucketSettings{Rate: 100, Burst: 500})
+	b.take(500)
+
+	b.lock.Lock()
+	b.last = b.last.Add(-2 * time.Second)
+	b.lock.Unlock()
+
+	if d := b.delay(200); d != 0 {
+		t.Errorf("delay() = %v after a refill of 200 tokens", d)
+	}
+
+	b.take(200)
+
+	if d := b.delay(100); d == 0 {
+		t.Error("delay() = 0 for tokens not refilled yet")
+	}
+
+	// the bucket does not fill above the burst
+	b.lock.Lock()
+	b.last = b.last.Add(-time.Minute)
+	b.lock.Unlock()
+
+	b.take(500)
+
+	if d := b.delay(1); d == 0 {
+		t.Error("delay() = 0 for tokens above the burst")
+	}
+}
+
+func Test_shaper_delay(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      parameters.ShapingSettings
+		peer   *parameters.TokenBucketSettings
+		global parameters.TokenBucketSettings
+		prio   Priority
+		want   time.Duration
+	}{
+		{"unshaped", parameters.ShapingSettings{}, nil, parameters.TokenBucketSettings{}, PriorityNormal, 0},
+		{"peer limit", parameters.ShapingSettings{Peer: parameters.TokenBucketSettings{Rate: 100}}, nil, parameters.TokenBucketSettings{}, PriorityNormal, time.Second},
+		{"peer override", parameters.ShapingSettings{Peer: parameters.TokenBucketSettings{Rate: 100}}, &parameters.TokenBucketSettings{Rate: 50}, parameters.TokenBucketSettings{}, PriorityNormal, 2 * time.Second},
+		{"global limit", parameters.ShapingSettings{Peer: parameters.TokenBucketSettings{Rate: 200}}, nil, parameters.TokenBucketSettings{Rate: 50, Burst: 100}, PriorityNormal, 2 * time.Second},
+		{"unshaped class", parameters.ShapingSettings{Peer: parameters.TokenBucketSettings{Rate: 100}, Unshaped: []string{"high"}}, nil, parameters.TokenBucketSettings{}, PriorityHigh, 0},
+		{"shaped class", parameters.ShapingSettings{Peer: parameters.TokenBucketSettings{Rate: 100}, Unshaped: []string{"high"}}, nil, parameters.TokenBucketSettings{}, PriorityBulk, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newShaper(tt.s, tt.peer, newTokenBucket(tt.global))
+
+			// the first message empties the buckets, the second one waits
+			s.take(100, tt.prio)
+			got := s.delay(100, tt.prio)
+
+			if got > tt.want || got < tt.want-10*time.Millisecond {
+				t.Errorf("delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
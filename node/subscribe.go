@@ -0,0 +1,225 @@
+package node
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/donothingloop/hamgo/protocol"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// OverflowPolicy defines what happens if the channel of a subscription is full.
+type OverflowPolicy int
+
+// Overflow policies.
+const (
+	// OverflowDropNewest discards the message that does not fit anymore.
+	OverflowDropNewest OverflowPolicy = iota
+
+	// OverflowDropOldest discards the oldest buffered message.
+	OverflowDropOldest
+
+	// OverflowBlock waits until the subscriber has room, this stalls the
+	// delivery to all other subscribers and handlers.
+	OverflowBlock
+)
+
+// defaultSubscriptionBuffer is the channel size if none is given.
+const defaultSubscriptionBuffer = 64
+
+// Filter selects the messages of a subscription, empty lists match everything.
+type Filter struct {
+	PayloadTypes []protocol.PayloadType
+	Sources      []string
+	Buffer       int
+	Overflow     OverflowPolicy
+}
+
+// matches checks if the message is selected by the filter.
+func (f *Filter) matches(msg *protocol.Message) bool {
+	if len(f.PayloadTypes) != 0 {
+		found := false
+
+		for _, t := range f.PayloadTypes {
+			if t == msg.PayloadType {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(f.Sources) != 0 {
+		src := string(msg.Source.Callsign)
+		found := false
+
+		for _, s := range f.Sources {
+			if matchCallsign(strings.ToUpper(s), strings.ToUpper(src)) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Delivery is a message delivered to a subscriber, the peer is nil for
+// messages originated by the local node. The message must not be modified.
+type Delivery struct {
+	Message *protocol.Message
+	Peer    *Peer
+}
+
+// subscription is a registered subscriber.
+type subscription struct {
+	filter  Filter
+	ch      chan Delivery
+	ctx     context.Context
+	dropped uint64
+}
+
+// deliver sends the message to the subscriber according to the overflow policy.
+func (s *subscription) deliver(d Delivery, done <-chan struct{}) {
+	select {
+	case s.ch <- d:
+		return
+	default:
+	}
+
+	switch s.filter.Overflow {
+	case OverflowDropOldest:
+		select {
+		case <-s.ch:
+		default:
+		}
+
+		select {
+		case s.ch <- d:
+		default:
+		}
+
+	case OverflowBlock:
+		select {
+		case s.ch <- d:
+			return
+		case <-s.ctx.Done():
+		case <-done:
+		}
+	}
+
+	s.dropped++
+	logrus.WithField("dropped", s.dropped).Debug("Node: subscriber overflow, message dropped")
+}
+
+// Subscribe returns a channel that receives the messages selected by the
+// filter in the order they were accepted by the node. The channel is closed
+// when the context is done or the node is closed.
+func (n *Node) Subscribe(ctx context.Context, f Filter) <-chan Delivery {
+	if f.Buffer <= 0 {
+		f.Buffer = defaultSubscriptionBuffer
+	}
+
+	s := &subscription{
+		filter: f,
+		ch:     make(chan Delivery, f.Buffer),
+		ctx:    ctx,
+	}
+
+	n.subsLock.Lock()
+	n.subs = append(n.subs, s)
+	n.subsLock.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-n.ctx.Done():
+		}
+
+		n.subsLock.Lock()
+		defer n.subsLock.Unlock()
+
+		var subs []*subscription
+		for _, v := range n.subs {
+			if v != s {
+				subs = append(subs, v)
+			}
+		}
+
+		n.subs = subs
+		close(s.ch)
+	}()
+
+	return s.ch
+}
+
+// dispatcher delivers the accepted messages to the handlers and subscribers
+// in order. The queue is unbounded, so handlers may spread messages themselves.
+type dispatcher struct {
+	queue  []Delivery
+	signal chan interface{}
+	lock   sync.Mutex
+}
+
+// push appends a message to the dispatch queue.
+func (d *dispatcher) push(msg *protocol.Message, src *Peer) {
+	d.lock.Lock()
+	d.queue = append(d.queue, Delivery{Message: msg, Peer: src})
+	d.lock.Unlock()
+
+	select {
+	case d.signal <- nil:
+	default:
+	}
+}
+
+// take removes all queued messages.
+func (d *dispatcher) take() []Delivery {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	q := d.queue
+	d.queue = nil
+
+	return q
+}
+
+// dispatchWorker delivers the queued messages until the node is closed.
+func (n *Node) dispatchWorker() {
+	logrus.Debug("Node: dispatchWorker: started")
+
+	for {
+		select {
+		case <-n.ctx.Done():
+			logrus.Debug("Node: dispatchWorker: closing")
+			return
+
+		case <-n.dispatch.signal:
+		}
+
+		for _, d := range n.dispatch.take() {
+			n.handleCallbacks(d.Message, d.Peer)
+		}
+	}
+}
+
+// notify delivers a message to the subscribers.
+func (n *Node) notify(msg *protocol.Message, src *Peer) {
+	n.subsLock.Lock()
+	defer n.subsLock.Unlock()
+
+	for _, s := range n.subs {
+		if s.filter.matches(msg) {
+			s.deliver(Delivery{Message: msg, Peer: src}, n.ctx.Done())
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func TestFilter_matches(t *testing.T) {
+	msg := &protocol.Message{
+		PayloadType: protocol.PayloadCQ,
+		Source: protocol.Contact{
+			Callsign: []byte("OE1ABC-5"),
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"payload type", Filter{PayloadTypes: []protocol.PayloadType{protocol.PayloadAck, protocol.PayloadCQ}}, true},
+		{"other payload type", Filter{PayloadTypes: []protocol.PayloadType{protocol.PayloadAck}}, false},
+		{"source without ssid", Filter{Sources: []string{"oe1abc"}}, true},
+		{"source wildcard", Filter{Sources: []string{"OE1*"}}, true},
+		{"other source", Filter{Sources: []string{"OE1XYZ"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(msg); got != tt.want {
+				t.Errorf("Filter.matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscription_deliver(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow OverflowPolicy
+		want     []uint64
+	}{
+		{"drop newest", OverflowDropNewest, []uint64{1, 2}},
+		{"drop oldest", OverflowDropOldest, []uint64{2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &subscription{
+				filter: Filter{Overflow: tt.overflow},
+				ch:     make(chan Delivery, 2),
+				ctx:    context.Background(),
+			}
+
+			for i := uint64(1); i <= 3; i++ {
+				s.deliver(Delivery{Message: &protocol.Message{SeqCounter: i}}, nil)
+			}
+
+			if s.dropped != 1 {
+				t.Errorf("dropped = %d, want 1", s.dropped)
+			}
+
+			for _, w := range tt.want {
+				if d := <-s.ch; d.Message.SeqCounter != w {
+					t.Errorf("got message %d, want %d", d.Message.SeqCounter, w)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscription_deliverBlock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &subscription{
+		filter: Filter{Overflow: OverflowBlock},
+		ch:     make(chan Delivery, 1),
+		ctx:    ctx,
+	}
+
+	s.deliver(Delivery{Message: &protocol.Message{SeqCounter: 1}}, nil)
+
+	done := make(chan interface{})
+	go func() {
+		s.deliver(Delivery{Message: &protocol.Message{SeqCounter: 2}}, nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("deliver did not block on a full channel")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-s.ch
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("deliver did not continue after the channel was drained")
+	}
+
+	// a cancelled subscriber must not block the delivery
+	cancel()
+	s.deliver(Delivery{Message: &protocol.Message{SeqCounter: 3}}, nil)
+
+	if s.dropped != 1 {
+		t.Errorf("dropped = %d, want 1", s.dropped)
+	}
+}
+
+func TestNode_SubscribeAndRegistry(t *testing.T) {
+	const count = 20
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := testNode(t, ctx, "OE1AAA")
+	b := testNode(t, ctx, "OE1BBB", a.settings.Port)
+
+	decoded := make(chan string, count)
+
+	err := a.RegisterPayload(&PayloadHandler{
+		Type: protocol.PayloadDebug,
+		Decode: func(buf []byte) (interface{}, error) {
+			if len(buf) == 0 {
+				return nil, errors.New("empty payload")
+			}
+
+			return string(buf), nil
+		},
+		Handle: func(msg *protocol.Message, payload interface{}, src *Peer) {
+			decoded <- payload.(string)
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterPayload() error = %v", err)
+	}
+
+	if err := a.RegisterPayload(&PayloadHandler{
+		Type:   protocol.PayloadDebug,
+		Handle: func(*protocol.Message, interface{}, *Peer) {},
+	}); err == nil {
+		t.Error("RegisterPayload() registered a payload type twice")
+	}
+
+	sctx, scancel := context.WithCancel(ctx)
+	msgs := a.Subscribe(sctx, Filter{
+		PayloadTypes: []protocol.PayloadType{protocol.PayloadDebug},
+		Sources:      []string{"OE1BBB"},
+		Buffer:       count,
+	})
+
+	waitFor(t, 5*time.Second, "peers to connect", func() bool {
+		return connected(a) && connected(b)
+	})
+
+	for i := uint64(1); i <= count; i++ {
+		m := testMessage(b, i)
+		m.PayloadType = protocol.PayloadDebug
+
+		if err := b.SpreadMessage(m); err != nil {
+			t.Fatalf("SpreadMessage() error = %v", err)
+		}
+	}
+
+	// messages of other types are not delivered to the subscription
+	if err := a.SpreadMessage(testMessage(a, 1)); err != nil {
+		t.Fatalf("SpreadMessage() error = %v", err)
+	}
+
+	for i := uint64(1); i <= count; i++ {
+		select {
+		case d := <-msgs:
+			if d.Message.SeqCounter != i || d.Message.PayloadType != protocol.PayloadDebug {
+				t.Fatalf("got message %d of type %d, want %d", d.Message.SeqCounter, d.Message.PayloadType, i)
+			}
+
+			if d.Peer == nil {
+				t.Errorf("delivery without peer")
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for message %d", i)
+		}
+
+		select {
+		case p := <-decoded:
+			if p != "test" {
+				t.Errorf("decoded payload = %q, want %q", p, "test")
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for the payload handler")
+		}
+	}
+
+	scancel()
+
+	select {
+	case _, ok := <-msgs:
+		if ok {
+			t.Error("unexpected message after the subscription was cancelled")
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Error("subscription channel not closed")
+	}
+}
@@ -0,0 +1,350 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+// Default values for the topology map.
+const (
+	topologyDefaultHalfLife = 600
+	topologyDefaultMaxAge   = 3600
+)
+
+// topologyPruneInterval is the interval in which stale entries are removed.
+const topologyPruneInterval = time.Minute
+
+// TopologyNode is a station seen in the message paths.
+type TopologyNode struct {
+	Callsign string             `json:"callsign"`
+	LastSeen time.Time          `json:"lastSeen"`
+	Position *protocol.Position `json:"position,omitempty"`
+}
+
+// TopologyEdge is an adjacency of two stations. The weight counts the
+// observations and decays with the configured half-life.
+type TopologyEdge struct {
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Weight   float64   `json:"weight"`
+	Count    uint64    `json:"count"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// TopologyGraph is a snapshot of the topology map.
+type TopologyGraph struct {
+	Local string         `json:"local"`
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+}
+
+type topologyKey struct {
+	a, b string
+}
+
+// newTopologyKey orders the callsigns, the adjacencies are undirected.
+func newTopologyKey(a, b string) topologyKey {
+	if b < a {
+		a, b = b, a
+	}
+
+	return topologyKey{a: a, b: b}
+}
+
+// located is the position of a station and the time it was set.
+type located struct {
+	position protocol.Position
+	at       time.Time
+}
+
+// topology aggregates the adjacencies seen in the message paths.
+type topology struct {
+	local     string
+	halfLife  time.Duration
+	maxAge    time.Duration
+	edges     map[topologyKey]*TopologyEdge
+	nodes     map[string]*TopologyNode
+	positions map[string]located
+	now       func() time.Time
+	lock      sync.Mutex
+}
+
+func newTopology(local string, s parameters.TopologySettings) *topology {
+	if s.HalfLife <= 0 {
+		s.HalfLife = topologyDefaultHalfLife
+	}
+
+	if s.MaxAge <= 0 {
+		s.MaxAge = topologyDefaultMaxAge
+	}
+
+	return &topology{
+		local:     strings.ToUpper(local),
+		halfLife:  seconds(s.HalfLife),
+		maxAge:    seconds(s.MaxAge),
+		edges:     make(map[topologyKey]*TopologyEdge),
+		nodes:     make(map[string]*TopologyNode),
+		positions: make(map[string]located),
+		now:       time.Now,
+	}
+}
+
+// decay returns the weight after the elapsed time.
+func (t *topology) decay(w float64, elapsed time.Duration) float64 {
+	return w * math.Pow(0.5, float64(elapsed)/float64(t.halfLife))
+}
+
+// observe records the adjacencies of a path received at the local station.
+// Segments that are no valid callsigns are skipped, the stations next to
+// them are not taken as adjacent.
+func (t *topology) observe(path string) {
+	segs := pathSegments(strings.ToUpper(path))
+	if len(segs) == 0 {
+		return
+	}
+
+	segs = append(segs, t.local)
+	now := t.now()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i, s := range segs {
+		if !protocol.ValidCallsign(s) {
+			continue
+		}
+
+		n, ok := t.nodes[s]
+		if !ok {
+			n = &TopologyNode{Callsign: s}
+			t.nodes[s] = n
+		}
+		n.LastSeen = now
+
+		if i == 0 || segs[i-1] == s || !protocol.ValidCallsign(segs[i-1]) {
+			continue
+		}
+
+		key := newTopologyKey(segs[i-1], s)
+		e, ok := t.edges[key]
+		if !ok {
+			e = &TopologyEdge{From: key.a, To: key.b}
+			t.edges[key] = e
+		}
+
+		e.Weight = t.decay(e.Weight, now.Sub(e.LastSeen)) + 1
+		e.Count++
+		e.LastSeen = now
+	}
+}
+
+// run removes the stale entries until the context is done.
+func (t *topology) run(ctx context.Context) {
+	tick := time.NewTicker(topologyPruneInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-tick.C:
+			now := t.now()
+
+			t.lock.Lock()
+			t.prune(now)
+			t.lock.Unlock()
+		}
+	}
+}
+
+// prune removes the edges, nodes and positions older than the maximum age,
+// the position of the local station is kept. The lock must be held.
+func (t *topology) prune(now time.Time) {
+	for k, e := range t.edges {
+		if now.Sub(e.LastSeen) > t.maxAge {
+			delete(t.edges, k)
+		}
+	}
+
+	for k, n := range t.nodes {
+		if now.Sub(n.LastSeen) > t.maxAge {
+			delete(t.nodes, k)
+		}
+	}
+
+	for k, l := range t.positions {
+		if k != t.local && now.Sub(l.at) > t.maxAge {
+			delete(t.positions, k)
+		}
+	}
+}
+
+// locate sets the position of a station.
+func (t *topology) locate(callsign string, p protocol.Position) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.positions[strings.ToUpper(callsign)] = located{position: p, at: t.now()}
+}
+
+// graph returns a snapshot with the decayed weights, sorted by callsign.
+func (t *topology) graph() TopologyGraph {
+	now := t.now()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.prune(now)
+
+	g := TopologyGraph{
+		Local: t.local,
+		Nodes: []TopologyNode{},
+		Edges: []TopologyEdge{},
+	}
+
+	for _, n := range t.nodes {
+		c := *n
+		if l, ok := t.positions[n.Callsign]; ok {
+			p := l.position
+			c.Position = &p
+		}
+
+		g.Nodes = append(g.Nodes, c)
+	}
+
+	for _, e := range t.edges {
+		c := *e
+		c.Weight = t.decay(e.Weight, now.Sub(e.LastSeen))
+		g.Edges = append(g.Edges, c)
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].Callsign < g.Nodes[j].Callsign
+	})
+
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+
+		return g.Edges[i].To < g.Edges[j].To
+	})
+
+	return g
+}
+
+// DOT renders the graph in the GraphViz DOT language.
+func (g *TopologyGraph) DOT() string {
+	var b bytes.Buffer
+
+	b.WriteString("graph hamgo {\n")
+
+	for _, n := range g.Nodes {
+		if n.Callsign == g.Local {
+			fmt.Fprintf(&b, "\t%q [shape=doublecircle];\n", n.Callsign)
+		} else {
+			fmt.Fprintf(&b, "\t%q;\n", n.Callsign)
+		}
+	}
+
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%q -- %q [weight=%.3f, label=\"%.1f\"];\n", e.From, e.To, e.Weight, e.Weight)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// GeoJSONFeature is a feature of a GeoJSON feature collection.
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONGeometry is a point or line string geometry.
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// GeoJSONFeatureCollection is a GeoJSON document.
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSON renders the located stations as points and the adjacencies of
+// located stations as lines.
+func (g *TopologyGraph) GeoJSON() GeoJSONFeatureCollection {
+	fc := GeoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []GeoJSONFeature{},
+	}
+
+	positions := make(map[string]*protocol.Position)
+
+	for _, n := range g.Nodes {
+		if n.Position == nil {
+			continue
+		}
+
+		positions[n.Callsign] = n.Position
+
+		fc.Features = append(fc.Features, GeoJSONFeature{
+			Type: "Feature",
+			Geometry: GeoJSONGeometry{
+				Type:        "Point",
+				Coordinates: []float64{n.Position.Lon, n.Position.Lat},
+			},
+			Properties: map[string]interface{}{
+				"callsign": n.Callsign,
+				"lastSeen": n.LastSeen,
+				"local":    n.Callsign == g.Local,
+			},
+		})
+	}
+
+	for _, e := range g.Edges {
+		from, to := positions[e.From], positions[e.To]
+		if from == nil || to == nil {
+			continue
+		}
+
+		fc.Features = append(fc.Features, GeoJSONFeature{
+			Type: "Feature",
+			Geometry: GeoJSONGeometry{
+				Type:        "LineString",
+				Coordinates: [][]float64{{from.Lon, from.Lat}, {to.Lon, to.Lat}},
+			},
+			Properties: map[string]interface{}{
+				"from":     e.From,
+				"to":       e.To,
+				"weight":   e.Weight,
+				"lastSeen": e.LastSeen,
+			},
+		})
+	}
+
+	return fc
+}
+
+// Topology returns the network topology derived from the message paths.
+func (n *Node) Topology() TopologyGraph {
+	return n.topology.graph()
+}
+
+// LocateStation sets the position of a station in the topology map.
+func (n *Node) LocateStation(callsign string, p protocol.Position) {
+	n.topology.locate(callsign, p)
+}
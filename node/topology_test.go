@@ -0,0 +1,106 @@
+package node
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donothingloop/hamgo/parameters"
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+func TestTopology(t *testing.T) {
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	topo := newTopology("oe1aaa", parameters.TopologySettings{HalfLife: 60, MaxAge: 300})
+	topo.now = func() time.Time { return now }
+
+	topo.observe(";OE1CCC;oe1bbb")
+	topo.observe(";OE1BBB")
+	topo.observe("")
+
+	g := topo.graph()
+
+	if len(g.Nodes) != 3 || g.Nodes[0].Callsign != "OE1AAA" {
+		t.Fatalf("graph() nodes = %+v", g.Nodes)
+	}
+
+	if len(g.Edges) != 2 {
+		t.Fatalf("graph() edges = %+v", g.Edges)
+	}
+
+	// the adjacencies are undirected
+	ab := g.Edges[0]
+	if ab.From != "OE1AAA" || ab.To != "OE1BBB" || ab.Count != 2 || ab.Weight != 2 {
+		t.Errorf("unexpected edge %+v", ab)
+	}
+
+	// the weight halves with every half-life
+	now = now.Add(time.Minute)
+	if w := topo.graph().Edges[0].Weight; math.Abs(w-1) > 1e-9 {
+		t.Errorf("decayed weight = %v, want 1", w)
+	}
+
+	topo.observe(";OE1BBB")
+	if w := topo.graph().Edges[0].Weight; math.Abs(w-2) > 1e-9 {
+		t.Errorf("weight = %v, want 2", w)
+	}
+
+	topo.locate("OE1AAA", protocol.Position{Lat: 48.2, Lon: 16.4})
+	topo.locate("OE1BBB", protocol.Position{Lat: 47.1, Lon: 15.4})
+
+	g = topo.graph()
+	if fc := g.GeoJSON(); len(fc.Features) != 3 {
+		t.Errorf("GeoJSON() features = %+v", fc.Features)
+	}
+
+	if dot := g.DOT(); !strings.Contains(dot, "\"OE1BBB\" -- \"OE1CCC\"") {
+		t.Errorf("DOT() = %s", dot)
+	}
+
+	// the stale adjacencies are removed
+	now = now.Add(5 * time.Minute)
+	topo.observe(";OE1BBB")
+
+	if g := topo.graph(); len(g.Edges) != 1 || len(g.Nodes) != 2 {
+		t.Errorf("graph() after max age = %+v", g)
+	}
+
+	// the stale positions are removed, the local one is kept
+	now = now.Add(time.Minute)
+
+	topo.lock.Lock()
+	topo.prune(now)
+	_, local := topo.positions["OE1AAA"]
+	_, remote := topo.positions["OE1BBB"]
+	topo.lock.Unlock()
+
+	if !local || remote {
+		t.Errorf("positions after max age: local %v, remote %v", local, remote)
+	}
+}
+
+func TestTopology_invalidSegments(t *testing.T) {
+	topo := newTopology("OE1AAA", parameters.TopologySettings{})
+
+	topo.observe(";OE1CCC;NOCALL;OE1BBB")
+	topo.observe(";" + strings.Repeat("X", 300))
+	topo.observe(";not a callsign;;OE1DDD")
+
+	g := topo.graph()
+
+	var nodes []string
+	for _, n := range g.Nodes {
+		nodes = append(nodes, n.Callsign)
+	}
+
+	if strings.Join(nodes, ",") != "OE1AAA,OE1BBB,OE1CCC,OE1DDD" {
+		t.Errorf("graph() nodes = %v", nodes)
+	}
+
+	// OE1CCC is not adjacent to OE1BBB
+	if len(g.Edges) != 2 || g.Edges[0].To != "OE1BBB" || g.Edges[1].To != "OE1DDD" {
+		t.Errorf("graph() edges = %+v", g.Edges)
+	}
+}
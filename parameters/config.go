@@ -1,33 +1,162 @@
 package parameters
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
-	"github.com/Sirupsen/logrus"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
 )
 
 // Config stores the configuration for the servers.
 type Config struct {
 	REST    RESTSettings `json:"rest"`
+	DNS     DNSSettings  `json:"dns"`
+	MDNS    MDNSSettings `json:"mdns"`
 	Node    Settings     `json:"node"`
 	Station Station      `json:"station"`
 }
 
-// ReadConfig reads the configuration JSON file.
-func ReadConfig(file string) *Config {
+// Config file formats.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+)
+
+// DefaultConfig returns the configuration used for the settings that are
+// missing in the config file.
+func DefaultConfig() Config {
+	return Config{
+		REST: RESTSettings{
+			Port:     9125,
+			Frontend: "public/",
+		},
+		DNS: DNSSettings{
+			Listen:     ":5353",
+			Zone:       "hamgo",
+			StationTTL: 60,
+		},
+		MDNS: MDNSSettings{
+			Interval: 120,
+		},
+		Node: Settings{
+			Port:             9124,
+			PeerQueueSize:    2048,
+			Retries:          5,
+			ReconnectTimeout: 5,
+			ShutdownTimeout:  5,
+			LogicSettings: LogicSettings{
+				CacheSize: 2048,
+			},
+		},
+	}
+}
+
+// configFormat returns the format of a config file by its extension.
+func configFormat(file string) (string, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".toml":
+		return FormatTOML, nil
+	}
+
+	return "", errors.New("unsupported format, use .json, .yaml, .yml or .toml")
+}
+
+// yamlToJSON converts the maps decoded from YAML to maps with string keys.
+func yamlToJSON(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = yamlToJSON(e)
+		}
+
+		return m
+
+	case []interface{}:
+		for i, e := range t {
+			t[i] = yamlToJSON(e)
+		}
+	}
+
+	return v
+}
+
+// decodeConfig decodes the settings of a file over the defaults. YAML and
+// TOML are converted to JSON, so all formats use the same names.
+func decodeConfig(dat []byte, format string, cfg *Config) error {
+	if format != FormatJSON {
+		var doc interface{}
+
+		if format == FormatYAML {
+			if err := yaml.Unmarshal(dat, &doc); err != nil {
+				return err
+			}
+
+			doc = yamlToJSON(doc)
+		} else {
+			m := map[string]interface{}{}
+			if _, err := toml.Decode(string(dat), &m); err != nil {
+				return err
+			}
+
+			doc = m
+		}
+
+		var err error
+		if dat, err = json.Marshal(doc); err != nil {
+			return err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(dat))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(cfg)
+}
+
+// LoadConfig reads a JSON, YAML or TOML config file, applies the HAMGO_*
+// environment overrides and validates the result. The returned errors are a
+// *FileError, *ParseError or *ValidationError.
+func LoadConfig(file string) (*Config, error) {
+	return loadConfig(file, os.LookupEnv)
+}
+
+func loadConfig(file string, lookup func(string) (string, bool)) (*Config, error) {
+	format, err := configFormat(file)
+	if err != nil {
+		return nil, &FileError{File: file, Err: err}
+	}
+
 	dat, err := ioutil.ReadFile(file)
 	if err != nil {
-		logrus.WithError(err).Fatalf("Failed to read config file %s", file)
-		return nil
+		return nil, &FileError{File: file, Err: err}
+	}
+
+	cfg := DefaultConfig()
+
+	if err := decodeConfig(dat, format, &cfg); err != nil {
+		return nil, &ParseError{File: file, Format: format, Err: err}
 	}
 
-	cfg := Config{}
+	verr := &ValidationError{Errors: applyEnv(&cfg, lookup)}
+	cfg.validate(verr)
 
-	// unmarshal the config
-	if err := json.Unmarshal(dat, &cfg); err != nil {
-		logrus.WithError(err).Fatal("Failed to parse config")
+	if err := verr.errorOrNil(); err != nil {
+		return nil, err
 	}
 
-	return &cfg
+	cfg.normalize()
+	return &cfg, nil
 }
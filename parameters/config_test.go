@@ -0,0 +1,281 @@
+package parameters
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeConfig writes a config file into a temporary directory.
+func writeConfig(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "hamgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+// fields returns the sorted fields of the field errors.
+func fields(err error) []string {
+	res := []string{}
+
+	if verr, ok := err.(*ValidationError); ok {
+		for _, e := range verr.Errors {
+			switch e := e.(type) {
+			case *FieldError:
+				res = append(res, e.Field)
+			case *EnvError:
+				res = append(res, e.Variable)
+			}
+		}
+	}
+
+	sort.Strings(res)
+	return res
+}
+
+func Test_envName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"port", "PORT"},
+		{"peerQueueSize", "PEER_QUEUE_SIZE"},
+		{"stationTTL", "STATION_TTL"},
+		{"readonly", "READONLY"},
+		{"allowNets", "ALLOW_NETS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := envName(tt.name); got != tt.want {
+				t.Errorf("envName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_loadConfig_formats(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "JSON",
+			file: "hamgo.json",
+			content: `{
+				"node": {"port": 7000, "peers": [{"host": "44.143.0.1", "port": 9124}], "logic": {"role": "relay"}},
+				"station": {"callsign": "oe1xyz", "identities": [{"callsign": "oe1xyz-5", "payloadTypes": [9]}]}
+			}`,
+		},
+		{
+			name: "YAML",
+			file: "hamgo.yml",
+			content: `
+node:
+  port: 7000
+  peers:
+    - host: 44.143.0.1
+      port: 9124
+  logic:
+    role: relay
+station:
+  callsign: oe1xyz
+  identities:
+    - callsign: oe1xyz-5
+      payloadTypes: [9]
+`,
+		},
+		{
+			name: "TOML",
+			file: "hamgo.toml",
+			content: `
+[node]
+port = 7000
+
+[[node.peers]]
+host = "44.143.0.1"
+port = 9124
+
+[node.logic]
+role = "relay"
+
+[station]
+callsign = "oe1xyz"
+
+[[station.identities]]
+callsign = "oe1xyz-5"
+payloadTypes = [9]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeConfig(t, tt.file, tt.content)
+			defer os.RemoveAll(filepath.Dir(file))
+
+			cfg, err := loadConfig(file, noEnv)
+			if err != nil {
+				t.Fatalf("loadConfig() error = %v", err)
+			}
+
+			want := DefaultConfig()
+			want.Node.Port = 7000
+			want.Node.Peers = []PeerSettings{{Host: "44.143.0.1", Port: 9124}}
+			want.Node.LogicSettings.Role = "relay"
+			want.Station.Callsign = "OE1XYZ"
+			want.Station.Identities = []Identity{{Callsign: "OE1XYZ-5", PayloadTypes: []uint{9}}}
+
+			if !reflect.DeepEqual(*cfg, want) {
+				t.Errorf("loadConfig() = %+v, want %+v", *cfg, want)
+			}
+		})
+	}
+}
+
+func Test_loadConfig_sample(t *testing.T) {
+	if _, err := loadConfig("../hamgo.sample.json", noEnv); err != nil {
+		t.Errorf("sample config: %v", err)
+	}
+}
+
+func Test_loadConfig_env(t *testing.T) {
+	file := writeConfig(t, "hamgo.json", `{"station": {"callsign": "OE1XYZ"}}`)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	env := map[string]string{
+		"HAMGO_NODE_PORT":                 "7000",
+		"HAMGO_NODE_LOGIC_CACHE_SIZE":     "64",
+		"HAMGO_NODE_ACL_DENY_CALLSIGNS":   "OE1AAA, OE1BBB",
+		"HAMGO_DNS_ENABLED":               "true",
+		"HAMGO_STATION_LAT":               "48.2",
+		"HAMGO_STATION_LON":               "16.37",
+		"HAMGO_NODE_BACKOFF_MULTIPLIER":   "1.5",
+		"HAMGO_NODE_SHAPING_GLOBAL_BURST": "1024",
+	}
+
+	cfg, err := loadConfig(file, func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	if cfg.Node.Port != 7000 || cfg.Node.LogicSettings.CacheSize != 64 || !cfg.DNS.Enabled {
+		t.Errorf("scalar overrides not applied: %+v", cfg)
+	}
+
+	if !reflect.DeepEqual(cfg.Node.ACL.DenyCallsigns, []string{"OE1AAA", "OE1BBB"}) {
+		t.Errorf("denyCallsigns = %v", cfg.Node.ACL.DenyCallsigns)
+	}
+
+	if cfg.Station.Lat == nil || *cfg.Station.Lat != 48.2 || cfg.Station.Lon == nil || *cfg.Station.Lon != 16.37 {
+		t.Errorf("position = %v, %v", cfg.Station.Lat, cfg.Station.Lon)
+	}
+
+	if cfg.Node.Backoff.Multiplier != 1.5 || cfg.Node.Shaping.Global.Burst != 1024 {
+		t.Errorf("nested overrides not applied: %+v", cfg.Node)
+	}
+}
+
+func Test_loadConfig_errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		env     map[string]string
+		check   func(error) bool
+		fields  []string
+	}{
+		{
+			name:  "missing file",
+			file:  "missing.json",
+			check: func(err error) bool { _, ok := err.(*FileError); return ok },
+		},
+		{
+			name:    "unsupported format",
+			file:    "hamgo.ini",
+			content: "port=1",
+			check:   func(err error) bool { _, ok := err.(*FileError); return ok },
+		},
+		{
+			name:    "syntax error",
+			file:    "hamgo.json",
+			content: `{"node": `,
+			check:   func(err error) bool { _, ok := err.(*ParseError); return ok },
+		},
+		{
+			name:    "unknown setting",
+			file:    "hamgo.yaml",
+			content: "node:\n  prot: 9124\n",
+			check:   func(err error) bool { _, ok := err.(*ParseError); return ok },
+		},
+		{
+			name: "invalid settings",
+			file: "hamgo.json",
+			content: `{
+				"node": {"port": 0, "peers": [{"host": "", "port": 9124}], "logic": {"cacheSize": 0}},
+				"station": {"callsign": "NOCALL"}
+			}`,
+			check:  func(err error) bool { _, ok := err.(*ValidationError); return ok },
+			fields: []string{"node.logic.cacheSize", "node.peers[0].host", "node.port", "station.callsign"},
+		},
+		{
+			name:    "invalid environment",
+			file:    "hamgo.json",
+			content: `{"station": {"callsign": "OE1XYZ"}}`,
+			env:     map[string]string{"HAMGO_NODE_PORT": "abc", "HAMGO_NODE_PEERS": "x", "HAMGO_REST_PORT": "70000"},
+			check:   func(err error) bool { _, ok := err.(*ValidationError); return ok },
+			fields:  []string{"HAMGO_NODE_PEERS", "HAMGO_NODE_PORT", "rest.port"},
+		},
+		{
+			name: "invalid names",
+			file: "hamgo.json",
+			content: `{
+				"node": {"queues": {"bulk": {"drop": "all"}}, "acl": {"denyNets": ["44.0.0.0/33"]},
+					"logic": {"role": "leaf", "readonly": true, "filters": [{"type": "maxPayload", "stage": "send"}]}},
+				"station": {"callsign": "OE1XYZ", "locator": "ZZ99"}
+			}`,
+			check: func(err error) bool { _, ok := err.(*ValidationError); return ok },
+			fields: []string{
+				"node.acl.denyNets", "node.logic.filters[0].maxSize", "node.logic.filters[0].stage",
+				"node.logic.readonly", "node.queues.bulk.drop", "station.locator",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(os.TempDir(), "hamgo-missing", tt.file)
+			if tt.content != "" {
+				file = writeConfig(t, tt.file, tt.content)
+				defer os.RemoveAll(filepath.Dir(file))
+			}
+
+			_, err := loadConfig(file, func(k string) (string, bool) {
+				v, ok := tt.env[k]
+				return v, ok
+			})
+			if err == nil || !tt.check(err) {
+				t.Fatalf("loadConfig() error = %#v", err)
+			}
+
+			if got := fields(err); tt.fields != nil && !reflect.DeepEqual(got, tt.fields) {
+				t.Errorf("fields = %v, want %v\n%v", got, tt.fields, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package parameters
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// envPrefix is the prefix of the environment overrides.
+const envPrefix = "HAMGO"
+
+// envName converts the json name of a setting to upper snake case, e.g.
+// peerQueueSize to PEER_QUEUE_SIZE.
+func envName(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && unicode.IsLower(runes[i-1]) {
+			b.WriteByte('_')
+		}
+
+		b.WriteRune(unicode.ToUpper(r))
+	}
+
+	return b.String()
+}
+
+// jsonName returns the name of a field in the config file, empty if the
+// field is not decoded.
+func jsonName(f reflect.StructField) string {
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	if tag == "-" || f.PkgPath != "" {
+		return ""
+	}
+
+	if tag == "" {
+		return f.Name
+	}
+
+	return tag
+}
+
+// applyEnv overrides the settings with the HAMGO_* variables, e.g.
+// HAMGO_NODE_PORT or HAMGO_NODE_LOGIC_CACHE_SIZE. Lists are separated by
+// commas, lists of objects such as the peers cannot be overridden.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) []error {
+	return applyEnvStruct(reflect.ValueOf(cfg).Elem(), envPrefix, lookup)
+}
+
+func applyEnvStruct(v reflect.Value, prefix string, lookup func(string) (string, bool)) []error {
+	errs := []error{}
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := jsonName(t.Field(i))
+		if name == "" {
+			continue
+		}
+
+		variable := prefix + "_" + envName(name)
+		field := v.Field(i)
+
+		if field.Kind() == reflect.Struct {
+			errs = append(errs, applyEnvStruct(field, variable, lookup)...)
+			continue
+		}
+
+		val, ok := lookup(variable)
+		if !ok {
+			continue
+		}
+
+		if err := setValue(field, val); err != nil {
+			errs = append(errs, &EnvError{Variable: variable, Value: val, Err: err})
+		}
+	}
+
+	return errs
+}
+
+// setValue parses a value into a setting.
+func setValue(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("invalid boolean")
+		}
+
+		v.SetBool(b)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("invalid unsigned number")
+		}
+
+		v.SetUint(n)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("invalid number")
+		}
+
+		v.SetInt(n)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New("invalid number")
+		}
+
+		v.SetFloat(f)
+
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		if err := setValue(p.Elem(), s); err != nil {
+			return err
+		}
+
+		v.Set(p)
+
+	case reflect.Slice:
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+
+		for _, item := range strings.Split(s, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := setValue(e, item); err != nil {
+				return err
+			}
+
+			list = reflect.Append(list, e)
+		}
+
+		v.Set(list)
+
+	default:
+		return errors.New("setting cannot be set from the environment")
+	}
+
+	return nil
+}
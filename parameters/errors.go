@@ -0,0 +1,80 @@
+package parameters
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FileError is returned if the config file cannot be read or its format is
+// not supported.
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("config file %s: %v", e.File, e.Err)
+}
+
+// ParseError is returned if the config file cannot be decoded.
+type ParseError struct {
+	File   string
+	Format string
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("failed to parse %s config %s: %v", e.Format, e.File, e.Err)
+}
+
+// EnvError is returned for an environment override that cannot be parsed.
+type EnvError struct {
+	Variable string
+	Value    string
+	Err      error
+}
+
+func (e *EnvError) Error() string {
+	return fmt.Sprintf("%s=%q: %v", e.Variable, e.Value, e.Err)
+}
+
+// FieldError describes an invalid setting, the field is the path of the
+// setting in the config file, e.g. node.peers[0].port.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists all problems of a configuration, the errors are
+// field and environment errors.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	lines := []string{"invalid configuration:"}
+
+	for _, err := range e.Errors {
+		lines = append(lines, "  - "+err.Error())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// add records a field error.
+func (e *ValidationError) add(field string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, &FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// errorOrNil returns the validation error if any problem was recorded.
+func (e *ValidationError) errorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
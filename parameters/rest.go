@@ -2,7 +2,37 @@ package parameters
 
 // RESTSettings defines the settings for the HTTP rest server.
 type RESTSettings struct {
-	Port     uint   `json:"port"`
-	CORS     bool   `json:"cors"`
+	// Port of the HTTP server, defaults to 9125
+	Port uint `json:"port"`
+	CORS bool `json:"cors"`
+	// Frontend directory served under /, defaults to "public/"
 	Frontend string `json:"frontend"`
 }
+
+// DNSSettings defines the settings for the built-in DNS server.
+type DNSSettings struct {
+	Enabled bool `json:"enabled"`
+	// Listen address for UDP and TCP, defaults to ":5353"
+	Listen string `json:"listen,omitempty"`
+	// Zone the stations and services are served under, defaults to "hamgo"
+	Zone string `json:"zone,omitempty"`
+	// StationTTL in seconds of the station records, defaults to 60
+	StationTTL uint `json:"stationTTL,omitempty"`
+}
+
+// MDNSSettings defines the settings of the bridge between mDNS/DNS-SD on the
+// LAN and the network.
+type MDNSSettings struct {
+	Enabled bool `json:"enabled"`
+	// Interface the mDNS group is joined on, empty for the default interface
+	Interface string `json:"interface,omitempty"`
+	// Allow lists the service types crossing the bridge, e.g. "http" or
+	// "_ipp._tcp", empty for all types
+	Allow []string `json:"allow"`
+	// Deny lists the service types that never cross the bridge
+	Deny []string `json:"deny"`
+	// Advertise the remote services on the LAN
+	Advertise bool `json:"advertise"`
+	// Interval in seconds the LAN is browsed, defaults to 120
+	Interval uint `json:"interval,omitempty"`
+}
@@ -4,21 +4,173 @@ package parameters
 type PeerSettings struct {
 	Host string `json:"host"`
 	Port uint   `json:"port"`
+	// Shaping overrides the default per-peer rate limit
+	Shaping *TokenBucketSettings `json:"shaping,omitempty"`
+}
+
+// TokenBucketSettings configures a token bucket rate limit.
+type TokenBucketSettings struct {
+	// Rate in bytes per second, 0 disables the limit
+	Rate uint `json:"rate,omitempty"`
+	// Burst in bytes, defaults to one second worth of traffic
+	Burst uint `json:"burst,omitempty"`
+}
+
+// ShapingSettings configures the bandwidth shaping of outbound traffic.
+type ShapingSettings struct {
+	// Global limit shared by all peers
+	Global TokenBucketSettings `json:"global"`
+	// Peer is the default limit for every single peer
+	Peer TokenBucketSettings `json:"peer"`
+	// Unshaped lists priority classes that are never throttled, e.g. "high"
+	Unshaped []string `json:"unshaped,omitempty"`
+}
+
+// BackoffSettings configures the reconnect backoff of outbound peers.
+// All durations are given in seconds.
+type BackoffSettings struct {
+	// Initial delay before reconnecting, defaults to ReconnectTimeout
+	Initial float64 `json:"initial,omitempty"`
+	// Max caps the delay between two attempts
+	Max float64 `json:"max,omitempty"`
+	// Multiplier is applied to the delay after every failed attempt
+	Multiplier float64 `json:"multiplier,omitempty"`
+	// Jitter randomizes the delay by the given fraction, a negative value disables it
+	Jitter float64 `json:"jitter,omitempty"`
+	// Stable is the time a connection has to be up before the backoff is reset
+	Stable float64 `json:"stable,omitempty"`
+}
+
+// ReliableSettings configures the defaults of the reliable broadcasts.
+// All durations are given in seconds.
+type ReliableSettings struct {
+	// Interval before the first retransmission, it doubles after every retransmission
+	Interval float64 `json:"interval,omitempty"`
+	// MaxInterval caps the delay between two retransmissions
+	MaxInterval float64 `json:"maxInterval,omitempty"`
+	// Deadline after which the delivery is given up
+	Deadline float64 `json:"deadline,omitempty"`
+}
+
+// TopologySettings configures the topology map. All durations are given in seconds.
+type TopologySettings struct {
+	// HalfLife of the adjacency weights
+	HalfLife float64 `json:"halfLife,omitempty"`
+	// MaxAge after which unseen adjacencies and stations are removed
+	MaxAge float64 `json:"maxAge,omitempty"`
+}
+
+// DirectorySettings configures the station directory.
+type DirectorySettings struct {
+	// MaxStations in the directory, the station heard least recently is removed first
+	MaxStations uint `json:"maxStations,omitempty"`
+}
+
+// DiscoverySettings configures the defaults of the service queries.
+type DiscoverySettings struct {
+	// TTL limits the hops a query is flooded
+	TTL uint `json:"ttl,omitempty"`
+	// Timeout in seconds the replies are collected
+	Timeout float64 `json:"timeout,omitempty"`
+}
+
+// QueueClassSettings configures a priority class of the peer queues.
+type QueueClassSettings struct {
+	// Size in messages, defaults to PeerQueueSize
+	Size uint `json:"size,omitempty"`
+	// Drop defines which message is dropped if the queue is full, "oldest" or "newest"
+	Drop string `json:"drop,omitempty"`
+}
+
+// QueueSettings configures the priority classes of the peer queues.
+type QueueSettings struct {
+	High   QueueClassSettings `json:"high"`
+	Normal QueueClassSettings `json:"normal"`
+	Bulk   QueueClassSettings `json:"bulk"`
+}
+
+// RateLimitSettings configures a message rate limit.
+type RateLimitSettings struct {
+	// Rate in messages per second, 0 disables the limit
+	Rate float64 `json:"rate,omitempty"`
+	// Burst in messages, defaults to one second worth of messages
+	Burst uint `json:"burst,omitempty"`
+}
+
+// FloodSettings configures the flood protection for received messages.
+type FloodSettings struct {
+	// Source limits the messages per source callsign
+	Source RateLimitSettings `json:"source"`
+	// Peer limits the messages per ingress peer
+	Peer RateLimitSettings `json:"peer"`
+	// QuarantineDrops is the number of consecutive drops after which a peer is quarantined, 0 disables it
+	QuarantineDrops uint `json:"quarantineDrops,omitempty"`
+	// QuarantineTime in seconds during which all messages of the peer are dropped
+	QuarantineTime uint `json:"quarantineTime,omitempty"`
+}
+
+// ACLSettings defines the access control lists of the node. Deny entries
+// take precedence, a non-empty allow list only admits matching entries.
+type ACLSettings struct {
+	// AllowCallsigns and DenyCallsigns match sources, wildcards and SSIDs are supported
+	AllowCallsigns []string `json:"allowCallsigns"`
+	DenyCallsigns  []string `json:"denyCallsigns"`
+	// AllowPeers and DenyPeers match the identities peers announce, with the
+	// same patterns as the callsign lists
+	AllowPeers []string `json:"allowPeers"`
+	DenyPeers  []string `json:"denyPeers"`
+	// AllowNets and DenyNets match inbound connections in CIDR notation
+	AllowNets []string `json:"allowNets"`
+	DenyNets  []string `json:"denyNets"`
+}
+
+// FilterSettings configures a built-in message filter. Empty match lists
+// match all messages.
+type FilterSettings struct {
+	Name string `json:"name,omitempty"`
+	// Type of the filter: maxPayload, dropPayload or stripIPs
+	Type string `json:"type"`
+	// Stage the filter runs in: receive, cache, relay or egress
+	Stage        string   `json:"stage"`
+	PayloadTypes []uint   `json:"payloadTypes,omitempty"`
+	ContactTypes []uint   `json:"contactTypes,omitempty"`
+	Peers        []string `json:"peers,omitempty"`
+	// MaxSize of the payload in bytes for the maxPayload filter
+	MaxSize uint `json:"maxSize,omitempty"`
 }
 
 // LogicSettings provides settings for the node logic component.
 type LogicSettings struct {
-	// CacheSize in messages
+	// CacheSize in messages, defaults to 2048
 	CacheSize uint `json:"cacheSize"`
-	ReadOnly  bool `json:"readonly,omitempty"`
+	// Role of the node: full, relay, leaf or observer, defaults to full
+	Role string `json:"role,omitempty"`
+	// ReadOnly is a relay node if no role is given
+	ReadOnly bool             `json:"readonly,omitempty"`
+	Filters  []FilterSettings `json:"filters,omitempty"`
 }
 
 // Settings stores the settings of the node.
 type Settings struct {
-	Port             uint           `json:"port"`
-	PeerQueueSize    uint           `json:"peerQueueSize"`
-	Retries          uint           `json:"retries"`
-	Peers            []PeerSettings `json:"peers"`
-	ReconnectTimeout uint           `json:"reconnectTimeout"`
-	LogicSettings    LogicSettings  `json:"logic"`
+	// Port of the TCP server, defaults to 9124
+	Port uint `json:"port"`
+	// PeerQueueSize in messages, defaults to 2048
+	PeerQueueSize uint            `json:"peerQueueSize"`
+	Queues        QueueSettings   `json:"queues"`
+	Shaping       ShapingSettings `json:"shaping"`
+	Flood         FloodSettings   `json:"flood"`
+	ACL           ACLSettings     `json:"acl"`
+	// Retries of a message to a peer, defaults to 5
+	Retries uint           `json:"retries"`
+	Peers   []PeerSettings `json:"peers"`
+	// ReconnectTimeout in seconds, defaults to 5
+	ReconnectTimeout uint `json:"reconnectTimeout"`
+	// ShutdownTimeout in seconds to drain the peer queues on shutdown, defaults to 5
+	ShutdownTimeout uint              `json:"shutdownTimeout,omitempty"`
+	Backoff         BackoffSettings   `json:"backoff"`
+	Reliable        ReliableSettings  `json:"reliable"`
+	Topology        TopologySettings  `json:"topology"`
+	Directory       DirectorySettings `json:"directory"`
+	Discovery       DiscoverySettings `json:"discovery"`
+	LogicSettings   LogicSettings     `json:"logic"`
 }
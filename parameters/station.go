@@ -3,4 +3,19 @@ package parameters
 // Station defines the station parameters for the local station.
 type Station struct {
 	Callsign string `json:"callsign"`
+	// Locator is the Maidenhead locator of the station, e.g. JN88ee
+	Locator string `json:"locator,omitempty"`
+	// Lat and Lon in degrees, derived from the locator if not set
+	Lat *float64 `json:"lat,omitempty"`
+	Lon *float64 `json:"lon,omitempty"`
+	// Identities are additional callsigns the node sends as, e.g. a club
+	// call or the SSIDs of services
+	Identities []Identity `json:"identities,omitempty"`
+}
+
+// Identity is a local callsign of the node.
+type Identity struct {
+	Callsign string `json:"callsign"`
+	// PayloadTypes limits the payload types sent as the identity, empty allows all
+	PayloadTypes []uint `json:"payloadTypes,omitempty"`
 }
@@ -1,6 +1,8 @@
 package parameters
 
+import "github.com/donothingloop/hamgo/protocol"
+
 const (
 	// TransportMaxPackageSize defines the maximum package size that is allowed on transport between peers.
-	TransportMaxPackageSize = 1024 * 256
+	TransportMaxPackageSize = protocol.MaxPackageSize
 )
@@ -0,0 +1,219 @@
+package parameters
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/donothingloop/hamgo/protocol"
+)
+
+// Names accepted by the node, see the node package.
+var (
+	roleNames        = []string{"", "full", "relay", "leaf", "observer"}
+	priorityNames    = []string{"high", "normal", "bulk"}
+	dropNames        = []string{"", "oldest", "newest"}
+	filterTypeNames  = []string{"maxPayload", "dropPayload", "stripIPs"}
+	filterStageNames = []string{"receive", "cache", "relay", "egress"}
+)
+
+func oneOf(v string, names []string) bool {
+	for _, n := range names {
+		if v == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validPort(p uint) bool {
+	return p > 0 && p <= 65535
+}
+
+// Validate checks all settings and returns a *ValidationError listing the
+// problems, nil if the configuration is valid.
+func (c *Config) Validate() error {
+	verr := &ValidationError{}
+	c.validate(verr)
+
+	return verr.errorOrNil()
+}
+
+func (c *Config) validate(verr *ValidationError) {
+	c.Station.validate(verr)
+	c.Node.validate(verr)
+
+	if !validPort(c.REST.Port) {
+		verr.add("rest.port", "must be between 1 and 65535")
+	}
+
+	if c.DNS.Enabled {
+		if _, _, err := net.SplitHostPort(c.DNS.Listen); err != nil {
+			verr.add("dns.listen", "must be host:port")
+		}
+
+		if strings.Trim(c.DNS.Zone, ".") == "" {
+			verr.add("dns.zone", "required")
+		}
+	}
+
+	if c.MDNS.Enabled && c.MDNS.Interval == 0 {
+		verr.add("mdns.interval", "must be positive")
+	}
+}
+
+func (s *Station) validate(verr *ValidationError) {
+	if _, err := protocol.ParseCallsign(s.Callsign); err != nil {
+		verr.add("station.callsign", "%q is not a valid callsign", s.Callsign)
+	}
+
+	if _, err := protocol.ResolvePosition(s.Locator, s.Lat, s.Lon); err != nil {
+		verr.add("station.locator", "%v", err)
+	}
+
+	for i, id := range s.Identities {
+		field := fmt.Sprintf("station.identities[%d]", i)
+
+		if _, err := protocol.ParseCallsign(id.Callsign); err != nil {
+			verr.add(field+".callsign", "%q is not a valid callsign", id.Callsign)
+		}
+	}
+}
+
+func (s *Settings) validate(verr *ValidationError) {
+	if !validPort(s.Port) {
+		verr.add("node.port", "must be between 1 and 65535")
+	}
+
+	if s.PeerQueueSize == 0 {
+		verr.add("node.peerQueueSize", "must be positive")
+	}
+
+	for i, p := range s.Peers {
+		field := fmt.Sprintf("node.peers[%d]", i)
+
+		if strings.TrimSpace(p.Host) == "" {
+			verr.add(field+".host", "required")
+		}
+
+		if !validPort(p.Port) {
+			verr.add(field+".port", "must be between 1 and 65535")
+		}
+	}
+
+	for i, q := range []QueueClassSettings{s.Queues.High, s.Queues.Normal, s.Queues.Bulk} {
+		if !oneOf(q.Drop, dropNames) {
+			verr.add("node.queues."+priorityNames[i]+".drop", "must be oldest or newest")
+		}
+	}
+
+	for _, u := range s.Shaping.Unshaped {
+		if !oneOf(u, priorityNames) {
+			verr.add("node.shaping.unshaped", "unknown priority class %q", u)
+		}
+	}
+
+	if s.Flood.Source.Rate < 0 {
+		verr.add("node.flood.source.rate", "must not be negative")
+	}
+
+	if s.Flood.Peer.Rate < 0 {
+		verr.add("node.flood.peer.rate", "must not be negative")
+	}
+
+	s.ACL.validate(verr)
+
+	b := s.Backoff
+	if b.Initial < 0 || b.Max < 0 || b.Stable < 0 {
+		verr.add("node.backoff", "durations must not be negative")
+	}
+
+	if b.Multiplier != 0 && b.Multiplier < 1 {
+		verr.add("node.backoff.multiplier", "must be at least 1")
+	}
+
+	if b.Jitter > 1 {
+		verr.add("node.backoff.jitter", "must not be greater than 1")
+	}
+
+	r := s.Reliable
+	if r.Interval < 0 || r.MaxInterval < 0 || r.Deadline < 0 {
+		verr.add("node.reliable", "durations must not be negative")
+	}
+
+	if s.Topology.HalfLife < 0 || s.Topology.MaxAge < 0 {
+		verr.add("node.topology", "durations must not be negative")
+	}
+
+	if s.Discovery.TTL > 255 {
+		verr.add("node.discovery.ttl", "must not be greater than 255")
+	}
+
+	if s.Discovery.Timeout < 0 {
+		verr.add("node.discovery.timeout", "must not be negative")
+	}
+
+	s.LogicSettings.validate(verr)
+}
+
+func (a *ACLSettings) validate(verr *ValidationError) {
+	lists := []struct {
+		field string
+		nets  []string
+	}{
+		{"node.acl.allowNets", a.AllowNets},
+		{"node.acl.denyNets", a.DenyNets},
+	}
+
+	for _, l := range lists {
+		for _, n := range l.nets {
+			n = strings.TrimSpace(n)
+
+			if net.ParseIP(n) == nil {
+				if _, _, err := net.ParseCIDR(n); err != nil {
+					verr.add(l.field, "invalid network %q", n)
+				}
+			}
+		}
+	}
+}
+
+func (l *LogicSettings) validate(verr *ValidationError) {
+	if l.CacheSize == 0 {
+		verr.add("node.logic.cacheSize", "must be positive")
+	}
+
+	role := strings.ToLower(l.Role)
+	if !oneOf(role, roleNames) {
+		verr.add("node.logic.role", "must be full, relay, leaf or observer")
+	} else if l.ReadOnly && (role == "full" || role == "leaf") {
+		verr.add("node.logic.readonly", "conflicts with role %s", role)
+	}
+
+	for i, f := range l.Filters {
+		field := fmt.Sprintf("node.logic.filters[%d]", i)
+
+		if !oneOf(f.Type, filterTypeNames) {
+			verr.add(field+".type", "must be maxPayload, dropPayload or stripIPs")
+		}
+
+		if !oneOf(f.Stage, filterStageNames) {
+			verr.add(field+".stage", "must be receive, cache, relay or egress")
+		}
+
+		if f.Type == "maxPayload" && f.MaxSize == 0 {
+			verr.add(field+".maxSize", "must be positive")
+		}
+	}
+}
+
+// normalize converts the callsigns to their usual spelling, the config
+// must be valid.
+func (c *Config) normalize() {
+	c.Station.Callsign, _ = protocol.NormalizeCallsign(c.Station.Callsign)
+
+	for i, id := range c.Station.Identities {
+		c.Station.Identities[i].Callsign, _ = protocol.NormalizeCallsign(id.Callsign)
+	}
+}
@@ -17,7 +17,7 @@ func TestParseACKPayload(t *testing.T) {
 		{
 			name: "ACK parse",
 			args: args{
-				buf: []byte{0x00, 0x00, 0x00, 0xab, 0x00, 0x00, 0x00},
+				buf: []byte{0x00, 0x00, 0x00, 0xab, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
 			},
 			want: &ACKPayload{
 				SeqCounter: 0xab,
@@ -63,7 +63,7 @@ func TestACKPayload_Bytes(t *testing.T) {
 				},
 			},
 			want: []byte{
-				0x00, 0x00, 0x00, 0xab, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0xab, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
 			},
 		},
 	}
@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MaxSSID is the highest secondary station identifier.
+const MaxSSID = 15
+
+var (
+	// baseCall matches ITU callsigns: a prefix, a digit and a suffix that
+	// ends with a letter, e.g. OE1XYZ, 9A1AA or 3DA0RU
+	baseCall = regexp.MustCompile(`^(?:[0-9]?[A-Z]{1,2}|[A-Z][0-9])[0-9][A-Z0-9]{0,3}[A-Z]$`)
+	// callAffix matches the prefix or suffix of portable operation, e.g.
+	// OE/ or /P
+	callAffix = regexp.MustCompile(`^[A-Z0-9]{1,4}$`)
+)
+
+// Callsign is a parsed callsign, e.g. OE/DL1ABC/P-7.
+type Callsign struct {
+	// Prefix of the country of operation, e.g. OE
+	Prefix string
+	// Call is the callsign without prefix and suffix, e.g. DL1ABC
+	Call string
+	// Suffix of the operation, e.g. P or MM
+	Suffix string
+	// SSID distinguishes the stations of an operator, 0 if not set
+	SSID uint8
+}
+
+// ParseCallsign parses a callsign with an optional prefix, suffix and SSID.
+// The case is ignored.
+func ParseCallsign(s string) (Callsign, error) {
+	c := Callsign{}
+	call := strings.ToUpper(strings.TrimSpace(s))
+
+	if i := strings.LastIndex(call, "-"); i != -1 {
+		ssid, err := strconv.ParseUint(call[i+1:], 10, 8)
+		if err != nil || ssid > MaxSSID || len(call[i+1:]) > 2 {
+			return c, fmt.Errorf("invalid SSID in callsign %q", s)
+		}
+
+		c.SSID = uint8(ssid)
+		call = call[:i]
+	}
+
+	parts := strings.Split(call, "/")
+
+	switch len(parts) {
+	case 1:
+		c.Call = parts[0]
+
+	case 2:
+		// either OE/DL1ABC or DL1ABC/P, a suffix is shorter than a call
+		if baseCall.MatchString(parts[0]) && callAffix.MatchString(parts[1]) {
+			c.Call, c.Suffix = parts[0], parts[1]
+		} else {
+			c.Prefix, c.Call = parts[0], parts[1]
+		}
+
+	case 3:
+		c.Prefix, c.Call, c.Suffix = parts[0], parts[1], parts[2]
+
+	default:
+		return c, fmt.Errorf("invalid callsign %q", s)
+	}
+
+	if !baseCall.MatchString(c.Call) ||
+		(c.Prefix != "" && !callAffix.MatchString(c.Prefix)) ||
+		(c.Suffix != "" && !callAffix.MatchString(c.Suffix)) {
+		return c, fmt.Errorf("invalid callsign %q", s)
+	}
+
+	return c, nil
+}
+
+// NormalizeCallsign returns the usual spelling of a callsign, the SSID 0 is
+// omitted.
+func NormalizeCallsign(s string) (string, error) {
+	c, err := ParseCallsign(s)
+	if err != nil {
+		return "", err
+	}
+
+	return c.String(), nil
+}
+
+// ValidCallsign checks if a callsign is valid and normalized.
+func ValidCallsign(s string) bool {
+	n, err := NormalizeCallsign(s)
+	return err == nil && n == s
+}
+
+// String returns the callsign in the usual spelling, e.g. OE/DL1ABC/P-7.
+func (c Callsign) String() string {
+	s := c.Call
+
+	if c.Prefix != "" {
+		s = c.Prefix + "/" + s
+	}
+
+	if c.Suffix != "" {
+		s += "/" + c.Suffix
+	}
+
+	if c.SSID != 0 {
+		s += "-" + strconv.Itoa(int(c.SSID))
+	}
+
+	return s
+}
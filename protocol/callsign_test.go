@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCallsign(t *testing.T) {
+	tests := []struct {
+		name    string
+		call    string
+		want    Callsign
+		wantErr bool
+	}{
+		{name: "Basic", call: "OE1XYZ", want: Callsign{Call: "OE1XYZ"}},
+		{name: "Lower case", call: "oe1xyz", want: Callsign{Call: "OE1XYZ"}},
+		{name: "Digit prefix", call: "9A1AA", want: Callsign{Call: "9A1AA"}},
+		{name: "Three character prefix", call: "3DA0RU", want: Callsign{Call: "3DA0RU"}},
+		{name: "SSID", call: "OE1XYZ-15", want: Callsign{Call: "OE1XYZ", SSID: 15}},
+		{name: "Country prefix", call: "OE/DL1ABC", want: Callsign{Prefix: "OE", Call: "DL1ABC"}},
+		{name: "Long country prefix", call: "VP2E/DL1ABC", want: Callsign{Prefix: "VP2E", Call: "DL1ABC"}},
+		{name: "Portable", call: "DL1ABC/P", want: Callsign{Call: "DL1ABC", Suffix: "P"}},
+		{name: "Prefix, suffix and SSID", call: "oe/dl1abc/mm-7", want: Callsign{Prefix: "OE", Call: "DL1ABC", Suffix: "MM", SSID: 7}},
+		{name: "Empty", call: "", wantErr: true},
+		{name: "No digit", call: "NOCALL", wantErr: true},
+		{name: "Ends with digit", call: "OE1XY1", wantErr: true},
+		{name: "Too long", call: "OE1ABCDE", wantErr: true},
+		{name: "SSID out of range", call: "OE1XYZ-16", wantErr: true},
+		{name: "Empty SSID", call: "OE1XYZ-", wantErr: true},
+		{name: "Empty suffix", call: "DL1ABC/", wantErr: true},
+		{name: "Too many parts", call: "OE/DL1ABC/P/M", wantErr: true},
+		{name: "Invalid characters", call: "OE1X Z", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCallsign(tt.call)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCallsign() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCallsign() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCallsign(t *testing.T) {
+	tests := []struct {
+		name string
+		call string
+		want string
+	}{
+		{name: "Upper case", call: "oe1xyz", want: "OE1XYZ"},
+		{name: "SSID 0 omitted", call: "OE1XYZ-0", want: "OE1XYZ"},
+		{name: "Leading zero", call: "OE1XYZ-07", want: "OE1XYZ-7"},
+		{name: "Full", call: " oe/dl1abc/p-3 ", want: "OE/DL1ABC/P-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeCallsign(tt.call)
+			if err != nil {
+				t.Fatalf("NormalizeCallsign() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("NormalizeCallsign() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContact_ValidCallsign(t *testing.T) {
+	tests := []struct {
+		name    string
+		contact Contact
+		want    bool
+	}{
+		{name: "Valid", contact: Contact{CallsignLength: 8, Callsign: []byte("OE1XYZ-5")}, want: true},
+		{name: "Empty", contact: Contact{}, want: false},
+		{name: "Not normalized", contact: Contact{CallsignLength: 6, Callsign: []byte("oe1xyz")}, want: false},
+		{name: "Length mismatch", contact: Contact{CallsignLength: 5, Callsign: []byte("OE1XYZ")}, want: false},
+		{name: "Invalid", contact: Contact{CallsignLength: 6, Callsign: []byte("NOCALL")}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.contact.ValidCallsign(); got != tt.want {
+				t.Errorf("Contact.ValidCallsign() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
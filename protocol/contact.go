@@ -5,8 +5,6 @@ import (
 	"encoding/hex"
 
 	"github.com/Sirupsen/logrus"
-
-	"github.com/donothingloop/hamgo/parameters"
 )
 
 // ContactType defines the type of the contact.
@@ -43,6 +41,20 @@ type Contact struct {
 	IPs            []ContactIP `json:"ips"`
 }
 
+// Clone returns a deep copy of the contact.
+func (c *Contact) Clone() Contact {
+	cc := *c
+	cc.Callsign = append([]byte{}, c.Callsign...)
+	cc.IPs = make([]ContactIP, len(c.IPs))
+
+	for i, ip := range c.IPs {
+		cc.IPs[i] = ip
+		cc.IPs[i].Data = append([]byte{}, ip.Data...)
+	}
+
+	return cc
+}
+
 // Bytes converts the ip address to bytes.
 func (c *ContactIP) Bytes() []byte {
 	buf := make([]byte, 2+len(c.Data))
@@ -114,9 +126,21 @@ func (c *Contact) Compare(other *Contact) bool {
 		(c.equalIPs(other))
 }
 
+// SameCallsign checks if both contacts have the same callsign. Copies of a
+// message are identified by the callsign and sequence counter of the source,
+// as the IPs of the source may be stripped on the way.
+func (c *Contact) SameCallsign(other *Contact) bool {
+	return bytes.Equal(c.Callsign, other.Callsign)
+}
+
+// ValidCallsign checks if the callsign of the contact is valid and normalized.
+func (c *Contact) ValidCallsign() bool {
+	return int(c.CallsignLength) == len(c.Callsign) && ValidCallsign(string(c.Callsign))
+}
+
 // Bytes converts the contact to bytes.
 func (c *Contact) Bytes() []byte {
-	buf := make([]byte, parameters.TransportMaxPackageSize)
+	buf := make([]byte, MaxPackageSize)
 	idx := 0
 
 	buf[idx] = uint8(c.Type)
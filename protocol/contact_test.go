@@ -47,7 +47,7 @@ func TestParseContactIP(t *testing.T) {
 	tests := []struct {
 		name  string
 		args  args
-		want  ContactIP
+		want  *ContactIP
 		want1 int
 	}{
 		{
@@ -55,7 +55,7 @@ func TestParseContactIP(t *testing.T) {
 			args: args{
 				buf: []byte{0x01, 0x02, 0x01, 0x02},
 			},
-			want: ContactIP{
+			want: &ContactIP{
 				Type:   0x01,
 				Length: 0x02,
 				Data:   []byte{0x01, 0x02},
@@ -135,7 +135,7 @@ func TestParseContact(t *testing.T) {
 	tests := []struct {
 		name  string
 		args  args
-		want  Contact
+		want  *Contact
 		want1 []byte
 	}{
 		{
@@ -143,7 +143,7 @@ func TestParseContact(t *testing.T) {
 			args: args{
 				msg: []byte{0x01, 0x02, 0x03, 0x04, 0x02, 0x05, 0x03, 0x08, 0x09, 0x0a, 0x06, 0x01, 0x01, 0xaa},
 			},
-			want: Contact{
+			want: &Contact{
 				Type:           0x01,
 				CallsignLength: 0x02,
 				Callsign:       []byte{0x03, 0x04},
@@ -340,3 +340,29 @@ func TestContact_Compare(t *testing.T) {
 		})
 	}
 }
+
+func TestContact_SameCallsign(t *testing.T) {
+	withIP := Contact{
+		CallsignLength: 6,
+		Callsign:       []byte("OE1ABC"),
+		NumberIPs:      1,
+		IPs:            []ContactIP{{Type: ContactIPv4, Length: 4, Data: []byte{10, 0, 0, 1}}},
+	}
+
+	tests := []struct {
+		name  string
+		other Contact
+		want  bool
+	}{
+		{"equal", withIP, true},
+		{"stripped ips", Contact{CallsignLength: 6, Callsign: []byte("OE1ABC")}, true},
+		{"other callsign", Contact{CallsignLength: 7, Callsign: []byte("OE1ABCD")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withIP.SameCallsign(&tt.other); got != tt.want {
+				t.Errorf("Contact.SameCallsign() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+)
+
+// cqPositionSeparator separates the text of a CQ message from the position,
+// older nodes show the text up to the separator.
+const cqPositionSeparator = 0
+
+// CQPayload is the text of a CQ message with the optional position of the sender.
+type CQPayload struct {
+	Message  string    `json:"message"`
+	Position *Position `json:"position,omitempty"`
+}
+
+// Validate checks if the payload can be encoded.
+func (c *CQPayload) Validate() error {
+	if bytes.IndexByte([]byte(c.Message), cqPositionSeparator) >= 0 {
+		return errors.New("message contains a NUL character")
+	}
+
+	if c.Position != nil {
+		if err := c.Position.Validate(); err != nil {
+			return err
+		}
+
+		if len(c.Position.Locator) > LocatorExtendedSquare {
+			return errors.New("locator too long")
+		}
+	}
+
+	return nil
+}
+
+// Bytes converts the payload to bytes, the payload must be valid.
+func (c *CQPayload) Bytes() []byte {
+	buf := []byte(c.Message)
+
+	if c.Position != nil {
+		buf = append(buf, cqPositionSeparator)
+		buf = appendPosition(buf, c.Position)
+	}
+
+	return buf
+}
+
+// ParseCQPayload parses a CQ message, payloads without a position are plain text.
+func ParseCQPayload(buf []byte) (*CQPayload, error) {
+	i := bytes.IndexByte(buf, cqPositionSeparator)
+	if i < 0 {
+		return &CQPayload{Message: string(buf)}, nil
+	}
+
+	p, _, err := parsePosition(buf[i+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &CQPayload{Message: string(buf[:i]), Position: p}, nil
+}
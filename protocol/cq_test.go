@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCQPayload_Bytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload CQPayload
+		want    []byte
+	}{
+		{
+			name:    "Text only",
+			payload: CQPayload{Message: "cq"},
+			want:    []byte{'c', 'q'},
+		},
+		{
+			name:    "With position",
+			payload: CQPayload{Message: "cq", Position: &Position{Locator: "JN88", Lat: 48.5, Lon: 17}},
+			want:    []byte{'c', 'q', 0x00, 0x04, 'J', 'N', '8', '8', 32, 13, 228, 2, 64, 102, 3, 1},
+		},
+		{
+			name:    "Empty text with position",
+			payload: CQPayload{Position: &Position{Lat: 48.208, Lon: 16.373}},
+			want:    []byte{0x00, 0x00, 128, 152, 223, 2, 8, 213, 249, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.payload.Validate(); err != nil {
+				t.Fatalf("CQPayload.Validate() error = %v", err)
+			}
+
+			if got := tt.payload.Bytes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CQPayload.Bytes() = %v, want %v", got, tt.want)
+			}
+
+			got, err := ParseCQPayload(tt.want)
+			if err != nil {
+				t.Fatalf("ParseCQPayload() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(*got, tt.payload) {
+				t.Errorf("ParseCQPayload() = %+v, want %+v", *got, tt.payload)
+			}
+		})
+	}
+}
+
+func TestCQPayload_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload CQPayload
+	}{
+		{name: "NUL in text", payload: CQPayload{Message: "c\x00q"}},
+		{name: "Invalid locator", payload: CQPayload{Position: &Position{Locator: "ZZ99"}}},
+		{name: "Invalid latitude", payload: CQPayload{Position: &Position{Lat: -91}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.payload.Validate(); err == nil {
+				t.Error("CQPayload.Validate() accepted an invalid payload")
+			}
+		})
+	}
+}
+
+func TestParseCQPayload(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{name: "Missing position", buf: []byte{'c', 'q', 0x00}},
+		{name: "Short coordinates", buf: []byte{'c', 'q', 0x00, 0x00, 0x01, 0x02}},
+		{name: "Latitude out of range", buf: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x7f, 0x00, 0x00, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCQPayload(tt.buf); err == nil {
+				t.Error("ParseCQPayload() accepted an invalid payload")
+			}
+		})
+	}
+}
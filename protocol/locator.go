@@ -0,0 +1,225 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Maidenhead locator precisions in characters.
+const (
+	LocatorField          = 2
+	LocatorSquare         = 4
+	LocatorSubsquare      = 6
+	LocatorExtendedSquare = 8
+)
+
+// earthRadius is the mean radius of the earth in km.
+const earthRadius = 6371.0
+
+// coordinateScale converts degrees to the fixed point wire format.
+const coordinateScale = 1e6
+
+var errPositionInvalid = errors.New("position invalid")
+
+// Position is a geographic position in degrees with its Maidenhead locator.
+type Position struct {
+	Locator string  `json:"locator"`
+	Lat     float64 `json:"lat"`
+	Lon     float64 `json:"lon"`
+}
+
+// cellSizes are the sizes in degrees of the cells of each pair of locator
+// characters, longitude first.
+var cellSizes = [4][2]float64{
+	{20, 10},
+	{2, 1},
+	{2.0 / 24, 1.0 / 24},
+	{2.0 / 240, 1.0 / 240},
+}
+
+// ParseLocator returns the center of the area of a Maidenhead locator with
+// 2, 4, 6 or 8 characters, e.g. JN88 or JN88ee.
+func ParseLocator(loc string) (lat float64, lon float64, err error) {
+	loc = strings.ToUpper(loc)
+
+	if len(loc) < LocatorField || len(loc) > LocatorExtendedSquare || len(loc)%2 != 0 {
+		return 0, 0, fmt.Errorf("invalid locator %q", loc)
+	}
+
+	lon, lat = -180, -90
+
+	for i := 0; i < len(loc)/2; i++ {
+		first, max := byte('A'), byte('R')
+
+		switch i {
+		case 1, 3:
+			first, max = '0', '9'
+		case 2:
+			max = 'X'
+		}
+
+		x, y := loc[2*i], loc[2*i+1]
+		if x < first || x > max || y < first || y > max {
+			return 0, 0, fmt.Errorf("invalid locator %q", loc)
+		}
+
+		lon += float64(x-first) * cellSizes[i][0]
+		lat += float64(y-first) * cellSizes[i][1]
+	}
+
+	// the center of the last cell
+	last := cellSizes[len(loc)/2-1]
+	return lat + last[1]/2, lon + last[0]/2, nil
+}
+
+// ValidLocator checks if a Maidenhead locator is valid.
+func ValidLocator(loc string) bool {
+	_, _, err := ParseLocator(loc)
+	return err == nil
+}
+
+// Locator returns the Maidenhead locator of a position with the precision in
+// characters. Subsquares are written in lower case, e.g. JN88ee.
+func Locator(lat float64, lon float64, precision int) (string, error) {
+	if precision < LocatorField || precision > LocatorExtendedSquare || precision%2 != 0 {
+		return "", fmt.Errorf("invalid locator precision %d", precision)
+	}
+
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return "", errPositionInvalid
+	}
+
+	// the poles and the antimeridian belong to the last cell
+	x := math.Min(lon+180, 360-1e-9)
+	y := math.Min(lat+90, 180-1e-9)
+
+	buf := make([]byte, 0, precision)
+	for i, s := range cellSizes[:precision/2] {
+		first := byte('A')
+
+		switch i {
+		case 1, 3:
+			first = '0'
+		case 2:
+			first = 'a'
+		}
+
+		cx, cy := math.Floor(x/s[0]), math.Floor(y/s[1])
+		buf = append(buf, first+byte(cx), first+byte(cy))
+
+		x -= cx * s[0]
+		y -= cy * s[1]
+	}
+
+	return string(buf), nil
+}
+
+// ResolvePosition builds a position from a locator and/or coordinates, the
+// missing part is derived from the other one. Nil is returned if neither is set.
+func ResolvePosition(loc string, lat *float64, lon *float64) (*Position, error) {
+	if (lat == nil) != (lon == nil) {
+		return nil, errors.New("latitude and longitude required")
+	}
+
+	if loc == "" && lat == nil {
+		return nil, nil
+	}
+
+	p := &Position{}
+
+	if loc != "" {
+		var err error
+		if p.Lat, p.Lon, err = ParseLocator(loc); err != nil {
+			return nil, err
+		}
+
+		p.Locator = normalizeLocator(loc)
+	}
+
+	if lat != nil {
+		p.Lat, p.Lon = *lat, *lon
+
+		if p.Locator == "" {
+			l, err := Locator(p.Lat, p.Lon, LocatorSubsquare)
+			if err != nil {
+				return nil, err
+			}
+
+			p.Locator = l
+		}
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// normalizeLocator returns the usual spelling of a locator, e.g. JN88ee.
+func normalizeLocator(loc string) string {
+	if len(loc) <= LocatorSquare {
+		return strings.ToUpper(loc)
+	}
+
+	return strings.ToUpper(loc[:LocatorSquare]) + strings.ToLower(loc[LocatorSquare:])
+}
+
+// Validate checks the coordinates and the locator of the position.
+func (p *Position) Validate() error {
+	if math.IsNaN(p.Lat) || math.IsNaN(p.Lon) || p.Lat < -90 || p.Lat > 90 || p.Lon < -180 || p.Lon > 180 {
+		return errors.New("coordinates out of range")
+	}
+
+	if p.Locator != "" && !ValidLocator(p.Locator) {
+		return fmt.Errorf("invalid locator %q", p.Locator)
+	}
+
+	return nil
+}
+
+// Distance returns the great circle distance to another position in km.
+func (p *Position) Distance(o *Position) float64 {
+	rad := math.Pi / 180
+	lat1, lat2 := p.Lat*rad, o.Lat*rad
+	dlat := (o.Lat - p.Lat) * rad
+	dlon := (o.Lon - p.Lon) * rad
+
+	a := math.Sin(dlat/2)*math.Sin(dlat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dlon/2)*math.Sin(dlon/2)
+
+	return 2 * earthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// appendPosition appends the locator and the coordinates in micro degrees.
+func appendPosition(buf []byte, p *Position) []byte {
+	buf = appendString(buf, p.Locator)
+
+	var num [8]byte
+	binary.LittleEndian.PutUint32(num[0:4], uint32(int32(math.Round(p.Lat*coordinateScale))))
+	binary.LittleEndian.PutUint32(num[4:8], uint32(int32(math.Round(p.Lon*coordinateScale))))
+
+	return append(buf, num[:]...)
+}
+
+// parsePosition parses a position and returns the remainder.
+func parsePosition(buf []byte) (*Position, []byte, error) {
+	loc, buf, err := parseString(buf)
+	if err != nil || len(buf) < 8 {
+		return nil, nil, errPositionInvalid
+	}
+
+	p := &Position{
+		Locator: loc,
+		Lat:     float64(int32(binary.LittleEndian.Uint32(buf[0:4]))) / coordinateScale,
+		Lon:     float64(int32(binary.LittleEndian.Uint32(buf[4:8]))) / coordinateScale,
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, nil, errPositionInvalid
+	}
+
+	return p, buf[8:], nil
+}
@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseLocator(t *testing.T) {
+	tests := []struct {
+		name    string
+		loc     string
+		lat     float64
+		lon     float64
+		wantErr bool
+	}{
+		{name: "Field", loc: "JN", lat: 45, lon: 10},
+		{name: "Square", loc: "JN88", lat: 48.5, lon: 17},
+		{name: "Subsquare", loc: "jn88EE", lat: 48.1875, lon: 16.375},
+		{name: "Extended square", loc: "JN88ee50", lat: 48.16875, lon: 16.3791667},
+		{name: "Odd length", loc: "JN8", wantErr: true},
+		{name: "Field out of range", loc: "ZZ", wantErr: true},
+		{name: "Subsquare out of range", loc: "JN88zz", wantErr: true},
+		{name: "Too long", loc: "JN88ee50aa", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, lon, err := ParseLocator(tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLocator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if math.Abs(lat-tt.lat) > 1e-6 || math.Abs(lon-tt.lon) > 1e-6 {
+				t.Errorf("ParseLocator() = %v, %v, want %v, %v", lat, lon, tt.lat, tt.lon)
+			}
+		})
+	}
+}
+
+func TestLocator(t *testing.T) {
+	tests := []struct {
+		name      string
+		lat       float64
+		lon       float64
+		precision int
+		want      string
+		wantErr   bool
+	}{
+		{name: "Vienna square", lat: 48.208, lon: 16.373, precision: LocatorSquare, want: "JN88"},
+		{name: "Vienna subsquare", lat: 48.208, lon: 16.373, precision: LocatorSubsquare, want: "JN88ee"},
+		{name: "Vienna extended", lat: 48.208, lon: 16.373, precision: LocatorExtendedSquare, want: "JN88ee49"},
+		{name: "South west corner", lat: -90, lon: -180, precision: LocatorSubsquare, want: "AA00aa"},
+		{name: "North east corner", lat: 90, lon: 180, precision: LocatorSubsquare, want: "RR99xx"},
+		{name: "Invalid precision", lat: 0, lon: 0, precision: 3, wantErr: true},
+		{name: "Out of range", lat: 91, lon: 0, precision: LocatorField, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Locator(tt.lat, tt.lon, tt.precision)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Locator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("Locator() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolvePosition(t *testing.T) {
+	lat, lon := 48.208, 16.373
+	badLat := 100.0
+
+	tests := []struct {
+		name    string
+		loc     string
+		lat     *float64
+		lon     *float64
+		want    *Position
+		wantErr bool
+	}{
+		{name: "Empty"},
+		{name: "Locator", loc: "jn88EE", want: &Position{Locator: "JN88ee", Lat: 48.1875, Lon: 16.375}},
+		{name: "Coordinates", lat: &lat, lon: &lon, want: &Position{Locator: "JN88ee", Lat: lat, Lon: lon}},
+		{name: "Both", loc: "JN88", lat: &lat, lon: &lon, want: &Position{Locator: "JN88", Lat: lat, Lon: lon}},
+		{name: "Latitude only", lat: &lat, wantErr: true},
+		{name: "Invalid locator", loc: "XX", wantErr: true},
+		{name: "Invalid latitude", lat: &badLat, lon: &lon, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolvePosition(tt.loc, tt.lat, tt.lon)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolvePosition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("ResolvePosition() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPosition_Distance(t *testing.T) {
+	tests := []struct {
+		name string
+		a    Position
+		b    Position
+		want float64
+	}{
+		{name: "Same", a: Position{Lat: 48.2, Lon: 16.4}, b: Position{Lat: 48.2, Lon: 16.4}, want: 0},
+		{name: "One degree at the equator", a: Position{}, b: Position{Lon: 1}, want: 111.195},
+		{name: "Vienna to Graz", a: Position{Lat: 48.208, Lon: 16.373}, b: Position{Lat: 47.071, Lon: 15.439}, want: 144.5},
+		{name: "Antipodes", a: Position{Lat: 90}, b: Position{Lat: -90}, want: math.Pi * earthRadius},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Distance(&tt.b); math.Abs(got-tt.want) > 0.5 {
+				t.Errorf("Position.Distance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"encoding/binary"
 
 	"github.com/Sirupsen/logrus"
-
-	"github.com/donothingloop/hamgo/parameters"
 )
 
+// MaxPackageSize defines the maximum size of a message on the transport.
+const MaxPackageSize = 1024 * 256
+
 // PayloadType defines the type of the payload
 type PayloadType uint16
 
@@ -21,34 +22,90 @@ const (
 	PayloadMessengerGroup     = 5
 	PayloadMessengerBroadcast = 6
 	PayloadMessengerEmergency = 7
+	PayloadHello              = 8
+	PayloadService            = 9
+	PayloadServiceQuery       = 10
+	PayloadServiceReply       = 11
 )
 
+// Version is the current version of the protocol. Version 2 added the
+// retransmission counter and the scope to the header, they follow the flags
+// if FlagRetransmission or FlagScope is set. Nodes that only speak version 1
+// cannot parse these messages.
+const Version = 2
+
+// versionExtensions is the first version with header extensions.
+const versionExtensions = 2
+
 // Flags for the protocol.
 const (
-	FlagNoCache = (1 << 0)
-	FlagACK     = (1 << 1)
+	FlagNoCache      = (1 << 0)
+	FlagACK          = (1 << 1)
+	FlagPriorityHigh = (1 << 2)
+	FlagPriorityBulk = (1 << 3)
+
+	// FlagRetransmission marks a repeated message, the retransmission
+	// counter follows the flags in the header.
+	FlagRetransmission = (1 << 4)
+
+	// FlagScope marks a message limited to a geographic area, the scope
+	// follows the retransmission counter in the header.
+	FlagScope = (1 << 5)
+
+	// flagsKnown are the flags understood by this version
+	flagsKnown = FlagNoCache | FlagACK | FlagPriorityHigh | FlagPriorityBulk | FlagRetransmission | FlagScope
+
+	// flagsExtensions are the flags that add fields to the header
+	flagsExtensions = FlagRetransmission | FlagScope
 )
 
 // Message is a message in the transport.
 type Message struct {
-	Version       uint16      `json:"version"`
-	SeqCounter    uint64      `json:"sequence"`
-	TTL           uint8       `json:"ttl"`
-	Flags         uint8       `json:"flags"`
-	Source        Contact     `json:"source"`
-	PathLength    uint16      `json:"pathLength"`
-	Path          string      `json:"path"`
-	PayloadType   PayloadType `json:"payloadType"`
-	PayloadLenght uint32      `json:"payloadLength"`
-	Payload       []byte      `json:"payload"`
+	Version        uint16      `json:"version"`
+	SeqCounter     uint64      `json:"sequence"`
+	TTL            uint8       `json:"ttl"`
+	Flags          uint8       `json:"flags"`
+	Retransmission uint8       `json:"retransmission,omitempty"`
+	Scope          *Scope      `json:"scope,omitempty"`
+	Source         Contact     `json:"source"`
+	PathLength     uint16      `json:"pathLength"`
+	Path           string      `json:"path"`
+	PayloadType    PayloadType `json:"payloadType"`
+	PayloadLenght  uint32      `json:"payloadLength"`
+	Payload        []byte      `json:"payload"`
+}
+
+// Clone returns a deep copy of the message.
+func (m *Message) Clone() *Message {
+	c := *m
+	c.Source = m.Source.Clone()
+	c.Payload = append([]byte{}, m.Payload...)
+
+	if m.Scope != nil {
+		c.Scope = m.Scope.Clone()
+	}
+
+	return &c
 }
 
 // Bytes converts the message into a byte buffer.
 func (m *Message) Bytes() []byte {
-	buf := make([]byte, parameters.TransportMaxPackageSize)
+	buf := make([]byte, MaxPackageSize)
 	idx := 0
 
-	binary.LittleEndian.PutUint16(buf[idx:], m.Version)
+	// the scope flag is only sent with a scope
+	flags := m.Flags
+	if m.Scope == nil {
+		flags &^= FlagScope
+	}
+
+	// the header extensions are not understood before their version
+	version := m.Version
+	if (flags&flagsExtensions) != 0 && version < versionExtensions {
+		version = versionExtensions
+	}
+
+	binary.LittleEndian.PutUint16(buf[idx:], version)
 	idx += 2
 
 	binary.LittleEndian.PutUint64(buf[idx:], m.SeqCounter)
@@ -57,9 +114,20 @@ func (m *Message) Bytes() []byte {
 	buf[idx] = m.TTL
 	idx++
 
-	buf[idx] = m.Flags
+	buf[idx] = flags
 	idx++
 
+	if (flags & FlagRetransmission) != 0 {
+		buf[idx] = m.Retransmission
+		idx++
+	}
+
+	if (flags & FlagScope) != 0 {
+		sb := m.Scope.Bytes()
+		copy(buf[idx:], sb)
+		idx += len(sb)
+	}
+
 	cb := m.Source.Bytes()
 	copy(buf[idx:], cb)
 	idx += len(cb)
@@ -107,6 +175,39 @@ func ParseMessage(buf []byte) (*Message, []byte) {
 	msg.Flags = buf[idx]
 	idx++
 
+	// the fields following unknown flags cannot be parsed
+	if (msg.Flags &^ flagsKnown) != 0 {
+		logrus.Warnf("Message: unknown flags %#x in version %d message", msg.Flags&^flagsKnown, msg.Version)
+		return nil, nil
+	}
+
+	if (msg.Flags&flagsExtensions) != 0 && msg.Version < versionExtensions {
+		logrus.Warnf("Message: header extensions in version %d message", msg.Version)
+		return nil, nil
+	}
+
+	if (msg.Flags & FlagRetransmission) != 0 {
+		if len(buf) < idx+1 {
+			logrus.Warn("Message: failed to parse retransmission counter")
+			return nil, nil
+		}
+
+		msg.Retransmission = buf[idx]
+		idx++
+	}
+
+	if (msg.Flags & FlagScope) != 0 {
+		sc, rbuf, err := ParseScope(buf[idx:])
+		if err != nil {
+			logrus.Warn("Message: failed to parse scope")
+			return nil, nil
+		}
+
+		msg.Scope = sc
+		buf = rbuf
+		idx = 0
+	}
+
 	ct, rbuf := ParseContact(buf[idx:])
 	if ct == nil {
 		logrus.Warn("Message: failed to parse contact")
@@ -7,16 +7,18 @@ import (
 
 func TestMessage_Bytes(t *testing.T) {
 	type fields struct {
-		Version       uint16
-		SeqCounter    uint64
-		TTL           uint8
-		Flags         uint8
-		Source        Contact
-		PathLength    uint16
-		Path          string
-		PayloadType   PayloadType
-		PayloadLenght uint32
-		Payload       []byte
+		Version        uint16
+		SeqCounter     uint64
+		TTL            uint8
+		Flags          uint8
+		Retransmission uint8
+		Scope          *Scope
+		Source         Contact
+		PathLength     uint16
+		Path           string
+		PayloadType    PayloadType
+		PayloadLenght  uint32
+		Payload        []byte
 	}
 	tests := []struct {
 		name   string
@@ -43,22 +45,114 @@ func TestMessage_Bytes(t *testing.T) {
 				PayloadLenght: 0x02,
 				Payload:       []byte{0xaa, 0xbb},
 			},
-			want: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
+			want: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
+		},
+		{
+			name: "Retransmitted message",
+			fields: fields{
+				Version:        0x0a | (0x12 << 8),
+				SeqCounter:     0x91 | (0x23 << 8),
+				TTL:            1,
+				Flags:          FlagRetransmission,
+				Retransmission: 3,
+				Source: Contact{
+					Type:           0x01,
+					CallsignLength: 0x00,
+					Callsign:       []byte{},
+					NumberIPs:      0,
+					IPs:            []ContactIP{},
+				},
+				PathLength:    2,
+				Path:          string([]byte{0xab, 0xab}),
+				PayloadType:   0x91,
+				PayloadLenght: 0x02,
+				Payload:       []byte{0xaa, 0xbb},
+			},
+			want: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x10, 0x03, 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
+		},
+		{
+			name: "Counter without flag",
+			fields: fields{
+				Version:        0x0a | (0x12 << 8),
+				SeqCounter:     0x91 | (0x23 << 8),
+				TTL:            1,
+				Retransmission: 3,
+				Source: Contact{
+					Type:           0x01,
+					CallsignLength: 0x00,
+					Callsign:       []byte{},
+					NumberIPs:      0,
+					IPs:            []ContactIP{},
+				},
+				PathLength:    2,
+				Path:          string([]byte{0xab, 0xab}),
+				PayloadType:   0x91,
+				PayloadLenght: 0x02,
+				Payload:       []byte{0xaa, 0xbb},
+			},
+			want: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
+		},
+		{
+			name: "Scoped message",
+			fields: fields{
+				Version:    0x0a | (0x12 << 8),
+				SeqCounter: 0x91 | (0x23 << 8),
+				TTL:        1,
+				Flags:      FlagScope,
+				Scope:      &Scope{Locator: "JN88"},
+				Source: Contact{
+					Type:           0x01,
+					CallsignLength: 0x00,
+					Callsign:       []byte{},
+					NumberIPs:      0,
+					IPs:            []ContactIP{},
+				},
+				PathLength:    2,
+				Path:          string([]byte{0xab, 0xab}),
+				PayloadType:   0x91,
+				PayloadLenght: 0x02,
+				Payload:       []byte{0xaa, 0xbb},
+			},
+			want: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x20, 0x00, 0x04, 'J', 'N', '8', '8', 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
+		},
+		{
+			name: "Scope flag without scope",
+			fields: fields{
+				Version:    0x0a | (0x12 << 8),
+				SeqCounter: 0x91 | (0x23 << 8),
+				TTL:        1,
+				Flags:      FlagScope,
+				Source: Contact{
+					Type:           0x01,
+					CallsignLength: 0x00,
+					Callsign:       []byte{},
+					NumberIPs:      0,
+					IPs:            []ContactIP{},
+				},
+				PathLength:    2,
+				Path:          string([]byte{0xab, 0xab}),
+				PayloadType:   0x91,
+				PayloadLenght: 0x02,
+				Payload:       []byte{0xaa, 0xbb},
+			},
+			want: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			m := &Message{
-				Version:       tt.fields.Version,
-				SeqCounter:    tt.fields.SeqCounter,
-				TTL:           tt.fields.TTL,
-				Flags:         tt.fields.Flags,
-				Source:        tt.fields.Source,
-				PathLength:    tt.fields.PathLength,
-				Path:          tt.fields.Path,
-				PayloadType:   tt.fields.PayloadType,
-				PayloadLenght: tt.fields.PayloadLenght,
-				Payload:       tt.fields.Payload,
+				Version:        tt.fields.Version,
+				SeqCounter:     tt.fields.SeqCounter,
+				TTL:            tt.fields.TTL,
+				Flags:          tt.fields.Flags,
+				Retransmission: tt.fields.Retransmission,
+				Scope:          tt.fields.Scope,
+				Source:         tt.fields.Source,
+				PathLength:     tt.fields.PathLength,
+				Path:           tt.fields.Path,
+				PayloadType:    tt.fields.PayloadType,
+				PayloadLenght:  tt.fields.PayloadLenght,
+				Payload:        tt.fields.Payload,
 			}
 			if got := m.Bytes(); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Message.Bytes() = %v, want %v", got, tt.want)
@@ -79,7 +173,7 @@ func TestParseMessage(t *testing.T) {
 		{
 			name: "Basic parse",
 			args: args{
-				buf: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
+				buf: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
 			},
 			want: Message{
 				Version:    0x0a | (0x12 << 8),
@@ -100,12 +194,109 @@ func TestParseMessage(t *testing.T) {
 				Payload:       []byte{0xaa, 0xbb},
 			},
 		},
+		{
+			name: "Retransmitted message",
+			args: args{
+				buf: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x10, 0x03, 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
+			},
+			want: Message{
+				Version:        0x0a | (0x12 << 8),
+				SeqCounter:     0x91 | (0x23 << 8),
+				TTL:            1,
+				Flags:          FlagRetransmission,
+				Retransmission: 3,
+				Source: Contact{
+					Type:           0x01,
+					CallsignLength: 0x00,
+					Callsign:       []byte{},
+					NumberIPs:      0,
+					IPs:            []ContactIP{},
+				},
+				PathLength:    2,
+				Path:          string([]byte{0xab, 0xab}),
+				PayloadType:   0x91,
+				PayloadLenght: 0x02,
+				Payload:       []byte{0xaa, 0xbb},
+			},
+		},
+		{
+			name: "Scoped message",
+			args: args{
+				buf: []byte{0x0a, 0x12, 0x91, 0x23, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x30, 0x03, 0x00, 0x04, 'J', 'N', '8', '8', 0x01, 0x00, 0x00, 0x02, 0x00, 0xab, 0xab, 0x91, 0x02, 0x00, 0x00, 0x00, 0xaa, 0xbb},
+			},
+			want: Message{
+				Version:        0x0a | (0x12 << 8),
+				SeqCounter:     0x91 | (0x23 << 8),
+				TTL:            1,
+				Flags:          FlagRetransmission | FlagScope,
+				Retransmission: 3,
+				Scope:          &Scope{Locator: "JN88"},
+				Source: Contact{
+					Type:           0x01,
+					CallsignLength: 0x00,
+					Callsign:       []byte{},
+					NumberIPs:      0,
+					IPs:            []ContactIP{},
+				},
+				PathLength:    2,
+				Path:          string([]byte{0xab, 0xab}),
+				PayloadType:   0x91,
+				PayloadLenght: 0x02,
+				Payload:       []byte{0xaa, 0xbb},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got, _ := ParseMessage(tt.args.buf); !reflect.DeepEqual(got.Bytes(), tt.want.Bytes()) {
+			got, _ := ParseMessage(tt.args.buf)
+			if got == nil {
+				t.Fatal("ParseMessage() = nil")
+			}
+
+			if got.Retransmission != tt.want.Retransmission {
+				t.Errorf("ParseMessage() retransmission = %d, want %d", got.Retransmission, tt.want.Retransmission)
+			}
+
+			if !reflect.DeepEqual(got.Scope, tt.want.Scope) {
+				t.Errorf("ParseMessage() scope = %v, want %v", got.Scope, tt.want.Scope)
+			}
+
+			if !reflect.DeepEqual(got.Bytes(), tt.want.Bytes()) {
 				t.Errorf("ParseMessage() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestParseMessage_versions(t *testing.T) {
+	header := func(version uint16, flags uint8, ext ...byte) []byte {
+		buf := []byte{byte(version), byte(version >> 8), 0x01, 0, 0, 0, 0, 0, 0, 0, 0x01, flags}
+		buf = append(buf, ext...)
+		return append(buf, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	}
+
+	tests := []struct {
+		name string
+		buf  []byte
+		want bool
+	}{
+		{"version 1", header(1, FlagACK), true},
+		{"current version", header(Version, FlagRetransmission, 0x01), true},
+		{"unknown flag", header(Version, 1<<7), false},
+		{"retransmission in version 1", header(1, FlagRetransmission, 0x01), false},
+		{"scope in version 1", header(1, FlagScope, 0x00, 0x04, 'J', 'N', '8', '8'), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := ParseMessage(tt.buf); (got != nil) != tt.want {
+				t.Errorf("ParseMessage() = %v, want parsed %v", got, tt.want)
+			}
+		})
+	}
+
+	// messages with header extensions are sent with their version
+	msg := Message{Version: 1, Flags: FlagRetransmission, Retransmission: 1}
+	if got, _ := ParseMessage(msg.Bytes()); got == nil || got.Version != versionExtensions {
+		t.Errorf("ParseMessage(Bytes()) = %v, want version %d", got, versionExtensions)
+	}
+}
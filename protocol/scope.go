@@ -0,0 +1,124 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+)
+
+// Kinds of scopes in the message header.
+const (
+	scopeLocator = 0
+	scopeCircle  = 1
+)
+
+// Scope limits the spread of a message to a geographic area. Either the
+// locator prefix or the center and radius are set.
+type Scope struct {
+	// Locator prefix of the area, e.g. JN88
+	Locator string `json:"locator,omitempty"`
+	// Center of the area
+	Center *Position `json:"center,omitempty"`
+	// Radius around the center in km
+	Radius float64 `json:"radius,omitempty"`
+}
+
+var errScopeInvalid = errors.New("scope invalid")
+
+// Validate checks if the scope can be encoded.
+func (s *Scope) Validate() error {
+	if (s.Locator == "") == (s.Center == nil) {
+		return errors.New("scope requires either a locator or a center")
+	}
+
+	if s.Locator != "" {
+		if !ValidLocator(s.Locator) {
+			return errors.New("invalid scope locator")
+		}
+
+		return nil
+	}
+
+	if err := s.Center.Validate(); err != nil {
+		return err
+	}
+
+	if len(s.Center.Locator) > LocatorExtendedSquare {
+		return errors.New("locator too long")
+	}
+
+	if math.IsNaN(s.Radius) || s.Radius <= 0 || s.Radius*1000 > math.MaxUint32 {
+		return errors.New("invalid scope radius")
+	}
+
+	return nil
+}
+
+// Contains checks if a position is inside the area.
+func (s *Scope) Contains(p *Position) bool {
+	if s.Locator != "" {
+		loc, err := Locator(p.Lat, p.Lon, len(s.Locator))
+		return err == nil && strings.EqualFold(loc, s.Locator)
+	}
+
+	return s.Center != nil && s.Center.Distance(p) <= s.Radius
+}
+
+// Clone returns a deep copy of the scope.
+func (s *Scope) Clone() *Scope {
+	c := *s
+
+	if s.Center != nil {
+		p := *s.Center
+		c.Center = &p
+	}
+
+	return &c
+}
+
+// Bytes converts the scope to bytes, the scope must be valid.
+func (s *Scope) Bytes() []byte {
+	if s.Locator != "" {
+		return appendString([]byte{scopeLocator}, s.Locator)
+	}
+
+	buf := appendPosition([]byte{scopeCircle}, s.Center)
+
+	var r [4]byte
+	binary.LittleEndian.PutUint32(r[:], uint32(math.Round(s.Radius*1000)))
+
+	return append(buf, r[:]...)
+}
+
+// ParseScope parses a scope and returns the remainder.
+func ParseScope(buf []byte) (*Scope, []byte, error) {
+	if len(buf) < 1 {
+		return nil, nil, errScopeInvalid
+	}
+
+	switch buf[0] {
+	case scopeLocator:
+		loc, rbuf, err := parseString(buf[1:])
+		if err != nil || !ValidLocator(loc) {
+			return nil, nil, errScopeInvalid
+		}
+
+		return &Scope{Locator: loc}, rbuf, nil
+
+	case scopeCircle:
+		p, rbuf, err := parsePosition(buf[1:])
+		if err != nil || len(rbuf) < 4 {
+			return nil, nil, errScopeInvalid
+		}
+
+		s := &Scope{
+			Center: p,
+			Radius: float64(binary.LittleEndian.Uint32(rbuf[0:4])) / 1000,
+		}
+
+		return s, rbuf[4:], nil
+	}
+
+	return nil, nil, errScopeInvalid
+}
@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScope_Validate(t *testing.T) {
+	vienna := &Position{Locator: "JN88ee", Lat: 48.208, Lon: 16.373}
+
+	tests := []struct {
+		name    string
+		scope   Scope
+		wantErr bool
+	}{
+		{name: "Locator", scope: Scope{Locator: "JN88"}},
+		{name: "Circle", scope: Scope{Center: vienna, Radius: 50}},
+		{name: "Empty", scope: Scope{}, wantErr: true},
+		{name: "Locator and center", scope: Scope{Locator: "JN88", Center: vienna, Radius: 50}, wantErr: true},
+		{name: "Invalid locator", scope: Scope{Locator: "ZZ99"}, wantErr: true},
+		{name: "Without radius", scope: Scope{Center: vienna}, wantErr: true},
+		{name: "Negative radius", scope: Scope{Center: vienna, Radius: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.scope.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Scope.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScope_Contains(t *testing.T) {
+	vienna := &Position{Locator: "JN88ee", Lat: 48.208, Lon: 16.373}
+	graz := &Position{Locator: "JN77ta", Lat: 47.0707, Lon: 15.4395}
+
+	tests := []struct {
+		name  string
+		scope Scope
+		pos   *Position
+		want  bool
+	}{
+		{name: "Inside square", scope: Scope{Locator: "jn88"}, pos: vienna, want: true},
+		{name: "Outside square", scope: Scope{Locator: "JN88"}, pos: graz, want: false},
+		{name: "Inside field", scope: Scope{Locator: "JN"}, pos: graz, want: true},
+		{name: "Inside circle", scope: Scope{Center: vienna, Radius: 150}, pos: graz, want: true},
+		{name: "Outside circle", scope: Scope{Center: vienna, Radius: 100}, pos: graz, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.Contains(tt.pos); got != tt.want {
+				t.Errorf("Scope.Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   *Scope
+		buf     []byte
+		wantErr bool
+	}{
+		{name: "Locator", scope: &Scope{Locator: "JN88"}},
+		{name: "Circle", scope: &Scope{Center: &Position{Locator: "JN88ee", Lat: 48.208, Lon: 16.373}, Radius: 12.5}},
+		{name: "Empty", buf: []byte{}, wantErr: true},
+		{name: "Unknown kind", buf: []byte{0x07, 0x00}, wantErr: true},
+		{name: "Invalid locator", buf: []byte{0x00, 0x02, 'Z', 'Z'}, wantErr: true},
+		{name: "Short circle", buf: []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := tt.buf
+			if tt.scope != nil {
+				buf = append(tt.scope.Bytes(), 0xaa)
+			}
+
+			got, rest, err := ParseScope(buf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.scope) {
+				t.Errorf("ParseScope() = %v, want %v", got, tt.scope)
+			}
+
+			if !reflect.DeepEqual(rest, []byte{0xaa}) {
+				t.Errorf("ParseScope() remainder = %v", rest)
+			}
+		})
+	}
+}
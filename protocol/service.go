@@ -0,0 +1,157 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ServiceAttribute is a TXT-style key/value attribute of a service.
+type ServiceAttribute struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// ServicePayload announces a service offered by the source of the message.
+type ServicePayload struct {
+	// Name of the service, e.g. "Webcam Kahlenberg"
+	Name string `json:"name"`
+	// Type is the protocol of the service, e.g. http, ssh, sip or echolink
+	Type string `json:"type"`
+	// IPIndex references the address in the IP list of the source contact
+	IPIndex uint8  `json:"ipIndex"`
+	Port    uint16 `json:"port"`
+	// Lifetime of the announcement in seconds, 0 withdraws the service
+	Lifetime   uint32             `json:"lifetime"`
+	Attributes []ServiceAttribute `json:"attributes"`
+	// Position of the service, appended after the attributes and ignored by
+	// older nodes
+	Position *Position `json:"-"`
+}
+
+var errServiceInvalid = errors.New("service payload invalid")
+
+// ServiceStringLength is the maximum length of the strings of a service.
+const ServiceStringLength = 255
+
+// appendString appends a string with a length prefix.
+func appendString(buf []byte, s string) []byte {
+	buf = append(buf, uint8(len(s)))
+	return append(buf, s...)
+}
+
+// parseString parses a string with a length prefix and returns the remainder.
+func parseString(buf []byte) (string, []byte, error) {
+	if len(buf) < 1 || len(buf) < 1+int(buf[0]) {
+		return "", nil, errServiceInvalid
+	}
+
+	l := int(buf[0])
+	return string(buf[1 : 1+l]), buf[1+l:], nil
+}
+
+// Validate checks if the service can be encoded.
+func (s *ServicePayload) Validate() error {
+	if s.Name == "" || s.Type == "" {
+		return errors.New("service name and type required")
+	}
+
+	if len(s.Name) > ServiceStringLength || len(s.Type) > ServiceStringLength {
+		return errors.New("service name or type too long")
+	}
+
+	if len(s.Attributes) > 255 {
+		return errors.New("too many service attributes")
+	}
+
+	for _, a := range s.Attributes {
+		if len(a.Key) > ServiceStringLength || len(a.Value) > ServiceStringLength {
+			return errors.New("service attribute too long")
+		}
+	}
+
+	if s.Position != nil {
+		if err := s.Position.Validate(); err != nil {
+			return err
+		}
+
+		if len(s.Position.Locator) > LocatorExtendedSquare {
+			return errors.New("locator too long")
+		}
+	}
+
+	return nil
+}
+
+// Bytes converts the payload to bytes, the payload must be valid.
+func (s *ServicePayload) Bytes() []byte {
+	buf := make([]byte, 0, 16+len(s.Name)+len(s.Type))
+
+	buf = appendString(buf, s.Name)
+	buf = appendString(buf, s.Type)
+	buf = append(buf, s.IPIndex)
+
+	var num [6]byte
+	binary.LittleEndian.PutUint16(num[0:2], s.Port)
+	binary.LittleEndian.PutUint32(num[2:6], s.Lifetime)
+	buf = append(buf, num[:]...)
+
+	buf = append(buf, uint8(len(s.Attributes)))
+	for _, a := range s.Attributes {
+		buf = appendString(buf, a.Key)
+		buf = appendString(buf, a.Value)
+	}
+
+	if s.Position != nil {
+		buf = appendPosition(buf, s.Position)
+	}
+
+	return buf
+}
+
+// ParseServicePayload parses a service announcement.
+func ParseServicePayload(buf []byte) (*ServicePayload, error) {
+	s := &ServicePayload{}
+	var err error
+
+	if s.Name, buf, err = parseString(buf); err != nil {
+		return nil, err
+	}
+
+	if s.Type, buf, err = parseString(buf); err != nil {
+		return nil, err
+	}
+
+	if len(buf) < 8 {
+		return nil, errServiceInvalid
+	}
+
+	s.IPIndex = buf[0]
+	s.Port = binary.LittleEndian.Uint16(buf[1:3])
+	s.Lifetime = binary.LittleEndian.Uint32(buf[3:7])
+
+	n := int(buf[7])
+	buf = buf[8:]
+
+	s.Attributes = []ServiceAttribute{}
+	for i := 0; i < n; i++ {
+		a := ServiceAttribute{}
+
+		if a.Key, buf, err = parseString(buf); err != nil {
+			return nil, err
+		}
+
+		if a.Value, buf, err = parseString(buf); err != nil {
+			return nil, err
+		}
+
+		s.Attributes = append(s.Attributes, a)
+	}
+
+	if len(buf) > 0 {
+		if s.Position, _, err = parsePosition(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServicePayload_Bytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload ServicePayload
+		want    []byte
+	}{
+		{
+			name: "Without attributes",
+			payload: ServicePayload{
+				Name:       "w",
+				Type:       "ssh",
+				IPIndex:    1,
+				Port:       22,
+				Lifetime:   0x0102,
+				Attributes: []ServiceAttribute{},
+			},
+			want: []byte{0x01, 'w', 0x03, 's', 's', 'h', 0x01, 0x16, 0x00, 0x02, 0x01, 0x00, 0x00, 0x00},
+		},
+		{
+			name: "With attribute",
+			payload: ServicePayload{
+				Name:       "w",
+				Type:       "http",
+				Port:       80,
+				Lifetime:   60,
+				Attributes: []ServiceAttribute{{Key: "p", Value: "/"}},
+			},
+			want: []byte{0x01, 'w', 0x04, 'h', 't', 't', 'p', 0x00, 0x50, 0x00, 0x3c, 0x00, 0x00, 0x00, 0x01, 0x01, 'p', 0x01, '/'},
+		},
+		{
+			name: "With position",
+			payload: ServicePayload{
+				Name:       "w",
+				Type:       "ssh",
+				Port:       22,
+				Attributes: []ServiceAttribute{},
+				Position:   &Position{Locator: "JN88", Lat: 48.5, Lon: 17},
+			},
+			want: []byte{0x01, 'w', 0x03, 's', 's', 'h', 0x00, 0x16, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x04, 'J', 'N', '8', '8', 32, 13, 228, 2, 64, 102, 3, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.payload.Bytes(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ServicePayload.Bytes() = %v, want %v", got, tt.want)
+			}
+
+			got, err := ParseServicePayload(tt.want)
+			if err != nil {
+				t.Fatalf("ParseServicePayload() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(*got, tt.payload) {
+				t.Errorf("ParseServicePayload() = %+v, want %+v", *got, tt.payload)
+			}
+		})
+	}
+}
+
+func TestParseServicePayload(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{name: "Empty", buf: []byte{}},
+		{name: "Short name", buf: []byte{0x05, 'w'}},
+		{name: "Missing port", buf: []byte{0x01, 'w', 0x01, 'x', 0x00}},
+		{name: "Missing attribute", buf: []byte{0x01, 'w', 0x01, 'x', 0x00, 0x50, 0x00, 0x3c, 0x00, 0x00, 0x00, 0x01}},
+		{name: "Short position", buf: []byte{0x01, 'w', 0x01, 'x', 0x00, 0x50, 0x00, 0x3c, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseServicePayload(tt.buf); err == nil {
+				t.Error("ParseServicePayload() accepted an invalid payload")
+			}
+		})
+	}
+}
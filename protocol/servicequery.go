@@ -0,0 +1,156 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ServiceReplyMaxRecords is the maximum number of services in a reply.
+const ServiceReplyMaxRecords = 255
+
+var errServiceQueryInvalid = errors.New("service query payload invalid")
+
+// ServiceQueryPayload asks for the services of a type and a name pattern.
+// The query is identified by the source and sequence number of the message.
+type ServiceQueryPayload struct {
+	// Type of the services, empty for all types
+	Type string `json:"type"`
+	// Name pattern of the services, * and ? are supported, empty for all names
+	Name string `json:"name"`
+}
+
+// Bytes converts the payload to bytes.
+func (q *ServiceQueryPayload) Bytes() []byte {
+	buf := make([]byte, 0, 2+len(q.Type)+len(q.Name))
+
+	buf = appendString(buf, q.Type)
+	buf = appendString(buf, q.Name)
+
+	return buf
+}
+
+// ParseServiceQueryPayload parses a service query.
+func ParseServiceQueryPayload(buf []byte) (*ServiceQueryPayload, error) {
+	q := &ServiceQueryPayload{}
+	var err error
+
+	if q.Type, buf, err = parseString(buf); err != nil {
+		return nil, errServiceQueryInvalid
+	}
+
+	if q.Name, _, err = parseString(buf); err != nil {
+		return nil, errServiceQueryInvalid
+	}
+
+	return q, nil
+}
+
+// ServiceRecord is a service in a reply, the lifetime is the remaining lifetime.
+type ServiceRecord struct {
+	Source  string         `json:"source"`
+	Address []byte         `json:"address"`
+	Service ServicePayload `json:"service"`
+}
+
+// ServiceReplyPayload answers a service query. The reply is directed back to
+// the querying node along the reverse path of the query.
+type ServiceReplyPayload struct {
+	// QuerySeq is the sequence number of the query message
+	QuerySeq uint64 `json:"querySeq"`
+	// Route lists the stations the reply still has to pass, the last one is
+	// the querying node
+	Route   []string        `json:"route"`
+	Records []ServiceRecord `json:"records"`
+}
+
+// Bytes converts the payload to bytes, the records must be valid.
+func (r *ServiceReplyPayload) Bytes() []byte {
+	buf := make([]byte, 8, 64)
+	binary.LittleEndian.PutUint64(buf[0:8], r.QuerySeq)
+
+	buf = append(buf, uint8(len(r.Route)))
+	for _, s := range r.Route {
+		buf = appendString(buf, s)
+	}
+
+	buf = append(buf, uint8(len(r.Records)))
+	for _, rec := range r.Records {
+		buf = appendString(buf, rec.Source)
+		buf = appendString(buf, string(rec.Address))
+
+		sbuf := rec.Service.Bytes()
+		var l [2]byte
+		binary.LittleEndian.PutUint16(l[:], uint16(len(sbuf)))
+
+		buf = append(buf, l[:]...)
+		buf = append(buf, sbuf...)
+	}
+
+	return buf
+}
+
+// ParseServiceReplyPayload parses a service reply.
+func ParseServiceReplyPayload(buf []byte) (*ServiceReplyPayload, error) {
+	if len(buf) < 9 {
+		return nil, errServiceQueryInvalid
+	}
+
+	r := &ServiceReplyPayload{
+		QuerySeq: binary.LittleEndian.Uint64(buf[0:8]),
+		Route:    []string{},
+		Records:  []ServiceRecord{},
+	}
+
+	n := int(buf[8])
+	buf = buf[9:]
+
+	for i := 0; i < n; i++ {
+		s, rbuf, err := parseString(buf)
+		if err != nil {
+			return nil, errServiceQueryInvalid
+		}
+
+		r.Route = append(r.Route, s)
+		buf = rbuf
+	}
+
+	if len(buf) < 1 {
+		return nil, errServiceQueryInvalid
+	}
+
+	n = int(buf[0])
+	buf = buf[1:]
+
+	for i := 0; i < n; i++ {
+		rec := ServiceRecord{}
+
+		src, rbuf, err := parseString(buf)
+		if err != nil {
+			return nil, errServiceQueryInvalid
+		}
+
+		addr, rbuf, err := parseString(rbuf)
+		if err != nil || len(rbuf) < 2 {
+			return nil, errServiceQueryInvalid
+		}
+
+		l := int(binary.LittleEndian.Uint16(rbuf[0:2]))
+		if len(rbuf) < 2+l {
+			return nil, errServiceQueryInvalid
+		}
+
+		svc, err := ParseServicePayload(rbuf[2 : 2+l])
+		if err != nil {
+			return nil, err
+		}
+
+		rec.Source = src
+		rec.Address = []byte(addr)
+		rec.Service = *svc
+
+		r.Records = append(r.Records, rec)
+		buf = rbuf[2+l:]
+	}
+
+	return r, nil
+}
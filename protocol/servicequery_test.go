@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServiceQueryPayload(t *testing.T) {
+	q := ServiceQueryPayload{Type: "http", Name: "cam*"}
+
+	want := []byte{0x04, 'h', 't', 't', 'p', 0x04, 'c', 'a', 'm', '*'}
+	if got := q.Bytes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ServiceQueryPayload.Bytes() = %v, want %v", got, want)
+	}
+
+	got, err := ParseServiceQueryPayload(want)
+	if err != nil || !reflect.DeepEqual(*got, q) {
+		t.Errorf("ParseServiceQueryPayload() = %+v, %v", got, err)
+	}
+
+	if _, err := ParseServiceQueryPayload(want[:6]); err == nil {
+		t.Error("ParseServiceQueryPayload() accepted a truncated payload")
+	}
+}
+
+func TestServiceReplyPayload(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply ServiceReplyPayload
+	}{
+		{
+			name: "Empty",
+			reply: ServiceReplyPayload{
+				QuerySeq: 42,
+				Route:    []string{},
+				Records:  []ServiceRecord{},
+			},
+		},
+		{
+			name: "Records",
+			reply: ServiceReplyPayload{
+				QuerySeq: 1 << 40,
+				Route:    []string{"OE1BBB", "OE1AAA"},
+				Records: []ServiceRecord{
+					{
+						Source:  "OE1XYZ",
+						Address: []byte{44, 143, 0, 1},
+						Service: ServicePayload{
+							Name:       "Webcam",
+							Type:       "http",
+							Port:       80,
+							Lifetime:   60,
+							Attributes: []ServiceAttribute{{Key: "path", Value: "/cam"}},
+						},
+					},
+					{
+						Source:  "OE3DEF",
+						Address: []byte{},
+						Service: ServicePayload{Name: "BBS", Type: "telnet", Attributes: []ServiceAttribute{}},
+					},
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := tt.reply.Bytes()
+
+			got, err := ParseServiceReplyPayload(buf)
+			if err != nil {
+				t.Fatalf("ParseServiceReplyPayload() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(*got, tt.reply) {
+				t.Errorf("ParseServiceReplyPayload() = %+v, want %+v", *got, tt.reply)
+			}
+
+			if _, err := ParseServiceReplyPayload(buf[:len(buf)-1]); err == nil && len(tt.reply.Records) != 0 {
+				t.Error("ParseServiceReplyPayload() accepted a truncated payload")
+			}
+		})
+	}
+}
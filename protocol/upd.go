@@ -97,7 +97,7 @@ func ParsePayloadEntry(buf []byte) (*UpdPayloadEntry, []byte) {
 // Bytes converts a cache entry to bytes.
 func (e *UpdRequestCacheEntry) Bytes() []byte {
 	ct := e.Source.Bytes()
-	buf := make([]byte, len(ct)+4)
+	buf := make([]byte, len(ct)+8)
 	idx := 0
 
 	binary.LittleEndian.PutUint64(buf[idx:idx+8], e.SeqCounter)
@@ -113,7 +113,7 @@ func ParseCacheEntry(buf []byte) (*UpdRequestCacheEntry, []byte) {
 	idx := 0
 
 	if len(buf) < 9 {
-		logrus.Warn("Upd: Failed to parse cache entry, %d < %d", len(buf), 9)
+		logrus.Warnf("Upd: Failed to parse cache entry, %d < %d", len(buf), 9)
 		return nil, nil
 	}
 
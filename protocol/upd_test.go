@@ -109,7 +109,7 @@ func TestUpdPayloadCacheRequest_Bytes(t *testing.T) {
 					},
 				},
 			},
-			want: []byte{1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0},
+			want: []byte{1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0},
 		},
 	}
 	for _, tt := range tests {
@@ -132,15 +132,15 @@ func TestParseCacheEntry(t *testing.T) {
 	tests := []struct {
 		name  string
 		args  args
-		want  UpdRequestCacheEntry
+		want  *UpdRequestCacheEntry
 		want1 []byte
 	}{
 		{
 			name: "Basic cache entry parse",
 			args: args{
-				buf: []byte{1, 0, 0, 0, 1, 0, 0, 1, 2, 3, 4, 5},
+				buf: []byte{1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 2, 3, 4, 5},
 			},
-			want: UpdRequestCacheEntry{
+			want: &UpdRequestCacheEntry{
 				SeqCounter: 1,
 				Source: Contact{
 					Type:           1,
@@ -171,14 +171,14 @@ func TestParsePayloadCacheRequest(t *testing.T) {
 	tests := []struct {
 		name string
 		args args
-		want UpdPayloadCacheRequest
+		want *UpdPayloadCacheRequest
 	}{
 		{
 			name: "Basic payload cache request",
 			args: args{
-				buf: []byte{1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0},
+				buf: []byte{1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0},
 			},
-			want: UpdPayloadCacheRequest{
+			want: &UpdPayloadCacheRequest{
 				NumEntries: 1,
 				Entries: []UpdRequestCacheEntry{
 					{
@@ -250,11 +250,12 @@ func TestUpdPayloadCacheResponse_Bytes(t *testing.T) {
 		Version: 12,
 	}
 
-	mbuf = append(mbuf, msg.Bytes()...)
+	entry := UpdPayloadEntry{Message: msg}
+	mbuf = append(mbuf, entry.Bytes()...)
 
 	type fields struct {
 		NumEntries uint32
-		Entries    []Message
+		Entries    []UpdPayloadEntry
 	}
 	tests := []struct {
 		name   string
@@ -265,24 +266,26 @@ func TestUpdPayloadCacheResponse_Bytes(t *testing.T) {
 			name: "Basic cache response",
 			fields: fields{
 				NumEntries: 1,
-				Entries: []Message{
+				Entries: []UpdPayloadEntry{
 					{
-						Flags:         0,
-						Path:          "",
-						PathLength:    0,
-						PayloadLenght: 0,
-						PayloadType:   2,
-						Payload:       []byte{},
-						SeqCounter:    23,
-						Source: Contact{
-							CallsignLength: 0,
-							Callsign:       []byte{},
-							IPs:            []ContactIP{},
-							Type:           12,
-							NumberIPs:      0,
+						Message: Message{
+							Flags:         0,
+							Path:          "",
+							PathLength:    0,
+							PayloadLenght: 0,
+							PayloadType:   2,
+							Payload:       []byte{},
+							SeqCounter:    23,
+							Source: Contact{
+								CallsignLength: 0,
+								Callsign:       []byte{},
+								IPs:            []ContactIP{},
+								Type:           12,
+								NumberIPs:      0,
+							},
+							TTL:     23,
+							Version: 12,
 						},
-						TTL:     23,
-						Version: 12,
 					},
 				},
 			},
@@ -324,7 +327,8 @@ func TestParsePayloadCacheResponse(t *testing.T) {
 		Version: 12,
 	}
 
-	mbuf = append(mbuf, msg.Bytes()...)
+	entry := UpdPayloadEntry{Message: msg}
+	mbuf = append(mbuf, entry.Bytes()...)
 
 	type args struct {
 		buf []byte
@@ -341,24 +345,26 @@ func TestParsePayloadCacheResponse(t *testing.T) {
 			},
 			want: UpdPayloadCacheResponse{
 				NumEntries: 1,
-				Entries: []Message{
+				Entries: []UpdPayloadEntry{
 					{
-						Flags:         0,
-						Path:          "",
-						PathLength:    0,
-						PayloadLenght: 0,
-						PayloadType:   2,
-						Payload:       []byte{},
-						SeqCounter:    23,
-						Source: Contact{
-							CallsignLength: 0,
-							Callsign:       []byte{},
-							IPs:            []ContactIP{},
-							Type:           12,
-							NumberIPs:      0,
+						Message: Message{
+							Flags:         0,
+							Path:          "",
+							PathLength:    0,
+							PayloadLenght: 0,
+							PayloadType:   2,
+							Payload:       []byte{},
+							SeqCounter:    23,
+							Source: Contact{
+								CallsignLength: 0,
+								Callsign:       []byte{},
+								IPs:            []ContactIP{},
+								Type:           12,
+								NumberIPs:      0,
+							},
+							TTL:     23,
+							Version: 12,
 						},
-						TTL:     23,
-						Version: 12,
 					},
 				},
 			},
@@ -1,12 +1,17 @@
 package rest
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
 	"strconv"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/donothingloop/hamgo/node"
+	"github.com/donothingloop/hamgo/parameters"
 
 	"github.com/donothingloop/hamgo/protocol"
 	"github.com/gorilla/websocket"
@@ -15,7 +20,10 @@ import (
 	"github.com/labstack/echo"
 )
 
-const protocolVersion = 1
+const protocolVersion = protocol.Version
+
+// wsBuffer is the number of messages buffered for a websocket client.
+const wsBuffer = 64
 
 var (
 	upgrader = websocket.Upgrader{
@@ -25,18 +33,22 @@ var (
 	}
 )
 
-// spread a cqmessage
-func (h *Handler) cqmessage(c echo.Context) error {
-	msg := CQMessage{}
+// networkContact builds the network contact of a rest contact, the callsign
+// is normalized. An empty callsign is set by the local identity.
+func networkContact(ct *Contact) (protocol.Contact, error) {
+	call := ""
 
-	if err := c.Bind(&msg); err != nil {
-		return err
+	if ct.Callsign != "" {
+		var err error
+		if call, err = protocol.NormalizeCallsign(ct.Callsign); err != nil {
+			return protocol.Contact{}, err
+		}
 	}
 
 	ips := []protocol.ContactIP{}
 
 	// build ip addresses
-	for _, v := range msg.Contact.IPs {
+	for _, v := range ct.IPs {
 		ip := net.ParseIP(v)
 
 		// TODO: ipv6
@@ -50,20 +62,81 @@ func (h *Handler) cqmessage(c echo.Context) error {
 	}
 
 	// build the network contact
-	ctg := protocol.Contact{
-		Type:           msg.Contact.Type,
-		CallsignLength: uint8(len(msg.Contact.Callsign)),
-		Callsign:       []byte(msg.Contact.Callsign),
-		NumberIPs:      uint8(len(msg.Contact.IPs)),
+	return protocol.Contact{
+		Type:           ct.Type,
+		CallsignLength: uint8(len(call)),
+		Callsign:       []byte(call),
+		NumberIPs:      uint8(len(ct.IPs)),
 		IPs:            ips,
+	}, nil
+}
+
+// assignIdentity sends the message as the selected local identity, the
+// station is used if neither an identity nor a callsign is given.
+func (h *Handler) assignIdentity(identity string, msg *protocol.Message) error {
+	if identity == "" && msg.Source.CallsignLength != 0 {
+		return nil
+	}
+
+	if err := h.node.AssignIdentity(identity, msg); err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	return nil
+}
+
+// spreadResult returns the source and sequence of a spread message.
+func spreadResult(c echo.Context, msg *protocol.Message) error {
+	return c.JSON(200, Spread{
+		Source:   string(msg.Source.Callsign),
+		Sequence: msg.SeqCounter,
+	})
+}
+
+// spread a cqmessage
+func (h *Handler) cqmessage(c echo.Context) error {
+	msg := CQMessage{}
+
+	if err := c.Bind(&msg); err != nil {
+		return err
+	}
+
+	pos, err := msg.Position.resolve()
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	cq := protocol.CQPayload{
+		Message:  msg.Message,
+		Position: pos,
+	}
+
+	if err := cq.Validate(); err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	scope, err := msg.Scope.scope()
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
 	}
 
+	ctg, err := networkContact(&msg.Contact)
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	pbuf := cq.Bytes()
+
 	flags := uint8(0)
 
 	if msg.ACK {
 		flags |= protocol.FlagACK
 	}
 
+	if scope != nil {
+		flags |= protocol.FlagScope
+	}
+
 	// build the network message
 	nmsg := protocol.Message{
 		Version:    protocolVersion,
@@ -71,18 +144,150 @@ func (h *Handler) cqmessage(c echo.Context) error {
 		Source:     ctg,
 		TTL:        255,
 		Flags:      flags,
+		Scope:      scope,
 
 		PayloadType:   protocol.PayloadCQ,
-		PayloadLenght: uint32(len(msg.Message)),
-		Payload:       []byte(msg.Message),
+		PayloadLenght: uint32(len(pbuf)),
+		Payload:       pbuf,
+	}
+
+	if err := h.assignIdentity(msg.Identity, &nmsg); err != nil {
+		return err
 	}
 
 	logrus.WithField("msg", nmsg).Debug("spreading CQ message")
 
+	if r := msg.Reliable; r != nil {
+		err := h.node.SpreadReliable(&nmsg, node.ReliableOptions{
+			Expected: r.Expected,
+			Quorum:   r.Quorum,
+			Deadline: time.Duration(r.Deadline * float64(time.Second)),
+		})
+		if err != nil {
+			return echo.NewHTTPError(400, err.Error())
+		}
+
+		return spreadResult(c, &nmsg)
+	}
+
 	// spread the message
-	h.node.SpreadMessage(&nmsg)
+	if err := h.node.SpreadMessage(&nmsg); err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	return spreadResult(c, &nmsg)
+}
+
+// spread a service announcement
+func (h *Handler) servicemessage(c echo.Context) error {
+	msg := ServiceMessage{}
+
+	if err := c.Bind(&msg); err != nil {
+		return err
+	}
+
+	pos, err := msg.Position.resolve()
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	msg.Service.Position = pos
+
+	if err := msg.Service.Validate(); err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	scope, err := msg.Scope.scope()
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	if int(msg.Service.IPIndex) >= len(msg.Contact.IPs) {
+		return echo.NewHTTPError(400, "ip index out of range")
+	}
 
-	return c.NoContent(200)
+	ctg, err := networkContact(&msg.Contact)
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	pbuf := msg.Service.Bytes()
+
+	nmsg := protocol.Message{
+		Version:    protocolVersion,
+		SeqCounter: msg.Sequence,
+		Source:     ctg,
+		TTL:        255,
+		Scope:      scope,
+
+		PayloadType:   protocol.PayloadService,
+		PayloadLenght: uint32(len(pbuf)),
+		Payload:       pbuf,
+	}
+
+	if scope != nil {
+		nmsg.Flags |= protocol.FlagScope
+	}
+
+	if err := h.assignIdentity(msg.Identity, &nmsg); err != nil {
+		return err
+	}
+
+	logrus.WithField("msg", nmsg).Debug("spreading service announcement")
+
+	if err := h.node.SpreadMessage(&nmsg); err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	return spreadResult(c, &nmsg)
+}
+
+// identities returns the local identities of the node
+func (h *Handler) identities(c echo.Context) error {
+	return c.JSON(200, h.node.Identities())
+}
+
+// services returns the announced services, filtered by type
+func (h *Handler) services(c echo.Context) error {
+	return c.JSON(200, h.node.Services(c.QueryParam("type")))
+}
+
+// discover queries the network for services and returns the replies
+// collected within the timeout
+func (h *Handler) discover(c echo.Context) error {
+	q := node.ServiceQuery{
+		Type: c.QueryParam("type"),
+		Name: c.QueryParam("name"),
+	}
+
+	if v := c.QueryParam("ttl"); v != "" {
+		ttl, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return echo.NewHTTPError(400, "invalid ttl")
+		}
+
+		q.TTL = uint8(ttl)
+	}
+
+	if v := c.QueryParam("timeout"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 {
+			return echo.NewHTTPError(400, "invalid timeout")
+		}
+
+		q.Timeout = time.Duration(t * float64(time.Second))
+	}
+
+	svcs, err := h.node.DiscoverServices(c.Request().Context(), q)
+	if err == context.Canceled {
+		return nil
+	}
+
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	return c.JSON(200, svcs)
 }
 
 // cache returns the current cache
@@ -103,7 +308,7 @@ func (h *Handler) cache(c echo.Context) error {
 	first := true
 	cnt := 0
 
-	for _, m := range h.node.Cache {
+	for _, m := range h.node.CacheSnapshot() {
 		str := messageToJSON(m)
 		if str == "" {
 			continue
@@ -130,46 +335,251 @@ func (h *Handler) cache(c echo.Context) error {
 	return c.String(200, response)
 }
 
-func (h *Handler) ws(c echo.Context) error {
+// peers returns the state of the peers
+func (h *Handler) peers(c echo.Context) error {
+	return c.JSON(200, h.node.PeerStatus())
+}
+
+// events returns the recent node events
+func (h *Handler) events(c echo.Context) error {
+	types := eventTypes(c)
+	if len(types) == 0 {
+		return c.JSON(200, h.node.Events())
+	}
+
+	filter := make(map[node.EventType]bool)
+	for _, t := range types {
+		filter[t] = true
+	}
+
+	events := []node.Event{}
+	for _, e := range h.node.Events() {
+		if filter[e.Type] {
+			events = append(events, e)
+		}
+	}
+
+	return c.JSON(200, events)
+}
+
+// eventTypes returns the event types of the comma separated type parameter.
+func eventTypes(c echo.Context) []node.EventType {
+	var types []node.EventType
+
+	for _, t := range strings.Split(c.QueryParam("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, node.EventType(t))
+		}
+	}
+
+	return types
+}
+
+// acks returns the receipts of a message originated by this node
+func (h *Handler) acks(c echo.Context) error {
+	seq, err := strconv.ParseUint(c.Param("seq"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(400, "invalid sequence")
+	}
+
+	r, ok := h.node.Receipts(c.Param("source"), seq)
+	if !ok {
+		return echo.NewHTTPError(404, "message not tracked")
+	}
+
+	return c.JSON(200, r)
+}
+
+// delivery returns the state of a reliable message, with wait=true it blocks
+// until the delivery finished
+func (h *Handler) delivery(c echo.Context) error {
+	seq, err := strconv.ParseUint(c.Param("seq"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(400, "invalid sequence")
+	}
+
+	source := c.Param("source")
+
+	if c.QueryParam("wait") == "true" {
+		s, err := h.node.WaitDelivery(c.Request().Context(), source, seq)
+		if err == context.Canceled {
+			return nil
+		}
+
+		if err != nil && err != context.DeadlineExceeded {
+			return echo.NewHTTPError(404, "message not tracked")
+		}
+
+		return c.JSON(200, s)
+	}
+
+	s, ok := h.node.DeliveryStatus(source, seq)
+	if !ok {
+		return echo.NewHTTPError(404, "message not tracked")
+	}
+
+	return c.JSON(200, s)
+}
+
+// acksWs streams the receipts of the messages originated by this node to a websocket
+func (h *Handler) acksWs(c echo.Context) error {
 	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		return err
 	}
 
 	defer ws.Close()
-	closech := make(chan interface{})
-	closed := false
-	lck := sync.Mutex{}
 
-	cb := func(msg *protocol.Message, src *node.Peer) {
-		if closed {
-			return
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	updates := h.node.SubscribeReceipts(ctx)
+
+	// the client does not send anything, reading detects the close
+	go func() {
+		defer cancel()
+
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
+			}
 		}
+	}()
 
-		logrus.Info("REST: sending message to websocket")
+	for u := range updates {
+		if err := ws.WriteJSON(u); err != nil {
+			return nil
+		}
+	}
 
-		str := messageToJSON(msg)
-		err := ws.WriteMessage(websocket.TextMessage, []byte(str))
+	return nil
+}
 
-		if err != nil {
-			lck.Lock()
-			if !closed {
-				closed = true
-				close(closech)
+// eventsWs streams the node events to a websocket
+func (h *Handler) eventsWs(c echo.Context) error {
+	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return err
+	}
+
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	events := h.node.SubscribeEvents(ctx, eventTypes(c)...)
+
+	// the client does not send anything, reading detects the close
+	go func() {
+		defer cancel()
+
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
 			}
-			lck.Unlock()
 		}
+	}()
+
+	for e := range events {
+		if err := ws.WriteJSON(e); err != nil {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// flood returns the state of the flood protection
+func (h *Handler) flood(c echo.Context) error {
+	return c.JSON(200, h.node.FloodStatus())
+}
+
+// acl returns the access control lists
+func (h *Handler) acl(c echo.Context) error {
+	acl := h.node.ACL()
+
+	return c.JSON(200, ACL{
+		Rules:  acl.Rules(),
+		Status: acl.Status(),
+	})
+}
+
+// setACL replaces all access control lists
+func (h *Handler) setACL(c echo.Context) error {
+	rules := parameters.ACLSettings{}
+
+	if err := c.Bind(&rules); err != nil {
+		return err
+	}
+
+	if err := h.node.ACL().SetRules(rules); err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	return c.JSON(200, h.node.ACL().Rules())
+}
+
+// addACLEntry adds an entry to an access control list
+func (h *Handler) addACLEntry(c echo.Context) error {
+	entry := ACLEntry{}
+
+	if err := c.Bind(&entry); err != nil {
+		return err
+	}
+
+	if err := h.node.ACL().Add(c.Param("list"), entry.Entry); err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	return c.JSON(200, h.node.ACL().Rules())
+}
+
+// removeACLEntry removes an entry from an access control list, the entry
+// is passed as query parameter as it may contain slashes
+func (h *Handler) removeACLEntry(c echo.Context) error {
+	if err := h.node.ACL().Remove(c.Param("list"), c.QueryParam("entry")); err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	return c.JSON(200, h.node.ACL().Rules())
+}
+
+func (h *Handler) ws(c echo.Context) error {
+	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		return err
 	}
 
+	defer ws.Close()
+
+	ctx, cancel := context.WithCancel(c.Request().Context())
+	defer cancel()
+
+	msgs := h.node.Subscribe(ctx, node.Filter{
+		Buffer:   wsBuffer,
+		Overflow: node.OverflowDropOldest,
+	})
+
 	go func() {
-		for !closed {
-			msg := &protocol.Message{}
-			err := ws.ReadJSON(msg)
+		// stop sending if the client is gone
+		defer cancel()
+
+		for {
+			wmsg := &WSMessage{}
+			err := ws.ReadJSON(wmsg)
 			if err != nil {
 				logrus.WithError(err).Warn("REST: failed to read incoming message")
 				return
 			}
 
+			msg := &wmsg.Message
+			if wmsg.Identity != "" {
+				if err := h.node.AssignIdentity(wmsg.Identity, msg); err != nil {
+					logrus.WithError(err).Warn("REST: failed to send msg from ws")
+					continue
+				}
+			}
+
 			logrus.Debugf("REST: spreading msg:\n %+v", msg)
 			err = h.node.SpreadMessage(msg)
 			if err != nil {
@@ -181,22 +591,145 @@ func (h *Handler) ws(c echo.Context) error {
 		}
 	}()
 
-	cd := &node.MessageCallback{
-		Cb: cb,
+	for d := range msgs {
+		logrus.Info("REST: sending message to websocket")
+
+		str := messageToJSON(d.Message)
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(str)); err != nil {
+			return nil
+		}
 	}
 
-	h.node.AddCallback(cd)
-	defer h.node.RemoveCallback(cd)
+	return nil
+}
 
-	<-closech
+// topology returns the network topology as json, dot or geojson
+func (h *Handler) topology(c echo.Context) error {
+	g := h.node.Topology()
 
-	return nil
+	switch c.QueryParam("format") {
+	case "", "json":
+		return c.JSON(200, g)
+
+	case "dot":
+		return c.Blob(200, "text/vnd.graphviz", []byte(g.DOT()))
+
+	case "geojson":
+		data, err := json.Marshal(g.GeoJSON())
+		if err != nil {
+			return err
+		}
+
+		return c.Blob(200, "application/geo+json", data)
+	}
+
+	return echo.NewHTTPError(400, "unknown format")
+}
+
+// stations returns the station directory, filtered by q and the distance
+// within km of near, ordered by sort
+func (h *Handler) stations(c echo.Context) error {
+	q := node.StationQuery{
+		Search: c.QueryParam("q"),
+		Sort:   c.QueryParam("sort"),
+		Desc:   c.QueryParam("order") == "desc",
+	}
+
+	if v := c.QueryParam("near"); v != "" {
+		p, err := parseReference(v)
+		if err != nil {
+			return echo.NewHTTPError(400, err.Error())
+		}
+
+		q.Near = p
+	}
+
+	if v := c.QueryParam("within"); v != "" {
+		km, err := strconv.ParseFloat(v, 64)
+		if err != nil || km < 0 {
+			return echo.NewHTTPError(400, "invalid distance")
+		}
+
+		q.Within = km
+	}
+
+	st, err := h.node.Stations(q)
+	if err != nil {
+		return echo.NewHTTPError(400, err.Error())
+	}
+
+	return c.JSON(200, st)
+}
+
+// parseReference parses a locator, e.g. JN88, or coordinates, e.g. 48.2,16.4
+func parseReference(v string) (*protocol.Position, error) {
+	parts := strings.Split(v, ",")
+	if len(parts) == 1 {
+		return protocol.ResolvePosition(v, nil, nil)
+	}
+
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid position %q", v)
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid latitude %q", parts[0])
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid longitude %q", parts[1])
+	}
+
+	return protocol.ResolvePosition("", &lat, &lon)
+}
+
+// station returns the directory entry of a callsign
+func (h *Handler) station(c echo.Context) error {
+	st, ok := h.node.Station(c.Param("call"))
+	if !ok {
+		return echo.NewHTTPError(404, "station not found")
+	}
+
+	return c.JSON(200, st)
+}
+
+// originating rejects write requests if the node role does not originate messages
+func (h *Handler) originating(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if role := h.node.Role(); !role.Originates() {
+			return echo.NewHTTPError(403, fmt.Sprintf("%s node does not originate messages", role))
+		}
+
+		return next(c)
+	}
 }
 
 func (h *Handler) registerAPI(e *echo.Group) {
-	spread := e.Group("/spread")
+	spread := e.Group("/spread", h.originating)
 	spread.POST("/cq", h.cqmessage)
+	spread.POST("/service", h.servicemessage)
 
 	e.GET("/cache", h.cache)
+	e.GET("/peers", h.peers)
+	e.GET("/events", h.events)
+	e.GET("/events/ws", h.eventsWs)
+	e.GET("/flood", h.flood)
+	e.GET("/topology", h.topology)
+	e.GET("/stations", h.stations)
+	e.GET("/stations/:call", h.station)
+	e.GET("/services", h.services)
+	e.GET("/identities", h.identities)
+	e.GET("/discover", h.discover, h.originating)
+	e.GET("/messages/:source/:seq/acks", h.acks)
+	e.GET("/messages/:source/:seq/delivery", h.delivery)
+	e.GET("/acks/ws", h.acksWs)
+
+	acl := e.Group("/acl")
+	acl.GET("", h.acl)
+	acl.PUT("", h.setACL)
+	acl.POST("/:list", h.addACLEntry)
+	acl.DELETE("/:list", h.removeACLEntry)
 	e.GET("/ws", h.ws)
 }
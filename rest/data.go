@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/donothingloop/hamgo/node"
+	"github.com/donothingloop/hamgo/parameters"
 	"github.com/donothingloop/hamgo/protocol"
 )
 
@@ -14,12 +16,111 @@ type Contact struct {
 	Callsign string               `json:"callsign"`
 }
 
+// Position for the rest api, either the locator or the coordinates can be set.
+type Position struct {
+	Locator string   `json:"locator"`
+	Lat     *float64 `json:"lat"`
+	Lon     *float64 `json:"lon"`
+}
+
+// resolve derives the missing locator or coordinates.
+func (p *Position) resolve() (*protocol.Position, error) {
+	if p == nil {
+		return nil, nil
+	}
+
+	return protocol.ResolvePosition(p.Locator, p.Lat, p.Lon)
+}
+
+// Scope limits the spread of a message to the area of a locator prefix or
+// to the radius in km around a center.
+type Scope struct {
+	Locator string    `json:"locator,omitempty"`
+	Center  *Position `json:"center,omitempty"`
+	Radius  float64   `json:"radius,omitempty"`
+}
+
+// scope converts the scope to the network scope.
+func (s *Scope) scope() (*protocol.Scope, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	center, err := s.Center.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &protocol.Scope{
+		Locator: s.Locator,
+		Center:  center,
+		Radius:  s.Radius,
+	}
+
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
 // CQMessage indicates the users location.
 type CQMessage struct {
 	Sequence uint64  `json:"sequence"`
 	Contact  Contact `json:"contact"`
-	Message  string  `json:"message"`
-	ACK      bool    `json:"ack,omitempty"`
+	// Identity selects the local identity to send as
+	Identity string    `json:"identity,omitempty"`
+	Message  string    `json:"message"`
+	Position *Position `json:"position,omitempty"`
+	Scope    *Scope    `json:"scope,omitempty"`
+	ACK      bool      `json:"ack,omitempty"`
+	// Reliable retransmits the message until it is acknowledged, implies ACK
+	Reliable *Reliable `json:"reliable,omitempty"`
+}
+
+// Reliable configures the delivery of a reliable message.
+type Reliable struct {
+	// Expected lists the stations that have to acknowledge the message
+	Expected []string `json:"expected"`
+	// Quorum of acknowledging stations, 0 requires all expected stations
+	Quorum uint `json:"quorum,omitempty"`
+	// Deadline in seconds, defaults to the node settings
+	Deadline float64 `json:"deadline,omitempty"`
+}
+
+// ServiceMessage announces a service, the service references an address of the contact.
+type ServiceMessage struct {
+	Sequence uint64  `json:"sequence"`
+	Contact  Contact `json:"contact"`
+	// Identity selects the local identity to send as
+	Identity string                  `json:"identity,omitempty"`
+	Service  protocol.ServicePayload `json:"service"`
+	Position *Position               `json:"position,omitempty"`
+	Scope    *Scope                  `json:"scope,omitempty"`
+}
+
+// Spread is the source and sequence of a spread message.
+type Spread struct {
+	Source   string `json:"source"`
+	Sequence uint64 `json:"sequence"`
+}
+
+// WSMessage is a message spread from a websocket, the identity selects the
+// local identity to send as.
+type WSMessage struct {
+	protocol.Message
+	Identity string `json:"identity,omitempty"`
+}
+
+// ACL contains the access control lists and their counters.
+type ACL struct {
+	Rules  parameters.ACLSettings `json:"rules"`
+	Status node.ACLStatus         `json:"status"`
+}
+
+// ACLEntry is an entry that is added to an access control list.
+type ACLEntry struct {
+	Entry string `json:"entry"`
 }
 
 func messageToJSON(msg *protocol.Message) string {
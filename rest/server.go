@@ -1,7 +1,10 @@
 package rest
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/donothingloop/hamgo/node"
 	"github.com/donothingloop/hamgo/parameters"
@@ -12,6 +15,9 @@ import (
 	"github.com/labstack/echo"
 )
 
+// shutdownTimeout limits the time for open requests to complete on shutdown.
+const shutdownTimeout = 5 * time.Second
+
 // Server provides a server for accessing the hamgo protocol.
 type Server struct {
 	settings parameters.RESTSettings
@@ -24,8 +30,8 @@ func NewServer(sett parameters.RESTSettings) *Server {
 	}
 }
 
-// Init the rest server.
-func (r *Server) Init(n *node.Node) {
+// Init the rest server, it serves until the context is done.
+func (r *Server) Init(ctx context.Context, n *node.Node) {
 	logrus.Debug("RESTServer: starting")
 
 	e := echo.New()
@@ -44,11 +50,29 @@ func (r *Server) Init(n *node.Node) {
 	e.Static("/", r.settings.Frontend)
 
 	port := r.settings.Port
-	err := e.Start(fmt.Sprintf(":%d", port))
-
 	logrus.Debugf("RESTServer: listening on port %d", port)
 
-	if err != nil {
-		logrus.WithError(err).Warn("REST server error")
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Start(fmt.Sprintf(":%d", port))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).Warn("REST server error")
+		}
+
+	case <-ctx.Done():
+		logrus.Debug("RESTServer: shutting down")
+
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		if err := e.Shutdown(sctx); err != nil {
+			logrus.WithError(err).Warn("RESTServer: failed to shut down")
+		}
+
+		<-done
 	}
 }
@@ -11,6 +11,24 @@ type Handler struct {
 	node *node.Node
 }
 
+func init() {
+	node.RegisterExtension("upd", func(n *node.Node) *node.PayloadHandler {
+		h := NewHandler(n)
+
+		return &node.PayloadHandler{
+			Type:          protocol.PayloadUpd,
+			Decode:        decode,
+			Handle:        h.UpdHandler,
+			PeerConnected: h.PeerConnectedHandler,
+		}
+	})
+}
+
+// decode parses an update protocol payload.
+func decode(buf []byte) (interface{}, error) {
+	return protocol.ParseUpdPayload(buf)
+}
+
 // NewHandler creates a new update protocol handler.
 func NewHandler(n *node.Node) *Handler {
 	return &Handler{
@@ -23,7 +41,7 @@ func (h *Handler) PeerConnectedHandler(peer *node.Peer) {
 	qry := protocol.UpdPayloadCacheRequest{}
 
 	// build the query message
-	for _, e := range h.node.Cache {
+	for _, e := range h.node.CacheSnapshot() {
 		qe := protocol.UpdRequestCacheEntry{
 			SeqCounter: e.SeqCounter,
 			Source:     e.Source,
@@ -59,13 +77,13 @@ func (h *Handler) PeerConnectedHandler(peer *node.Peer) {
 
 	msgbuf := msg.Bytes()
 	logrus.WithField("payload", qry).Debug("UpProto: sending query message")
-	peer.QueueMessage(msgbuf)
+	peer.QueueMessage(msgbuf, node.MessagePriority(&msg))
 }
 
 // msgInRequest checks if a message is already cached on the querying node.
 func (h *Handler) msgInRequest(msg *protocol.Message, req *protocol.UpdPayloadCacheRequest) bool {
 	for _, m := range req.Entries {
-		if (m.SeqCounter == msg.SeqCounter) && m.Source.Compare(&msg.Source) {
+		if (m.SeqCounter == msg.SeqCounter) && m.Source.SameCallsign(&msg.Source) {
 			return true
 		}
 	}
@@ -73,6 +91,12 @@ func (h *Handler) msgInRequest(msg *protocol.Message, req *protocol.UpdPayloadCa
 	return false
 }
 
+// originated checks if a cached message was originated by the node, the
+// received messages contain the path they travelled.
+func originated(msg *protocol.Message) bool {
+	return msg.Path == ""
+}
+
 // handleRequest handles a request for the update protocol.
 func (h *Handler) handleRequest(upd *protocol.UpdPayload, src *node.Peer) {
 	req := protocol.ParsePayloadCacheRequest(upd.Data)
@@ -80,11 +104,27 @@ func (h *Handler) handleRequest(upd *protocol.UpdPayload, src *node.Peer) {
 		return
 	}
 
+	role := h.node.Role()
+	if !role.Relays() && !role.Originates() {
+		logrus.Debugf("UpProto: %s node, ignoring query", role)
+		return
+	}
+
 	res := protocol.UpdPayloadCacheResponse{}
 
 	logrus.WithField("payload", req).Info("UpProto: received query")
 
-	for _, c := range h.node.Cache {
+	for _, c := range h.node.CacheSnapshot() {
+		// nodes that do not relay only serve their own messages
+		if !role.Relays() && !originated(c) {
+			continue
+		}
+
+		// scoped messages are not passed on outside of their area
+		if !h.node.InScope(c) {
+			continue
+		}
+
 		if !h.msgInRequest(c, req) {
 			res.Entries = append(res.Entries, protocol.UpdPayloadEntry{
 				Message: *c,
@@ -124,7 +164,7 @@ func (h *Handler) handleRequest(upd *protocol.UpdPayload, src *node.Peer) {
 	msgBuf := msg.Bytes()
 
 	logrus.WithField("payload", res).Debug("UpProto: sending response message")
-	src.QueueMessage(msgBuf)
+	src.QueueMessage(msgBuf, node.MessagePriority(&msg))
 }
 
 func (h *Handler) handleResponse(upd *protocol.UpdPayload, src *node.Peer) {
@@ -144,13 +184,8 @@ func (h *Handler) handleResponse(upd *protocol.UpdPayload, src *node.Peer) {
 	}
 }
 
-// UpdHandler handles messages for the update protocol.
-func (h *Handler) UpdHandler(msg *protocol.Message, src *node.Peer) {
-	// ignore non-hamgo messages
-	if msg.PayloadType != protocol.PayloadUpd {
-		return
-	}
-
+// UpdHandler handles decoded messages for the update protocol.
+func (h *Handler) UpdHandler(msg *protocol.Message, payload interface{}, src *node.Peer) {
 	// catch empty messages
 	if src == nil || msg == nil {
 		return
@@ -158,9 +193,9 @@ func (h *Handler) UpdHandler(msg *protocol.Message, src *node.Peer) {
 
 	logrus.Debug("UpProto: received message")
 
-	upd, err := protocol.ParseUpdPayload(msg.Payload)
-	if err != nil {
-		logrus.WithError(err).Warn("UPDProto: failed to handle message")
+	upd, ok := payload.(*protocol.UpdPayload)
+	if !ok {
+		logrus.Warn("UPDProto: failed to handle message")
 		return
 	}
 